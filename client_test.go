@@ -92,7 +92,7 @@ func TestClientRequest(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 		defer cancel()
 
-		want := []websocket.Message{websocket.ByteMessage("hey")}
+		want := []websocket.Message{websocket.TextMessage("hey")}
 		url, srv := test.NewWsHandler(func(conn *netWs.Conn) {
 			writer, _ := conn.NewFrameWriter(netWs.TextFrame)
 			//goland:noinspection GoUnhandledErrorResult
@@ -0,0 +1,23 @@
+// Package cbor encodes values as CBOR (RFC 8949).
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+)
+
+const ContentType = "application/cbor"
+
+// Codec encodes values as CBOR using "cbor" struct tags, it may be registered in codecs.Codecs.
+type Codec struct{}
+
+func (Codec) ContentType() string {
+	return ContentType
+}
+
+func (Codec) Encode(value any) ([]byte, error) {
+	return cbor.Marshal(value)
+}
+
+func (Codec) Decode(data []byte, value any) error {
+	return cbor.Unmarshal(data, value)
+}
@@ -0,0 +1,41 @@
+package cbor
+
+import (
+	"netshaper/codecs"
+	"netshaper/codecs/json"
+	"reflect"
+	"testing"
+)
+
+type testUser struct {
+	ID   int    `cbor:"id"`
+	Name string `cbor:"name"`
+}
+
+func TestCodec(t *testing.T) {
+	want := &testUser{ID: 1, Name: "john"}
+
+	data, err := Codec{}.Encode(want)
+	if err != nil {
+		t.Errorf("Encode() error got = %v, want nil", err)
+		return
+	}
+
+	got := &testUser{}
+	if err = (Codec{}).Decode(data, got); err != nil {
+		t.Errorf("Decode() error got = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() got = %v, want %v", got, want)
+	}
+}
+
+func TestCodecLookup(t *testing.T) {
+	registered := codecs.Codecs{json.Codec{}, Codec{}}
+
+	for _, contentType := range []string{"APPLICATION/CBOR", "application/cbor; charset=binary"} {
+		if got, err := registered.Lookup(contentType); err != nil || got != (Codec{}) {
+			t.Errorf("Lookup(%q) got = %T (%v), want %T", contentType, got, err, Codec{})
+		}
+	}
+}
@@ -0,0 +1,16 @@
+module netshaper/codecs/cbor
+
+go 1.21
+
+require (
+	github.com/fxamacker/cbor/v2 v2.6.0
+	netshaper v0.0.0
+)
+
+require (
+	github.com/coder/websocket v1.8.12 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/net v0.20.0 // indirect
+)
+
+replace netshaper => ../..
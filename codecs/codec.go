@@ -0,0 +1,107 @@
+// Package codecs encodes request and decodes response bodies with a codec chosen by the content type. The codecs with
+// third party dependencies (cbor, msgpack and protobuf) are separate modules.
+package codecs
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Codec encodes values into bodies of its content type. Encode receives a pointer to the value and Decode a pointer
+// to the target. Implementations must be safe for concurrent use.
+type Codec interface {
+	ContentType() string
+	Encode(value any) ([]byte, error)
+	Decode(data []byte, value any) error
+}
+
+// Codecs are registered codecs in order of preference: the first one encodes requests and decodes responses without
+// a content type.
+type Codecs []Codec
+
+// Accept returns the Accept header value listing content types of the codecs.
+func (c Codecs) Accept() string {
+	types := make([]string, 0, len(c))
+	for _, codec := range c {
+		types = append(types, mediaType(codec.ContentType()))
+	}
+
+	return strings.Join(types, ", ")
+}
+
+// Lookup returns the codec of the content type. The "x-" prefix of the subtype is ignored, so "application/x-msgpack"
+// matches "application/msgpack", and a structured syntax suffix matches its codec, e.g. "application/problem+json"
+// matches "application/json".
+func (c Codecs) Lookup(contentType string) (Codec, error) {
+	if len(c) == 0 {
+		return nil, ErrUnsupportedContentType
+	}
+	if contentType == "" {
+		return c[0], nil
+	}
+
+	want := normalizeMediaType(mediaType(contentType))
+	for _, codec := range c {
+		if normalizeMediaType(mediaType(codec.ContentType())) == want {
+			return codec, nil
+		}
+	}
+
+	if typ, subtype, ok := strings.Cut(want, "/"); ok {
+		if i := strings.LastIndexByte(subtype, '+'); i >= 0 {
+			suffixed := typ + "/" + subtype[i+1:]
+			for _, codec := range c {
+				if normalizeMediaType(mediaType(codec.ContentType())) == suffixed {
+					return codec, nil
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentType, contentType)
+}
+
+// IsText reports whether the content type is textual, e.g. text/plain, application/json or application/ld+json.
+// Websocket responses send textual bodies in text frames and others in binary frames.
+func IsText(contentType string) bool {
+	typ, subtype, _ := strings.Cut(normalizeMediaType(mediaType(contentType)), "/")
+	if i := strings.LastIndexByte(subtype, '+'); i >= 0 {
+		subtype = subtype[i+1:]
+	}
+
+	switch {
+	case typ == "text":
+		return true
+	case typ != "application":
+		return false
+	}
+
+	switch subtype {
+	case "json", "xml", "www-form-urlencoded", "javascript", "ndjson", "jsonl", "json-seq":
+		return true
+	default:
+		return false
+	}
+}
+
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return parsed
+}
+
+func normalizeMediaType(mediaType string) string {
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return mediaType
+	}
+
+	return typ + "/" + strings.TrimPrefix(subtype, "x-")
+}
@@ -0,0 +1,224 @@
+package codecs
+
+import (
+	"context"
+	"errors"
+	netWs "golang.org/x/net/websocket"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/codecs/form"
+	"netshaper/codecs/json"
+	"netshaper/http"
+	"netshaper/test"
+	"netshaper/websocket"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// testBinaryCodec encodes values as JSON, but its content type is not textual.
+type testBinaryCodec struct {
+	json.Codec
+}
+
+func (testBinaryCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+func TestCodecsLookup(t *testing.T) {
+	multipart := form.NewMultipartCodec()
+	registered := Codecs{json.Codec{}, testBinaryCodec{}, form.Codec{}, multipart}
+
+	tests := []struct {
+		contentType string
+		want        Codec
+		wantErr     error
+	}{
+		{contentType: "", want: json.Codec{}},
+		{contentType: "application/json; charset=utf-8", want: json.Codec{}},
+		{contentType: "application/problem+json", want: json.Codec{}},
+		{contentType: "application/x-octet-stream", want: testBinaryCodec{}},
+		{contentType: "APPLICATION/OCTET-STREAM", want: testBinaryCodec{}},
+		{contentType: "application/x-www-form-urlencoded", want: form.Codec{}},
+		{contentType: "multipart/form-data; boundary=other", want: multipart},
+		{contentType: "text/html", wantErr: ErrUnsupportedContentType},
+	}
+
+	for _, tt := range tests {
+		got, err := registered.Lookup(tt.contentType)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Lookup(%q) error got = %v, want %v", tt.contentType, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) got = %T, want %T", tt.contentType, got, tt.want)
+		}
+	}
+
+	if got, want := (Codecs{json.Codec{}, testBinaryCodec{}}).Accept(), "application/json, application/octet-stream"; got != want {
+		t.Errorf("Accept() got = %v, want %v", got, want)
+	}
+}
+
+// newEchoServer decodes the request body with the request content type and encodes it with the response codec.
+func newEchoServer[T any](t *testing.T, request Codec, response Codec) (netshaper.URL, func()) {
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, req *netHttp.Request) {
+		if got := req.Header.Get("Content-Type"); got != request.ContentType() {
+			t.Errorf("server Content-Type got = %v, want %v", got, request.ContentType())
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		value := new(T)
+		if err := request.Decode(body, value); err != nil {
+			t.Errorf("server Decode() error got = %v, want nil", err)
+		}
+
+		encoded, _ := response.Encode(value)
+		writer.Header().Set("Content-Type", response.ContentType())
+		_, _ = writer.Write(encoded)
+	})
+
+	return url, srv.Close
+}
+
+func TestRequestHttp(t *testing.T) {
+	tests := []struct {
+		name     string
+		codecs   Codecs
+		response Codec
+	}{
+		{name: "json", codecs: Codecs{json.Codec{}}, response: json.Codec{}},
+		{name: "binary", codecs: Codecs{testBinaryCodec{}}, response: testBinaryCodec{}},
+		{name: "negotiated", codecs: Codecs{json.Codec{}, testBinaryCodec{}}, response: testBinaryCodec{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			url, closeSrv := newEchoServer[testUser](t, tt.codecs[0], tt.response)
+			defer closeSrv()
+
+			cl, _ := netshaper.NewClient(ctx, http.NewNet())
+			defer cl.Close(ctx)
+
+			want := &testUser{ID: 1, Name: "john"}
+			res, err := RequestHttp[testUser, testUser](ctx, cl, tt.codecs, netHttp.MethodPost, url, nil, want)
+			if err != nil {
+				t.Errorf("RequestHttp() error got = %v, want nil", err)
+				return
+			}
+
+			got, err := res.Value()
+			if err != nil {
+				t.Errorf("Value() error got = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Value() got = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHttpResponseUnsupportedContentType(t *testing.T) {
+	res := &HttpResponse[testUser]{
+		Response: &http.Response{
+			Header: netHttp.Header{"Content-Type": {"text/html"}},
+			Body:   io.NopCloser(nil),
+		},
+		codecs: Codecs{json.Codec{}},
+	}
+
+	if _, err := res.Value(); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Errorf("Value() error got = %v, want %v", err, ErrUnsupportedContentType)
+	}
+}
+
+func TestRequestWebsocket(t *testing.T) {
+	tests := []struct {
+		name     string
+		codec    Codec
+		wantType websocket.MessageType
+	}{
+		{name: "binary", codec: testBinaryCodec{}, wantType: websocket.MessageBinary},
+		{name: "json", codec: json.Codec{}, wantType: websocket.MessageText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			// the server echoes the frame with its payload type
+			url, srv := test.NewWsHandler(func(conn *netWs.Conn) {
+				frame, err := conn.NewFrameReader()
+				if err != nil {
+					return
+				}
+				payload, _ := io.ReadAll(frame)
+				writer, _ := conn.NewFrameWriter(frame.PayloadType())
+				_, _ = writer.Write(payload)
+				_ = writer.Close()
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.NewClient(ctx, websocket.NewNet())
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := RequestWebsocket[testUser](cl, tt.codec, &websocket.Request{Ctx: ctx, URL: url})
+			if err != nil {
+				t.Errorf("RequestWebsocket() error got = %v, want nil", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			want := testUser{ID: 1, Name: "john"}
+			if err = res.Send(want); err != nil {
+				t.Errorf("Send() error got = %v, want nil", err)
+			}
+
+			msg := <-res.Listen()
+			if msg == nil || msg.Err() != nil || !reflect.DeepEqual(*msg.Value, want) {
+				t.Errorf("Listen() got = %v, want %v", msg, want)
+				return
+			}
+			if got := msg.MessageType(); got != tt.wantType {
+				t.Errorf("Listen() message type got = %v, want %v", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "application/json; charset=utf-8", want: true},
+		{contentType: "application/ld+json", want: true},
+		{contentType: "text/plain", want: true},
+		{contentType: "application/x-www-form-urlencoded", want: true},
+		{contentType: "application/x-ndjson", want: true},
+		{contentType: "application/x-protobuf", want: false},
+		{contentType: "application/msgpack", want: false},
+		{contentType: "image/svg+xml", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := IsText(tt.contentType); got != tt.want {
+				t.Errorf("IsText() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Package form encodes application/x-www-form-urlencoded and multipart/form-data bodies.
+package form
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"netshaper/codecs/query"
+)
+
+const ContentType = "application/x-www-form-urlencoded"
+
+var ErrUnsupportedType = errors.New("unsupported form value type")
+
+// Codec encodes url.Values, map[string]string, map[string][]string and structs with query tags, it may be registered in
+// codecs.Codecs. Structs are encoded with the query config.
+type Codec struct {
+	Query query.Config
+}
+
+func (Codec) ContentType() string {
+	return ContentType
+}
+
+func (c Codec) Encode(value any) ([]byte, error) {
+	values, err := c.toValues(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(values.Encode()), nil
+}
+
+func (c Codec) Decode(data []byte, value any) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	return c.fromValues(values, value)
+}
+
+func (c Codec) toValues(value any) (url.Values, error) {
+	switch v := value.(type) {
+	case url.Values:
+		return v, nil
+	case *url.Values:
+		return *v, nil
+	case map[string][]string:
+		return v, nil
+	case *map[string][]string:
+		return *v, nil
+	case map[string]string:
+		return stringMapValues(v), nil
+	case *map[string]string:
+		return stringMapValues(*v), nil
+	default:
+		values, err := c.Query.Values(value)
+		return values, unsupported(err)
+	}
+}
+
+func (c Codec) fromValues(values url.Values, value any) error {
+	switch v := value.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string][]string:
+		*v = values
+	case *map[string]string:
+		*v = make(map[string]string, len(values))
+		for name := range values {
+			(*v)[name] = values.Get(name)
+		}
+	default:
+		return unsupported(c.Query.DecodeValues(values, value))
+	}
+
+	return nil
+}
+
+// unsupported wraps query type errors, so they match ErrUnsupportedType.
+func unsupported(err error) error {
+	if errors.Is(err, query.ErrUnsupportedType) {
+		return fmt.Errorf("%w: %w", ErrUnsupportedType, err)
+	}
+
+	return err
+}
+
+func stringMapValues(m map[string]string) url.Values {
+	values := make(url.Values, len(m))
+	for name, value := range m {
+		values.Set(name, value)
+	}
+
+	return values
+}
@@ -0,0 +1,80 @@
+package form
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    string
+		wantErr error
+	}{
+		{name: "values", value: url.Values{"b": {"2", "3"}, "a": {"x y"}}, want: "a=x+y&b=2&b=3"},
+		{name: "string map pointer", value: &map[string]string{"key": "a&b"}, want: "key=a%26b"},
+		{name: "struct", value: &struct {
+			Name string   `query:"name"`
+			Tags []string `query:"tag"`
+		}{Name: "john", Tags: []string{"a", "b"}}, want: "name=john&tag=a&tag=b"},
+		{name: "unsupported", value: 42, wantErr: ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Codec{}.Encode(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Encode() error got = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+
+	var decoded map[string]string
+	if err := (Codec{}).Decode([]byte("a=1&b=x+y&a=2"), &decoded); err != nil {
+		t.Errorf("Decode() error got = %v, want nil", err)
+	}
+	if want := map[string]string{"a": "1", "b": "x y"}; !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Decode() got = %v, want %v", decoded, want)
+	}
+}
+
+func TestMultipartCodec(t *testing.T) {
+	codec := NewMultipartCodec()
+	want := &Multipart{
+		Values: url.Values{"name": {"john"}, "tags": {"a", "b"}},
+		Files: []File{
+			{Field: "avatar", Name: "avatar.png", ContentType: "image/png", Content: []byte{0x89, 'P', 'N', 'G'}},
+			{Field: "notes", Name: "notes.txt", ContentType: "application/octet-stream", Content: []byte("hey")},
+		},
+	}
+
+	data, err := codec.Encode(want)
+	if err != nil {
+		t.Errorf("Encode() error got = %v, want nil", err)
+		return
+	}
+
+	if !strings.HasPrefix(codec.ContentType(), "multipart/form-data; boundary=") {
+		t.Errorf("ContentType() got = %v, want multipart/form-data with boundary", codec.ContentType())
+	}
+
+	// another codec decodes the body with the boundary of the body
+	got := &Multipart{}
+	if err = NewMultipartCodec().Decode(append([]byte("preamble\r\n"), data...), got); err != nil {
+		t.Errorf("Decode() error got = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() got = %+v, want %+v", got, want)
+	}
+
+	if err = codec.Decode([]byte("not multipart"), got); !errors.Is(err, ErrNoBoundary) {
+		t.Errorf("Decode() error got = %v, want %v", err, ErrNoBoundary)
+	}
+}
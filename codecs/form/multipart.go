@@ -0,0 +1,149 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+)
+
+const MultipartContentType = "multipart/form-data"
+
+var ErrNoBoundary = errors.New("multipart boundary not found")
+
+type Multipart struct {
+	Values url.Values
+	Files  []File
+}
+
+type File struct {
+	Field       string
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// NewMultipartCodec returns a codec with a random boundary.
+func NewMultipartCodec() *MultipartCodec {
+	return &MultipartCodec{boundary: multipart.NewWriter(io.Discard).Boundary()}
+}
+
+// MultipartCodec encodes Multipart values, it may be registered in codecs.Codecs. The boundary of a decoded body is
+// taken from its first delimiter line.
+type MultipartCodec struct {
+	boundary string
+}
+
+func (c *MultipartCodec) ContentType() string {
+	return mime.FormatMediaType(MultipartContentType, map[string]string{"boundary": c.boundary})
+}
+
+func (c *MultipartCodec) Encode(value any) ([]byte, error) {
+	var form *Multipart
+	switch v := value.(type) {
+	case Multipart:
+		form = &v
+	case *Multipart:
+		form = v
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, value)
+	}
+
+	var buff bytes.Buffer
+	writer := multipart.NewWriter(&buff)
+	if err := writer.SetBoundary(c.boundary); err != nil {
+		return nil, err
+	}
+
+	for name, values := range form.Values {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, file := range form.Files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": file.Field, "filename": file.Name}))
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = part.Write(file.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+func (c *MultipartCodec) Decode(data []byte, value any) error {
+	form, ok := value.(*Multipart)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, value)
+	}
+
+	boundary, err := parseBoundary(data)
+	if err != nil {
+		return err
+	}
+
+	*form = Multipart{Values: url.Values{}}
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+
+		if part.FileName() == "" {
+			form.Values.Add(part.FormName(), string(content))
+			continue
+		}
+
+		form.Files = append(form.Files, File{
+			Field:       part.FormName(),
+			Name:        part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Content:     content,
+		})
+	}
+}
+
+// parseBoundary returns the boundary of the first delimiter line, skipping the preamble.
+func parseBoundary(data []byte) (string, error) {
+	for len(data) > 0 {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		line = bytes.TrimRight(line, " \t\r")
+		if bytes.HasPrefix(line, []byte("--")) && len(line) > 2 {
+			return string(line[2:]), nil
+		}
+		data = rest
+	}
+
+	return "", ErrNoBoundary
+}
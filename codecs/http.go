@@ -0,0 +1,111 @@
+package codecs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"netshaper"
+	"netshaper/http"
+)
+
+// HttpResponse decodes the body with the codec of its content type.
+type HttpResponse[T any] struct {
+	*http.Response
+	codecs Codecs
+}
+
+// Value decodes the body regardless of the status code and closes it.
+func (r *HttpResponse[T]) Value() (*T, error) {
+	defer func() { _ = r.Body.Close() }()
+
+	codec, err := r.codecs.Lookup(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeBody[T](codec, r.Body)
+}
+
+// RequestHttp encodes the body with the first codec and accepts responses of all codecs.
+func RequestHttp[T1 any, T2 any](ctx context.Context, client http.Client, codecs Codecs, method string, url netshaper.URL, headers netshaper.Headers, body *T1) (response *HttpResponse[T2], err error) {
+	req, err := NewHttpRequest(ctx, codecs, method, url, headers, body)
+	if err != nil {
+		return
+	}
+
+	res, err := client.Request(req)
+	if err != nil {
+		return
+	}
+
+	response = &HttpResponse[T2]{Response: res, codecs: codecs}
+
+	return
+}
+
+// NewHttpRequest sets the Content-Type header of the first codec if there is a body and the Accept header of all
+// codecs unless they are set.
+func NewHttpRequest[T1 any](ctx context.Context, codecs Codecs, method string, url netshaper.URL, headers netshaper.Headers, body *T1) (*http.Request, error) {
+	if len(codecs) == 0 {
+		return nil, ErrUnsupportedContentType
+	}
+
+	byteBody, err := EncodeBody(codecs[0], body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(ctx, method, url, headers, byteBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", codecs.Accept())
+	}
+	if byteBody != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", codecs[0].ContentType())
+	}
+
+	return req, nil
+}
+
+func EncodeBody[T any](codec Codec, body *T) (buff []byte, err error) {
+	if body != nil {
+		buff, err = codec.Encode(body)
+	}
+
+	return
+}
+
+func DecodeBody[T any](codec Codec, body io.Reader) (value *T, err error) {
+	buff, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	return Parse[T](codec, buff)
+}
+
+func Parse[T any](codec Codec, buff []byte) (value *T, err error) {
+	value = new(T)
+	if err = codec.Decode(buff, value); err != nil {
+		return nil, &ParseError[T]{value, codec.ContentType(), err}
+	}
+
+	return
+}
+
+type ParseError[T any] struct {
+	Value       *T
+	ContentType string
+	Err         error
+}
+
+func (e *ParseError[T]) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError[T]) Error() string {
+	return fmt.Sprintf("failed to parse %T %v response: %s", e.Value, e.ContentType, e.Err.Error())
+}
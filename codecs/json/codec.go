@@ -0,0 +1,20 @@
+package json
+
+import (
+	"encoding/json"
+)
+
+// Codec encodes values as JSON, it may be registered in codecs.Codecs.
+type Codec struct{}
+
+func (Codec) ContentType() string {
+	return ContentType
+}
+
+func (Codec) Encode(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (Codec) Decode(data []byte, value any) error {
+	return json.Unmarshal(data, value)
+}
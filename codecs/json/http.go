@@ -10,7 +10,10 @@ import (
 
 type HttpResponse[T any] http.Response
 
+// Value decodes the body regardless of the status code and closes it.
 func (r *HttpResponse[T]) Value() (*T, error) {
+	defer func() { _ = r.Body.Close() }()
+
 	return DecodeBody[T](r.Body)
 }
 
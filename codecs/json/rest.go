@@ -0,0 +1,211 @@
+package json
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	netHttp "net/http"
+	"net/url"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ContentType = "application/json"
+
+	DefaultMaxResponseSize = 10 << 20
+
+	maxErrorBodySize = 256
+)
+
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+func WithHeaders(headers netshaper.Headers) conf.Option[RestConfig] {
+	return conf.OptionFunc[RestConfig](func(config RestConfig) RestConfig {
+		config.Headers = headers
+		return config
+	})
+}
+
+// WithMaxResponseSize limits the size of response bodies, a negative size disables the limit.
+func WithMaxResponseSize(size int64) conf.Option[RestConfig] {
+	return conf.OptionFunc[RestConfig](func(config RestConfig) RestConfig {
+		config.MaxResponseSize = size
+		return config
+	})
+}
+
+// RestConfig describes default headers of every request and the response size limit, DefaultMaxResponseSize by
+// default.
+type RestConfig struct {
+	Headers         netshaper.Headers
+	MaxResponseSize int64
+}
+
+// NewRestClient returns a client sending requests relative to the base URL. Error responses are decoded into E.
+func NewRestClient[E any](client http.Client, baseURL netshaper.URL, opts ...conf.Option[RestConfig]) *RestClient[E] {
+	config := conf.ApplyOptions(opts)
+	if config.MaxResponseSize == 0 {
+		config.MaxResponseSize = DefaultMaxResponseSize
+	}
+
+	return &RestClient[E]{client: client, baseURL: baseURL, config: config}
+}
+
+type RestClient[E any] struct {
+	client  http.Client
+	baseURL netshaper.URL
+	config  RestConfig
+}
+
+// HTTPError is returned for responses with a non-2xx status code. Value is nil if the body is not valid JSON of E.
+type HTTPError[E any] struct {
+	StatusCode int
+	Header     netshaper.Headers
+	Body       []byte
+	Value      *E
+}
+
+// Error includes the body truncated to maxErrorBodySize bytes, the whole body is kept in Body.
+func (e *HTTPError[E]) Error() string {
+	body := e.Body
+	if len(body) <= maxErrorBodySize {
+		return fmt.Sprintf("request failed with status code %v: %s", e.StatusCode, body)
+	}
+
+	body = body[:maxErrorBodySize]
+	// a rune cut in the middle is dropped
+	start := len(body) - 1
+	for start > 0 && start > len(body)-utf8.UTFMax && !utf8.RuneStart(body[start]) {
+		start--
+	}
+	if !utf8.FullRune(body[start:]) {
+		body = body[:start]
+	}
+
+	return fmt.Sprintf("request failed with status code %v: %s…", e.StatusCode, body)
+}
+
+func Get[Res any, E any](ctx context.Context, client *RestClient[E], path string, headers netshaper.Headers) (*Res, error) {
+	return Do[struct{}, Res](ctx, client, netHttp.MethodGet, path, headers, nil)
+}
+
+func Post[Req any, Res any, E any](ctx context.Context, client *RestClient[E], path string, headers netshaper.Headers, body *Req) (*Res, error) {
+	return Do[Req, Res](ctx, client, netHttp.MethodPost, path, headers, body)
+}
+
+func Put[Req any, Res any, E any](ctx context.Context, client *RestClient[E], path string, headers netshaper.Headers, body *Req) (*Res, error) {
+	return Do[Req, Res](ctx, client, netHttp.MethodPut, path, headers, body)
+}
+
+func Patch[Req any, Res any, E any](ctx context.Context, client *RestClient[E], path string, headers netshaper.Headers, body *Req) (*Res, error) {
+	return Do[Req, Res](ctx, client, netHttp.MethodPatch, path, headers, body)
+}
+
+func Delete[Res any, E any](ctx context.Context, client *RestClient[E], path string, headers netshaper.Headers) (*Res, error) {
+	return Do[struct{}, Res](ctx, client, netHttp.MethodDelete, path, headers, nil)
+}
+
+// Do sends the request to the path relative to the base URL, the path may contain a query. The response body is
+// always closed; an empty body of a successful response is decoded as a zero Res.
+func Do[Req any, Res any, E any](ctx context.Context, client *RestClient[E], method string, path string, headers netshaper.Headers, body *Req) (*Res, error) {
+	u, err := client.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := NewHttpRequest(ctx, method, *u, client.headers(headers, body != nil), body)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.client.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	buff, err := client.read(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		httpErr := &HTTPError[E]{StatusCode: res.StatusCode, Header: res.Header, Body: buff}
+		if len(buff) > 0 {
+			httpErr.Value, _ = Parse[E](buff)
+		}
+		return nil, httpErr
+	}
+
+	if len(buff) == 0 {
+		return new(Res), nil
+	}
+
+	return Parse[Res](buff)
+}
+
+func (c *RestClient[E]) resolve(path string) (*netshaper.URL, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if ref.IsAbs() {
+		return ref, nil
+	}
+
+	// escaped paths are joined, so escaped slashes (e.g. "a%2Fb") stay in a single segment
+	u := c.baseURL
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.TrimPrefix(ref.EscapedPath(), "/")
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return nil, err
+	}
+	switch {
+	case u.RawQuery == "":
+		u.RawQuery = ref.RawQuery
+	case ref.RawQuery != "":
+		u.RawQuery += "&" + ref.RawQuery
+	}
+
+	return &u, nil
+}
+
+// headers merges the default and request headers, the latter win.
+func (c *RestClient[E]) headers(headers netshaper.Headers, hasBody bool) netshaper.Headers {
+	merged := c.config.Headers.Clone()
+	if merged == nil {
+		merged = netshaper.Headers{}
+	}
+	for name, values := range headers {
+		merged[name] = values
+	}
+
+	if merged.Get("Accept") == "" {
+		merged.Set("Accept", ContentType)
+	}
+	if hasBody && merged.Get("Content-Type") == "" {
+		merged.Set("Content-Type", ContentType)
+	}
+
+	return merged
+}
+
+func (c *RestClient[E]) read(body io.Reader) ([]byte, error) {
+	if c.config.MaxResponseSize < 0 {
+		return io.ReadAll(body)
+	}
+
+	buff, err := io.ReadAll(io.LimitReader(body, c.config.MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buff)) > c.config.MaxResponseSize {
+		return nil, ErrResponseTooLarge
+	}
+
+	return buff, nil
+}
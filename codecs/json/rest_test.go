@@ -0,0 +1,219 @@
+package json
+
+import (
+	"context"
+	"errors"
+	"io"
+	netHttp "net/http"
+	net_shaper "netshaper"
+	"netshaper/http"
+	"netshaper/test"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type testApiError struct {
+	Code string `json:"code"`
+}
+
+type testRestRequest struct {
+	Method      string
+	Path        string
+	Query       string
+	Accept      string
+	ContentType string
+	Token       string
+	Body        string
+}
+
+func newTestRestServer(status int, body string, got *testRestRequest) (net_shaper.URL, func()) {
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		reqBody, _ := io.ReadAll(request.Body)
+		*got = testRestRequest{
+			Method:      request.Method,
+			Path:        request.URL.EscapedPath(),
+			Query:       request.URL.RawQuery,
+			Accept:      request.Header.Get("Accept"),
+			ContentType: request.Header.Get("Content-Type"),
+			Token:       request.Header.Get("X-Token"),
+			Body:        string(reqBody),
+		}
+
+		writer.WriteHeader(status)
+		_, _ = writer.Write([]byte(body))
+	})
+
+	return url, srv.Close
+}
+
+func TestRestClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		send    func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error)
+		want    *testUser
+		wantErr error
+		wantReq testRestRequest
+	}{
+		{
+			name:   "get",
+			status: netHttp.StatusOK,
+			body:   `{"id":1,"name":"john"}`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Get[testUser](ctx, cl, "users/1?fields=name", nil)
+			},
+			want:    &testUser{ID: 1, Name: "john"},
+			wantReq: testRestRequest{Method: "GET", Path: "/api/users/1", Query: "v=1&fields=name", Accept: ContentType, Token: "default"},
+		},
+		{
+			name:   "get escaped path",
+			status: netHttp.StatusOK,
+			body:   `{"id":1,"name":"john"}`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Get[testUser](ctx, cl, "/files/a%2Fb", nil)
+			},
+			want:    &testUser{ID: 1, Name: "john"},
+			wantReq: testRestRequest{Method: "GET", Path: "/api/files/a%2Fb", Query: "v=1", Accept: ContentType, Token: "default"},
+		},
+		{
+			name:   "post",
+			status: netHttp.StatusCreated,
+			body:   `{"id":2,"name":"jane"}`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Post[testUser, testUser](ctx, cl, "/users", net_shaper.Headers{"X-Token": {"override"}}, &testUser{Name: "jane"})
+			},
+			want:    &testUser{ID: 2, Name: "jane"},
+			wantReq: testRestRequest{Method: "POST", Path: "/api/users", Query: "v=1", Accept: ContentType, ContentType: ContentType, Token: "override", Body: `{"id":0,"name":"jane"}`},
+		},
+		{
+			name:   "delete without content",
+			status: netHttp.StatusNoContent,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Delete[testUser](ctx, cl, "users/2", nil)
+			},
+			want:    &testUser{},
+			wantReq: testRestRequest{Method: "DELETE", Path: "/api/users/2", Query: "v=1", Accept: ContentType, Token: "default"},
+		},
+		{
+			name:   "error",
+			status: netHttp.StatusNotFound,
+			body:   `{"code":"not_found"}`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Put[testUser, testUser](ctx, cl, "users/3", nil, &testUser{ID: 3})
+			},
+			wantErr: &HTTPError[testApiError]{
+				StatusCode: netHttp.StatusNotFound,
+				Body:       []byte(`{"code":"not_found"}`),
+				Value:      &testApiError{Code: "not_found"},
+			},
+			wantReq: testRestRequest{Method: "PUT", Path: "/api/users/3", Query: "v=1", Accept: ContentType, ContentType: ContentType, Token: "default", Body: `{"id":3,"name":""}`},
+		},
+		{
+			name:   "error not json",
+			status: netHttp.StatusBadGateway,
+			body:   `bad gateway`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Patch[testUser, testUser](ctx, cl, "users/3", nil, &testUser{ID: 3})
+			},
+			wantErr: &HTTPError[testApiError]{
+				StatusCode: netHttp.StatusBadGateway,
+				Body:       []byte(`bad gateway`),
+			},
+			wantReq: testRestRequest{Method: "PATCH", Path: "/api/users/3", Query: "v=1", Accept: ContentType, ContentType: ContentType, Token: "default", Body: `{"id":3,"name":""}`},
+		},
+		{
+			name:   "too large",
+			status: netHttp.StatusOK,
+			body:   `{"id":1,"name":"` + strings.Repeat("a", 100) + `"}`,
+			send: func(ctx context.Context, cl *RestClient[testApiError]) (*testUser, error) {
+				return Get[testUser](ctx, cl, "users/1", nil)
+			},
+			wantErr: ErrResponseTooLarge,
+			wantReq: testRestRequest{Method: "GET", Path: "/api/users/1", Query: "v=1", Accept: ContentType, Token: "default"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			var gotReq testRestRequest
+			url, closeSrv := newTestRestServer(tt.status, tt.body, &gotReq)
+			defer closeSrv()
+
+			client, err := net_shaper.NewClient(ctx, http.NewNet())
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer client.Close(ctx)
+
+			baseURL := url
+			baseURL.Path = "/api/"
+			baseURL.RawQuery = "v=1"
+
+			cl := NewRestClient[testApiError](client, baseURL,
+				WithHeaders(net_shaper.Headers{"X-Token": {"default"}}),
+				WithMaxResponseSize(64),
+			)
+
+			got, err := tt.send(ctx, cl)
+
+			var httpErr *HTTPError[testApiError]
+			if errors.As(err, &httpErr) {
+				httpErr.Header = nil
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("send() error got = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("send() got = %v, want %v", got, tt.want)
+			}
+			if gotReq != tt.wantReq {
+				t.Errorf("server request got = %+v, want %+v", gotReq, tt.wantReq)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "short body",
+			body: `{"code":"not_found"}`,
+			want: `request failed with status code 502: {"code":"not_found"}`,
+		},
+		{
+			name: "long body is truncated",
+			body: strings.Repeat("a", 300),
+			want: "request failed with status code 502: " + strings.Repeat("a", 256) + "…",
+		},
+		{
+			name: "cut rune is dropped",
+			body: strings.Repeat("a", 255) + "ü" + strings.Repeat("a", 10),
+			want: "request failed with status code 502: " + strings.Repeat("a", 255) + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &HTTPError[testApiError]{StatusCode: 502, Body: []byte(tt.body)}
+			if got := err.Error(); got != tt.want {
+				t.Errorf("Error() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
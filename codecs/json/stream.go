@@ -0,0 +1,194 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"netshaper"
+	"netshaper/http"
+	"sync"
+)
+
+const (
+	NDJSONContentType  = "application/x-ndjson"
+	JSONLContentType   = "application/jsonl"
+	JSONSeqContentType = "application/json-seq"
+)
+
+const (
+	ndjsonSeparator  = '\n'
+	jsonSeqSeparator = 0x1e
+)
+
+// StreamHttp decodes the response body by its content type: NDJSON, JSON text sequences or a JSON array otherwise.
+func StreamHttp[T any](ctx context.Context, res *http.Response) *Stream[T] {
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case NDJSONContentType, JSONLContentType:
+		return DecodeNDJSON[T](ctx, res.Body)
+	case JSONSeqContentType:
+		return DecodeSequence[T](ctx, res.Body)
+	default:
+		return DecodeArray[T](ctx, res.Body)
+	}
+}
+
+// DecodeNDJSON decodes newline-delimited JSON values, empty lines are skipped.
+func DecodeNDJSON[T any](ctx context.Context, body io.ReadCloser) *Stream[T] {
+	return newStream[T](ctx, body, func(body io.Reader, emit func(raw []byte) bool) error {
+		return splitRecords(body, ndjsonSeparator, emit)
+	})
+}
+
+// DecodeSequence decodes JSON text sequences (RFC 7464), values prefixed by the record separator.
+func DecodeSequence[T any](ctx context.Context, body io.ReadCloser) *Stream[T] {
+	return newStream[T](ctx, body, func(body io.Reader, emit func(raw []byte) bool) error {
+		return splitRecords(body, jsonSeqSeparator, emit)
+	})
+}
+
+// DecodeArray decodes elements of a top-level JSON array one by one. A syntax error ends the stream, since the rest
+// of the array can not be recovered.
+func DecodeArray[T any](ctx context.Context, body io.ReadCloser) *Stream[T] {
+	return newStream[T](ctx, body, func(body io.Reader, emit func(raw []byte) bool) error {
+		dec := json.NewDecoder(body)
+
+		if err := expectToken(dec, json.Delim('[')); err != nil {
+			return err
+		}
+
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if !emit(raw) {
+				return nil
+			}
+		}
+
+		return expectToken(dec, json.Delim(']'))
+	})
+}
+
+func expectToken(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("invalid JSON array: got %v, want %v", tok, want)
+	}
+
+	return nil
+}
+
+// splitRecords emits non-blank records separated by sep.
+func splitRecords(body io.Reader, sep byte, emit func(raw []byte) bool) error {
+	reader := bufio.NewReader(body)
+
+	for {
+		record, err := reader.ReadBytes(sep)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		record = bytes.TrimSpace(bytes.TrimSuffix(record, []byte{sep}))
+		if len(record) > 0 && !emit(record) {
+			return nil
+		}
+
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+var _ netshaper.Closeable = (*Stream[int])(nil)
+
+// Stream delivers decoded values until the body ends, fails or the context is done. The body is closed when the
+// stream ends.
+type Stream[T any] struct {
+	items  <-chan *StreamItem[T]
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	err    error
+}
+
+func newStream[T any](ctx context.Context, body io.ReadCloser, decode func(body io.Reader, emit func(raw []byte) bool) error) *Stream[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	items := make(chan *StreamItem[T])
+	s := &Stream[T]{items: items, cancel: cancel}
+
+	// closing the body unblocks the pending read once the context is done
+	var closeOnce sync.Once
+	closeBody := func() { closeOnce.Do(func() { _ = body.Close() }) }
+	stop := context.AfterFunc(ctx, closeBody)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		defer close(items)
+		defer closeBody()
+		defer stop()
+
+		err := decode(body, func(raw []byte) bool {
+			item := &StreamItem[T]{Raw: raw}
+			item.Value, item.Error = Parse[T](raw)
+
+			select {
+			case items <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}()
+
+	return s
+}
+
+// Listen returns values in order, the channel is closed when the stream ends.
+func (s *Stream[T]) Listen() <-chan *StreamItem[T] {
+	return s.items
+}
+
+// Err returns the error which ended the stream, nil if the whole body was decoded. Invalid values do not end the
+// stream, their errors are reported by items.
+func (s *Stream[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Close stops decoding and closes the body.
+func (s *Stream[T]) Close(_ context.Context) {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// StreamItem holds a decoded value or a ParseError[T] if the raw value is not valid JSON of T.
+type StreamItem[T any] struct {
+	Raw   []byte
+	Value *T
+	Error error
+}
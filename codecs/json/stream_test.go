@@ -0,0 +1,211 @@
+package json
+
+import (
+	"context"
+	"errors"
+	"io"
+	netHttp "net/http"
+	net_shaper "netshaper"
+	"netshaper/http"
+	"netshaper/test"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBodyCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (b *testBodyCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+// collect returns decoded values and indexes of items with parse errors.
+func collect[T any](s *Stream[T]) (values []T, invalid []int) {
+	i := 0
+	for item := range s.Listen() {
+		var parseErr *ParseError[T]
+		if errors.As(item.Error, &parseErr) {
+			invalid = append(invalid, i)
+		} else if item.Value != nil {
+			values = append(values, *item.Value)
+		}
+		i++
+	}
+
+	return
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		decode      func(ctx context.Context, body io.ReadCloser) *Stream[testUser]
+		body        string
+		wantValues  []testUser
+		wantInvalid []int
+		wantErr     bool
+	}{
+		{
+			name:       "ndjson",
+			decode:     DecodeNDJSON[testUser],
+			body:       "{\"id\":1}\n\n{\"id\":2}\r\n{\"id\":3}",
+			wantValues: []testUser{{ID: 1}, {ID: 2}, {ID: 3}},
+		},
+		{
+			name:        "ndjson with invalid line",
+			decode:      DecodeNDJSON[testUser],
+			body:        "{\"id\":1}\n{\"id\":\n[]\n{\"id\":4}\n",
+			wantValues:  []testUser{{ID: 1}, {ID: 4}},
+			wantInvalid: []int{1, 2},
+		},
+		{
+			name:       "json sequence",
+			decode:     DecodeSequence[testUser],
+			body:       "\x1e{\"id\":1}\n\x1e{\"id\":2}\n",
+			wantValues: []testUser{{ID: 1}, {ID: 2}},
+		},
+		{
+			name:        "json sequence with truncated record",
+			decode:      DecodeSequence[testUser],
+			body:        "\x1e{\"id\":1\x1e{\"id\":2}\n",
+			wantValues:  []testUser{{ID: 2}},
+			wantInvalid: []int{0},
+		},
+		{
+			name:       "array",
+			decode:     DecodeArray[testUser],
+			body:       ` [{"id":1}, {"id":2,"name":"jane"}] `,
+			wantValues: []testUser{{ID: 1}, {ID: 2, Name: "jane"}},
+		},
+		{
+			name:        "array with invalid element",
+			decode:      DecodeArray[testUser],
+			body:        `[{"id":1}, "two", {"id":3}]`,
+			wantValues:  []testUser{{ID: 1}, {ID: 3}},
+			wantInvalid: []int{1},
+		},
+		{
+			name:       "array with syntax error",
+			decode:     DecodeArray[testUser],
+			body:       `[{"id":1}, {"id":}]`,
+			wantValues: []testUser{{ID: 1}},
+			wantErr:    true,
+		},
+		{
+			name:    "not an array",
+			decode:  DecodeArray[testUser],
+			body:    `{"id":1}`,
+			wantErr: true,
+		},
+		{
+			name:       "truncated array",
+			decode:     DecodeArray[testUser],
+			body:       `[{"id":1}`,
+			wantValues: []testUser{{ID: 1}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			body := &testBodyCloser{Reader: strings.NewReader(tt.body)}
+			s := tt.decode(ctx, body)
+			defer s.Close(ctx)
+
+			values, invalid := collect(s)
+
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("Listen() values got = %v, want %v", values, tt.wantValues)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("Listen() invalid items got = %v, want %v", invalid, tt.wantInvalid)
+			}
+			if err := s.Err(); (err != nil) != tt.wantErr {
+				t.Errorf("Err() got = %v, want error %v", err, tt.wantErr)
+			}
+			if !body.closed {
+				t.Errorf("body must be closed")
+			}
+		})
+	}
+}
+
+func TestStreamHttp(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "application/x-ndjson", body: "{\"id\":1}\n{\"id\":2}\n"},
+		{contentType: "application/jsonl; charset=utf-8", body: "{\"id\":1}\n{\"id\":2}\n"},
+		{contentType: "application/json-seq", body: "\x1e{\"id\":1}\n\x1e{\"id\":2}\n"},
+		{contentType: "application/json", body: `[{"id":1},{"id":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, _ *netHttp.Request) {
+				writer.Header().Set("Content-Type", tt.contentType)
+				_, _ = writer.Write([]byte(tt.body))
+			})
+			defer srv.Close()
+
+			cl, _ := net_shaper.NewClient(ctx, http.NewNet())
+			defer cl.Close(ctx)
+
+			req, _ := http.NewGetRequest(ctx, url, nil)
+			res, err := cl.Request(req)
+			if err != nil {
+				t.Errorf("Request() error got = %v, want nil", err)
+				return
+			}
+
+			s := StreamHttp[testUser](ctx, res)
+			defer s.Close(ctx)
+
+			values, invalid := collect(s)
+			if want := []testUser{{ID: 1}, {ID: 2}}; !reflect.DeepEqual(values, want) || invalid != nil {
+				t.Errorf("Listen() got = %v, %v, want %v", values, invalid, want)
+			}
+			if err = s.Err(); err != nil {
+				t.Errorf("Err() got = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte("{\"id\":1}\n"))
+	}()
+
+	s := DecodeNDJSON[testUser](ctx, reader)
+
+	item := <-s.Listen()
+	if item == nil || item.Value == nil || item.Value.ID != 1 {
+		t.Errorf("Listen() got = %v, want first value", item)
+	}
+
+	// the stream is blocked on reading the body
+	s.Close(ctx)
+
+	if _, ok := <-s.Listen(); ok {
+		t.Errorf("Listen() must be closed")
+	}
+	if err := s.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() got = %v, want %v", err, context.Canceled)
+	}
+}
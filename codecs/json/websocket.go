@@ -42,7 +42,7 @@ func (r *WebsocketResponse[T]) Send(message T) error {
 		return err
 	}
 
-	return r.raw.Send(websocket.ByteMessage(bytes))
+	return r.raw.Send(websocket.TextMessage(bytes))
 }
 
 func (r *WebsocketResponse[T]) Listen() <-chan *WebsocketMessage[T] {
@@ -77,7 +77,7 @@ func (r *WebsocketResponse[T]) run(messages chan<- *WebsocketMessage[T]) {
 	}
 }
 
-var _ websocket.Message = (*WebsocketMessage[int])(nil)
+var _ websocket.TypedMessage = (*WebsocketMessage[int])(nil)
 
 type WebsocketMessage[T any] struct {
 	Raw   websocket.Message
@@ -89,6 +89,10 @@ func (m *WebsocketMessage[T]) Buff() []byte {
 	return m.Raw.Buff()
 }
 
+func (m *WebsocketMessage[T]) MessageType() websocket.MessageType {
+	return websocket.TypeOf(m.Raw)
+}
+
 func (m *WebsocketMessage[T]) Err() error {
 	if m.Error == nil {
 		return m.Raw.Err()
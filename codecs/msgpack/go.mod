@@ -0,0 +1,18 @@
+module netshaper/codecs/msgpack
+
+go 1.21
+
+require (
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	netshaper v0.0.0
+)
+
+require (
+	github.com/coder/websocket v1.8.12 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace netshaper => ../..
@@ -0,0 +1,23 @@
+// Package msgpack encodes values as MessagePack.
+package msgpack
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const ContentType = "application/msgpack"
+
+// Codec encodes values as MessagePack using "msgpack" struct tags, it may be registered in codecs.Codecs.
+type Codec struct{}
+
+func (Codec) ContentType() string {
+	return ContentType
+}
+
+func (Codec) Encode(value any) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (Codec) Decode(data []byte, value any) error {
+	return msgpack.Unmarshal(data, value)
+}
@@ -0,0 +1,15 @@
+module netshaper/codecs/protobuf
+
+go 1.21
+
+require (
+	google.golang.org/protobuf v1.33.0
+	netshaper v0.0.0
+)
+
+require (
+	github.com/coder/websocket v1.8.12 // indirect
+	golang.org/x/net v0.20.0 // indirect
+)
+
+replace netshaper => ../..
@@ -0,0 +1,40 @@
+// Package protobuf encodes protocol buffers messages in the binary wire format.
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const ContentType = "application/x-protobuf"
+
+var ErrNotMessage = errors.New("value is not a protobuf message")
+
+// Codec encodes values implementing proto.Message, it may be registered in codecs.Codecs.
+type Codec struct {
+	MarshalOptions   proto.MarshalOptions
+	UnmarshalOptions proto.UnmarshalOptions
+}
+
+func (c Codec) ContentType() string {
+	return ContentType
+}
+
+func (c Codec) Encode(value any) ([]byte, error) {
+	msg, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotMessage, value)
+	}
+
+	return c.MarshalOptions.Marshal(msg)
+}
+
+func (c Codec) Decode(data []byte, value any) error {
+	msg, ok := value.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotMessage, value)
+	}
+
+	return c.UnmarshalOptions.Unmarshal(data, msg)
+}
@@ -0,0 +1,55 @@
+package protobuf
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/codecs"
+	"netshaper/http"
+	"netshaper/test"
+	"testing"
+	"time"
+)
+
+func TestRequestHttp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the server echoes the request body
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, req *netHttp.Request) {
+		if got := req.Header.Get("Content-Type"); got != ContentType {
+			t.Errorf("server Content-Type got = %v, want %v", got, ContentType)
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		writer.Header().Set("Content-Type", "application/protobuf")
+		_, _ = writer.Write(body)
+	})
+	defer srv.Close()
+
+	cl, _ := netshaper.NewClient(ctx, http.NewNet())
+	defer cl.Close(ctx)
+
+	res, err := codecs.RequestHttp[wrapperspb.StringValue, wrapperspb.StringValue](ctx, cl, codecs.Codecs{Codec{}}, netHttp.MethodPost, url, nil, wrapperspb.String("hey"))
+	if err != nil {
+		t.Errorf("RequestHttp() error got = %v, want nil", err)
+		return
+	}
+
+	got, err := res.Value()
+	if err != nil {
+		t.Errorf("Value() error got = %v, want nil", err)
+	}
+	if !proto.Equal(got, wrapperspb.String("hey")) {
+		t.Errorf("Value() got = %v, want %v", got, "hey")
+	}
+}
+
+func TestCodecNotMessage(t *testing.T) {
+	if _, err := (Codec{}).Encode(&struct{}{}); err == nil {
+		t.Errorf("Encode() error got = nil, want %v", ErrNotMessage)
+	}
+}
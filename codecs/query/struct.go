@@ -0,0 +1,579 @@
+package query
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"netshaper/conf"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArrayStyle int
+
+const (
+	// ArrayRepeat repeats the key for every element: a=1&a=2.
+	ArrayRepeat ArrayStyle = iota
+	// ArrayComma joins elements with commas: a=1,2.
+	ArrayComma
+	// ArrayBrackets repeats the key with brackets: a[]=1&a[]=2.
+	ArrayBrackets
+)
+
+type NestingStyle int
+
+const (
+	// NestingDots joins keys of nested structs with dots: user.name=john.
+	NestingDots NestingStyle = iota
+	// NestingBrackets puts keys of nested structs in brackets: user[name]=john.
+	NestingBrackets
+)
+
+const (
+	tagName     = "query"
+	layoutTag   = "layout"
+	unixLayout  = "unix"
+	milliLayout = "unixmilli"
+)
+
+var ErrUnsupportedType = errors.New("unsupported query type")
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func WithArrayStyle(style ArrayStyle) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.ArrayStyle = style
+		return config
+	})
+}
+
+func WithNestingStyle(style NestingStyle) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.NestingStyle = style
+		return config
+	})
+}
+
+func WithTimeLayout(layout string) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.TimeLayout = layout
+		return config
+	})
+}
+
+// Config describes default styles of Encode and Decode, time.RFC3339 is the default time layout.
+//
+// Fields are named by the `query:"name,omitempty"` tag or by the field name, "-" skips a field. The "repeat", "comma"
+// and "brackets" tag options override the array style of a field. The `layout:"2006-01-02"` tag sets the time layout
+// of a field, "unix" and "unixmilli" layouts encode Unix seconds and milliseconds. Nil pointers are skipped; embedded
+// structs without a tag are flattened.
+type Config struct {
+	ArrayStyle   ArrayStyle
+	NestingStyle NestingStyle
+	TimeLayout   string
+}
+
+// Encode returns the query string of the struct v with keys sorted.
+func Encode(v any, opts ...conf.Option[Config]) (string, error) {
+	values, err := Values(v, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return values.Encode(), nil
+}
+
+// Values returns the query values of the struct v.
+func Values(v any, opts ...conf.Option[Config]) (url.Values, error) {
+	return conf.ApplyOptions(opts).Values(v)
+}
+
+// Decode parses the query string into the struct pointed by v.
+func Decode(query string, v any, opts ...conf.Option[Config]) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	return DecodeValues(values, v, opts...)
+}
+
+// DecodeValues sets fields of the struct pointed by v, fields without values are kept.
+func DecodeValues(values url.Values, v any, opts ...conf.Option[Config]) error {
+	return conf.ApplyOptions(opts).DecodeValues(values, v)
+}
+
+func (c Config) withDefaults() Config {
+	if c.TimeLayout == "" {
+		c.TimeLayout = time.RFC3339
+	}
+
+	return c
+}
+
+func (c Config) Values(v any) (url.Values, error) {
+	config := c.withDefaults()
+	values := url.Values{}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	if err := config.encodeStruct(values, "", rv); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (c Config) DecodeValues(values url.Values, v any) error {
+	config := c.withDefaults()
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+
+	return config.decodeStruct(values, "", rv.Elem())
+}
+
+type field struct {
+	name       string
+	omitEmpty  bool
+	arrayStyle ArrayStyle
+	layout     string
+	index      int
+	flatten    bool
+}
+
+func (c Config) fields(t reflect.Type) []field {
+	fields := make([]field, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup(tagName)
+		if tag == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+
+		f := field{name: sf.Name, arrayStyle: c.ArrayStyle, layout: c.TimeLayout, index: i}
+		if layout, ok := sf.Tag.Lookup(layoutTag); ok {
+			f.layout = layout
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name != "" {
+			f.name = name
+		}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "omitempty":
+				f.omitEmpty = true
+			case "repeat":
+				f.arrayStyle = ArrayRepeat
+			case "comma":
+				f.arrayStyle = ArrayComma
+			case "brackets":
+				f.arrayStyle = ArrayBrackets
+			}
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		f.flatten = sf.Anonymous && !tagged && ft.Kind() == reflect.Struct && !isScalar(ft)
+		if !sf.IsExported() && !f.flatten {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func (c Config) key(prefix string, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case c.NestingStyle == NestingBrackets:
+		return prefix + "[" + name + "]"
+	default:
+		return prefix + "." + name
+	}
+}
+
+func (c Config) encodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	for _, f := range c.fields(rv.Type()) {
+		fv := rv.Field(f.index)
+
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		fv, ok := deref(fv)
+		if !ok {
+			continue
+		}
+
+		if f.flatten {
+			if err := c.encodeStruct(values, prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := c.key(prefix, f.name)
+
+		switch {
+		case isScalar(fv.Type()):
+			s, err := formatScalar(fv, f.layout)
+			if err != nil {
+				return fmt.Errorf("invalid query param %v: %w", key, err)
+			}
+			values.Add(key, s)
+		case fv.Kind() == reflect.Struct:
+			if err := c.encodeStruct(values, key, fv); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+			if f.omitEmpty && fv.Len() == 0 {
+				continue
+			}
+
+			elements := make([]string, 0, fv.Len())
+			for i := 0; i < fv.Len(); i++ {
+				s, err := formatScalar(fv.Index(i), f.layout)
+				if err != nil {
+					return fmt.Errorf("invalid query param %v: %w", key, err)
+				}
+				elements = append(elements, s)
+			}
+
+			switch f.arrayStyle {
+			case ArrayComma:
+				values.Add(key, strings.Join(elements, ","))
+			case ArrayBrackets:
+				values[key+"[]"] = append(values[key+"[]"], elements...)
+			default:
+				values[key] = append(values[key], elements...)
+			}
+		default:
+			return fmt.Errorf("invalid query param %v: %w: %v", key, ErrUnsupportedType, fv.Type())
+		}
+	}
+
+	return nil
+}
+
+func (c Config) decodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	for _, f := range c.fields(rv.Type()) {
+		fv := rv.Field(f.index)
+		key := c.key(prefix, f.name)
+		if f.flatten {
+			key = prefix
+		}
+
+		ft := fv.Type()
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		var present bool
+		switch {
+		case f.flatten || (ft.Kind() == reflect.Struct && !isScalar(ft)):
+			present = c.hasNested(values, key)
+		case isScalar(ft) || (ft.Kind() != reflect.Slice && ft.Kind() != reflect.Array):
+			_, present = values[key]
+		case f.arrayStyle == ArrayBrackets:
+			_, present = values[key+"[]"]
+		default:
+			_, present = values[key]
+		}
+		if !present {
+			continue
+		}
+
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				if !fv.CanSet() {
+					// a nil pointer to an unexported embedded struct
+					continue
+				}
+				fv.Set(reflect.New(ft))
+			}
+			fv = fv.Elem()
+		}
+
+		var err error
+		switch {
+		case isScalar(ft):
+			err = parseScalar(fv, values.Get(key), f.layout)
+		case ft.Kind() == reflect.Struct:
+			err = c.decodeStruct(values, key, fv)
+		case ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array:
+			err = c.decodeSlice(fv, c.elements(values, key, f.arrayStyle), f.layout)
+		default:
+			err = fmt.Errorf("%w: %v", ErrUnsupportedType, ft)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid query param %v: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (c Config) elements(values url.Values, key string, style ArrayStyle) []string {
+	switch style {
+	case ArrayComma:
+		var elements []string
+		for _, value := range values[key] {
+			if value != "" {
+				elements = append(elements, strings.Split(value, ",")...)
+			}
+		}
+		return elements
+	case ArrayBrackets:
+		return values[key+"[]"]
+	default:
+		return values[key]
+	}
+}
+
+// decodeSlice sets elements of a slice, or of an array up to its length.
+func (c Config) decodeSlice(rv reflect.Value, elements []string, layout string) error {
+	target := rv
+	if rv.Kind() == reflect.Slice {
+		target = reflect.MakeSlice(rv.Type(), len(elements), len(elements))
+	} else if len(elements) > rv.Len() {
+		elements = elements[:rv.Len()]
+	}
+
+	for i, element := range elements {
+		if err := parseScalar(target.Index(i), element, layout); err != nil {
+			return err
+		}
+	}
+	rv.Set(target)
+
+	return nil
+}
+
+// hasNested reports whether there are values of the nested struct at the key.
+func (c Config) hasNested(values url.Values, key string) bool {
+	if key == "" {
+		return true
+	}
+
+	prefix := key + "."
+	if c.NestingStyle == NestingBrackets {
+		prefix = key + "["
+	}
+	for name := range values {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isScalar reports whether the type is encoded as a single value.
+func isScalar(t reflect.Type) bool {
+	if t == timeType || t == durationType || t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	default:
+		return false
+	}
+}
+
+// deref returns the value pointed by pointers and interfaces, false if one of them is nil.
+func deref(rv reflect.Value) (reflect.Value, bool) {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return rv, false
+		}
+		rv = rv.Elem()
+	}
+
+	return rv, true
+}
+
+func formatScalar(rv reflect.Value, layout string) (string, error) {
+	rv, ok := deref(rv)
+	if !ok {
+		return "", nil
+	}
+
+	switch rv.Type() {
+	case timeType:
+		return formatTime(rv.Interface().(time.Time), layout), nil
+	case durationType:
+		return time.Duration(rv.Int()).String(), nil
+	}
+
+	if marshaler, ok := textMarshaler(rv); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %v", ErrUnsupportedType, rv.Type())
+}
+
+// textMarshaler returns the value as encoding.TextMarshaler, also if MarshalText has a pointer receiver, e.g. big.Int.
+func textMarshaler(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	if rv.Type().Implements(textMarshalerType) {
+		return rv.Interface().(encoding.TextMarshaler), true
+	}
+	if !reflect.PointerTo(rv.Type()).Implements(textMarshalerType) {
+		return nil, false
+	}
+
+	if !rv.CanAddr() {
+		// fields of structs passed by value are copied
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		rv = ptr.Elem()
+	}
+
+	return rv.Addr().Interface().(encoding.TextMarshaler), true
+}
+
+func parseScalar(rv reflect.Value, s string, layout string) error {
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Type() {
+	case timeType:
+		t, err := parseTime(s, layout)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(d))
+		return nil
+	}
+
+	if rv.CanAddr() && rv.Addr().Type().Implements(textUnmarshalerType) {
+		return rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("%w: %v", ErrUnsupportedType, rv.Type())
+		}
+		rv.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedType, rv.Type())
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time, layout string) string {
+	switch layout {
+	case unixLayout:
+		return strconv.FormatInt(t.Unix(), 10)
+	case milliLayout:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.Format(layout)
+	}
+}
+
+func parseTime(s string, layout string) (time.Time, error) {
+	switch layout {
+	case unixLayout, milliLayout:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == unixLayout {
+			return time.Unix(i, 0), nil
+		}
+		return time.UnixMilli(i), nil
+	default:
+		return time.Parse(layout, s)
+	}
+}
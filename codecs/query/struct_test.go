@@ -0,0 +1,196 @@
+package query
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"netshaper/conf"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testPage struct {
+	Limit  uint8 `query:"limit,omitempty"`
+	Cursor *string
+}
+
+type testFilter struct {
+	testPage
+	Query    string        `query:"q"`
+	Tags     []string      `query:"tag"`
+	IDs      []int64       `query:"id,comma"`
+	Active   *bool         `query:"active"`
+	Ratio    float32       `query:"ratio,omitempty"`
+	Since    time.Time     `query:"since" layout:"2006-01-02"`
+	Until    time.Time     `query:"until,omitempty" layout:"unix"`
+	Timeout  time.Duration `query:"timeout"`
+	IP       net.IP        `query:"ip,omitempty"`
+	Owner    testOwner     `query:"owner"`
+	Amount   *big.Int      `query:"amount,omitempty"`
+	Internal string        `query:"-"`
+	hidden   string
+}
+
+type testOwner struct {
+	Name string `query:"name"`
+	Age  int    `query:"age,omitempty"`
+}
+
+func TestEncode(t *testing.T) {
+	active := true
+	cursor := "abc"
+
+	tests := []struct {
+		name    string
+		value   any
+		opts    []conf.Option[Config]
+		want    string
+		wantErr error
+	}{
+		{
+			name: "all types",
+			value: &testFilter{
+				testPage: testPage{Limit: 10, Cursor: &cursor},
+				Query:    "a b",
+				Tags:     []string{"x", "y"},
+				IDs:      []int64{1, 2},
+				Active:   &active,
+				Ratio:    0.5,
+				Since:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Until:    time.Unix(1700000000, 0),
+				Timeout:  90 * time.Second,
+				IP:       net.IPv4(10, 0, 0, 1),
+				Owner:    testOwner{Name: "john", Age: 30},
+				Amount:   big.NewInt(12345678901234567),
+				Internal: "internal",
+				hidden:   "hidden",
+			},
+			want: "Cursor=abc&active=true&amount=12345678901234567&id=1%2C2&ip=10.0.0.1&limit=10&owner.age=30&owner.name=john&q=a+b&ratio=0.5&since=2024-01-02&tag=x&tag=y&timeout=1m30s&until=1700000000",
+		},
+		{
+			name:  "empty",
+			value: testFilter{},
+			want:  "id=&owner.name=&q=&since=0001-01-01&timeout=0s",
+		},
+		{
+			name:  "brackets",
+			value: testFilter{Tags: []string{"x", "y"}, Owner: testOwner{Name: "john"}},
+			opts:  []conf.Option[Config]{WithArrayStyle(ArrayBrackets), WithNestingStyle(NestingBrackets)},
+			want:  "id=&owner%5Bname%5D=john&q=&since=0001-01-01&tag%5B%5D=x&tag%5B%5D=y&timeout=0s",
+		},
+		{
+			name:  "pointer receiver text marshaler by value",
+			value: struct{ Amount big.Int }{Amount: *big.NewInt(42)},
+			want:  "Amount=42",
+		},
+		{
+			name:  "nil",
+			value: (*testFilter)(nil),
+			want:  "",
+		},
+		{
+			name:    "not a struct",
+			value:   42,
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name:    "unsupported field",
+			value:   struct{ Fn func() }{Fn: func() {}},
+			wantErr: ErrUnsupportedType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.value, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Encode() error got = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	active := true
+	cursor := "abc"
+
+	tests := []struct {
+		name    string
+		query   string
+		opts    []conf.Option[Config]
+		want    testFilter
+		wantErr bool
+	}{
+		{
+			name:  "all types",
+			query: "Cursor=abc&active=true&amount=12345678901234567&id=1%2C2&ip=10.0.0.1&limit=10&owner.age=30&owner.name=john&q=a+b&ratio=0.5&since=2024-01-02&tag=x&tag=y&timeout=1m30s&until=1700000000&Internal=x&hidden=x",
+			want: testFilter{
+				testPage: testPage{Limit: 10, Cursor: &cursor},
+				Query:    "a b",
+				Tags:     []string{"x", "y"},
+				IDs:      []int64{1, 2},
+				Active:   &active,
+				Ratio:    0.5,
+				Since:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				Until:    time.Unix(1700000000, 0),
+				Timeout:  90 * time.Second,
+				IP:       net.IPv4(10, 0, 0, 1),
+				Owner:    testOwner{Name: "john", Age: 30},
+				Amount:   big.NewInt(12345678901234567),
+			},
+		},
+		{
+			name:  "brackets",
+			query: "tag[]=x&tag[]=y&owner[name]=john",
+			opts:  []conf.Option[Config]{WithArrayStyle(ArrayBrackets), WithNestingStyle(NestingBrackets)},
+			want:  testFilter{Tags: []string{"x", "y"}, Owner: testOwner{Name: "john"}},
+		},
+		{
+			name:    "invalid number",
+			query:   "limit=300",
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			query:   "since=yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testFilter
+			err := Decode(tt.query, &got, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error got = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// times are compared by instant, locations differ
+			if !got.Until.Equal(tt.want.Until) {
+				t.Errorf("Decode() until got = %v, want %v", got.Until, tt.want.Until)
+			}
+			got.Until, tt.want.Until = time.Time{}, time.Time{}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeQueryMultiParamsNoEscape(t *testing.T) {
+	got, err := EncodeQueryMultiParamsNoEscape(map[string][]any{"b": {2, true}, "a": {1.5}, "c": {"x y"}})
+	if err != nil {
+		t.Errorf("EncodeQueryMultiParamsNoEscape() error got = %v, want nil", err)
+	}
+	if want := "a=1.5&b=2&b=true&c=x y"; got != want {
+		t.Errorf("EncodeQueryMultiParamsNoEscape() got = %v, want %v", got, want)
+	}
+}
@@ -3,8 +3,10 @@ package query
 import (
 	"fmt"
 	"net/url"
-	"strconv"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 func EncodeQueryMultiParams(params map[string][]any) (string, error) {
@@ -27,9 +29,15 @@ func EncodeQueryMultiParams(params map[string][]any) (string, error) {
 func EncodeQueryMultiParamsNoEscape(params map[string][]any) (string, error) {
 	ss := strings.Builder{}
 
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	i := 0
-	for key, values := range params {
-		for _, value := range values {
+	for _, key := range keys {
+		for _, value := range params[key] {
 			s, err := encodeQueryParamValue(value)
 			if err != nil {
 				return ss.String(), err
@@ -59,16 +67,12 @@ func EncodeQueryParamsNoEscape(params map[string]any) (string, error) {
 }
 
 func encodeQueryParamValue(value any) (s string, err error) {
-	switch value.(type) {
-	case int:
-		s = strconv.Itoa(value.(int))
-	case string:
-		s = value.(string)
-	default:
-		err = fmt.Errorf("unsupported query params type %T: %#v", value, value)
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || !isScalar(rv.Type()) {
+		return "", fmt.Errorf("unsupported query params type %T: %#v", value, value)
 	}
 
-	return
+	return formatScalar(rv, time.RFC3339)
 }
 
 func toMultiParams(params map[string]any) (multiParams map[string][]any) {
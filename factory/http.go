@@ -18,7 +18,7 @@ func DefaultHttp(ctx context.Context) (http.Client, error) {
 		PostProcessors:       nil,
 		RetryOnStatusCodes:   []int{429},
 		InitialRetryDelay:    1 * time.Second,
-		RetryDelayMultiplier: 2 * time.Second,
+		RetryDelayMultiplier: 2,
 		MaxRetryDelay:        1 * time.Minute,
 		MaxRetriesLimit:      10,
 	})
@@ -34,6 +34,13 @@ func NewNetHttp(ctx context.Context, cfg NetHttpConfig) (http.Client, error) {
 		decorators = append(decorators, p)
 	}
 
+	rateLimiter := options.WithRequestPerSecondLimiter[*http.Request, *http.Response](cfg.MaxRps)
+	if cfg.AdaptiveRateLimit {
+		rateLimiter = options.WithAdaptiveRateLimiter[*http.Request](
+			options.WithAdaptiveRateBounds(0, cfg.MaxRps),
+		)
+	}
+
 	return netshaper.NewClient(ctx,
 		http.NewNet(
 			http.WithNetTransport(cfg.Transport),
@@ -44,11 +51,12 @@ func NewNetHttp(ctx context.Context, cfg NetHttpConfig) (http.Client, error) {
 		options.WithPool(
 			options.WithPoolSize[*http.Request, *http.Response](cfg.PoolSize),
 		),
-		options.WithRequestPerSecondLimiter[*http.Request, *http.Response](cfg.MaxRps),
+		rateLimiter,
 		options.WithDecorators[*http.Request, *http.Response](decorators...),
-		options.WithCircuitBreaker(
-			options.WithExponentialDelayRetries[*http.Request, *http.Response](cfg.InitialRetryDelay, cfg.RetryDelayMultiplier, cfg.MaxRetryDelay),
-			options.WithMaxRetriesLimit[*http.Request, *http.Response](cfg.MaxRetriesLimit),
+		options.WithRetry(
+			options.WithRetryMaxAttempts[*http.Request, *http.Response](cfg.MaxRetriesLimit+1),
+			options.WithRetryBackoff[*http.Request, *http.Response](cfg.InitialRetryDelay, cfg.RetryDelayMultiplier, cfg.MaxRetryDelay),
+			options.WithRetryJitter[*http.Request, *http.Response](cfg.RetryJitter),
 		),
 	)
 }
@@ -60,11 +68,13 @@ type NetHttpConfig struct {
 	Timeout              time.Duration
 	PoolSize             uint
 	MaxRps               float64
+	AdaptiveRateLimit    bool
 	PreProcessors        []options.PreProcessingFunc[*http.Request, *http.Response]
 	PostProcessors       []options.PreProcessingFunc[*http.Request, *http.Response]
 	RetryOnStatusCodes   []int
 	InitialRetryDelay    time.Duration
-	RetryDelayMultiplier time.Duration
+	RetryDelayMultiplier float64
 	MaxRetryDelay        time.Duration
 	MaxRetriesLimit      uint
+	RetryJitter          options.Jitter
 }
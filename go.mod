@@ -1,5 +1,8 @@
 module netshaper
 
-go 1.20
+go 1.21
 
-require golang.org/x/net v0.9.0
+require (
+	github.com/coder/websocket v1.8.12
+	golang.org/x/net v0.20.0
+)
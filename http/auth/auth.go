@@ -0,0 +1,133 @@
+// Package auth authorizes HTTP requests with static credentials or OAuth2 tokens.
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	netHttp "net/http"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/options"
+)
+
+const maxDiscardedBodySize = 64 << 10
+
+// WithAuth authorizes every request with the provider. If the provider is an Invalidator, a request rejected with
+// 401 Unauthorized is invalidated and sent once again with new credentials, unless its body can not be rewound.
+func WithAuth(provider Provider) conf.Option[http.Config] {
+	if provider == nil {
+		return nil
+	}
+
+	return options.WithInterceptors[*http.Request, *http.Response](NewInterceptor(provider))
+}
+
+// WithOAuth2ClientCredentials authorizes requests with cached client credentials tokens.
+func WithOAuth2ClientCredentials(config ClientCredentialsConfig, opts ...conf.Option[TokenProviderConfig]) conf.Option[http.Config] {
+	return WithAuth(NewTokenProvider(NewClientCredentials(config), opts...))
+}
+
+// WithOAuth2RefreshToken authorizes requests with cached tokens obtained with the refresh token.
+func WithOAuth2RefreshToken(config RefreshTokenConfig, opts ...conf.Option[TokenProviderConfig]) conf.Option[http.Config] {
+	return WithAuth(NewTokenProvider(NewRefreshToken(config), opts...))
+}
+
+// Provider sets credentials of a request. Implementations must be safe for concurrent use.
+type Provider interface {
+	Authorize(req *http.Request) error
+}
+
+// Invalidator is a Provider whose credentials may expire before the server rejects them. Invalidate receives the
+// rejected request, so the next Authorize call gets new credentials.
+type Invalidator interface {
+	Invalidate(req *http.Request)
+}
+
+type ProviderFunc func(req *http.Request) error
+
+func (fn ProviderFunc) Authorize(req *http.Request) error {
+	return fn(req)
+}
+
+func Bearer(token string) Provider {
+	return Header("Authorization", "Bearer "+token)
+}
+
+func Basic(username string, password string) Provider {
+	return Header("Authorization", "Basic "+basicCredentials(username, password))
+}
+
+// APIKey sets the key to the header, e.g. "X-Api-Key".
+func APIKey(header string, key string) Provider {
+	return Header(header, key)
+}
+
+func Header(name string, value string) Provider {
+	return ProviderFunc(func(req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	})
+}
+
+func basicCredentials(username string, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// NewInterceptor returns the interceptor used by WithAuth, so it may be combined with other interceptors.
+func NewInterceptor(provider Provider) options.Interceptor[*http.Request, *http.Response] {
+	return &interceptor{provider}
+}
+
+type interceptor struct {
+	provider Provider
+}
+
+func (i *interceptor) Intercept(req *http.Request, next func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	authorized, rewindable, err := i.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := next(authorized)
+	if err != nil || res == nil || res.StatusCode != netHttp.StatusUnauthorized {
+		return res, err
+	}
+
+	invalidator, ok := i.provider.(Invalidator)
+	if !ok || !rewindable {
+		return res, err
+	}
+
+	invalidator.Invalidate(authorized)
+
+	retry, _, retryErr := i.authorize(req)
+	if retryErr != nil {
+		// keep the 401 response, it explains the failure better than the authorization error
+		return res, err
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxDiscardedBodySize))
+	_ = res.Body.Close()
+
+	return next(retry)
+}
+
+// authorize authorizes a copy of the request, so the original one may be authorized once again.
+func (i *interceptor) authorize(req *http.Request) (authorized *http.Request, rewindable bool, err error) {
+	authorized, err = http.CloneRequest(req.Context(), req)
+	rewindable = err == nil
+	if err != nil {
+		authorized = req.Clone(req.Context())
+	}
+
+	if authorized.Header == nil {
+		authorized.Header = netHttp.Header{}
+	}
+
+	if err = i.provider.Authorize(authorized); err != nil {
+		return nil, false, fmt.Errorf("failed to authorize request: %w", err)
+	}
+
+	return authorized, rewindable, nil
+}
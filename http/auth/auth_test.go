@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/http"
+	"netshaper/test"
+	"netshaper/timer"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) timer.Timer {
+	return timer.System.NewTimer(d)
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// newTokenServer issues tokens "token-1", "token-2"... valid for expiresIn seconds.
+func newTokenServer(t *testing.T, expiresIn int, check func(req *netHttp.Request) error) (url netshaper.URL, issued *atomic.Int32, closeFn func()) {
+	issued = &atomic.Int32{}
+
+	url, srv := test.NewHttpHandlerFunc("/token", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		if err := request.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error got = %v, want nil", err)
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if check != nil {
+			if err := check(request); err != nil {
+				writer.WriteHeader(netHttp.StatusBadRequest)
+				_, _ = fmt.Fprintf(writer, `{"error":"invalid_request","error_description":%q}`, err.Error())
+				return
+			}
+		}
+
+		n := issued.Add(1)
+		_, _ = fmt.Fprintf(writer, `{"access_token":"token-%v","token_type":"bearer","expires_in":%v,"refresh_token":"refresh-%v"}`, n, expiresIn, n)
+	})
+
+	return url, issued, srv.Close
+}
+
+// newApiServer accepts requests with the accepted authorization and returns their bodies.
+func newApiServer(accepted func(authorization string) bool) (netshaper.URL, func()) {
+	url, srv := test.NewHttpHandlerFunc("/api", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		if !accepted(request.Header.Get("Authorization")) {
+			writer.WriteHeader(netHttp.StatusUnauthorized)
+			return
+		}
+
+		body, _ := io.ReadAll(request.Body)
+		_, _ = writer.Write(body)
+	})
+
+	return url, srv.Close
+}
+
+func TestStaticProviders(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		header   string
+		want     string
+	}{
+		{name: "bearer", provider: Bearer("secret"), header: "Authorization", want: "Bearer secret"},
+		{name: "basic", provider: Basic("user", "pass"), header: "Authorization", want: "Basic dXNlcjpwYXNz"},
+		{name: "api key", provider: APIKey("X-Api-Key", "secret"), header: "X-Api-Key", want: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			var got string
+			url, srv := test.NewHttpHandlerFunc("/", func(_ netHttp.ResponseWriter, request *netHttp.Request) {
+				got = request.Header.Get(tt.header)
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.NewClient(ctx, http.NewNet(), WithAuth(tt.provider))
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			req, _ := http.NewGetRequest(ctx, url, nil)
+			if _, err = cl.Request(req); err != nil {
+				t.Errorf("Request() error got = %v, want nil", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("%v header got = %v, want %v", tt.header, got, tt.want)
+			}
+			if req.Header.Get(tt.header) != "" {
+				t.Errorf("original request %v header got = %v, want empty", tt.header, req.Header.Get(tt.header))
+			}
+		})
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tokenURL, issued, closeTokenServer := newTokenServer(t, 3600, func(req *netHttp.Request) error {
+		if user, pass, _ := req.BasicAuth(); user != "client" || pass != "secret" {
+			return errors.New("invalid client credentials")
+		}
+		if got := req.PostForm.Get("grant_type"); got != "client_credentials" {
+			return fmt.Errorf("invalid grant type %v", got)
+		}
+		if got := req.PostForm.Get("scope"); got != "read write" {
+			return fmt.Errorf("invalid scope %v", got)
+		}
+		return nil
+	})
+	defer closeTokenServer()
+
+	apiURL, closeApiServer := newApiServer(func(authorization string) bool {
+		return authorization == "Bearer token-1"
+	})
+	defer closeApiServer()
+
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(),
+		WithOAuth2ClientCredentials(ClientCredentialsConfig{
+			Endpoint: Endpoint{TokenURL: tokenURL.String(), ClientID: "client", ClientSecret: "secret"},
+			Scopes:   []string{"read", "write"},
+		}),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, _ := http.NewGetRequest(ctx, apiURL, nil)
+			res, err := cl.Request(req)
+			if err != nil || res.StatusCode != netHttp.StatusOK {
+				t.Errorf("Request() got = %v, %v, want 200 OK", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := issued.Load(); got != 1 {
+		t.Errorf("issued tokens got = %v, want %v", got, 1)
+	}
+}
+
+func TestRetryOnUnauthorized(t *testing.T) {
+	tests := []struct {
+		name       string
+		accepted   string
+		body       []byte
+		wantStatus int
+		wantIssued int32
+	}{
+		{name: "retried with a new token", accepted: "Bearer token-2", body: []byte("hey"), wantStatus: netHttp.StatusOK, wantIssued: 2},
+		{name: "retried once", accepted: "Bearer token-3", body: []byte("hey"), wantStatus: netHttp.StatusUnauthorized, wantIssued: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			tokenURL, issued, closeTokenServer := newTokenServer(t, 3600, nil)
+			defer closeTokenServer()
+
+			apiURL, closeApiServer := newApiServer(func(authorization string) bool {
+				return authorization == tt.accepted
+			})
+			defer closeApiServer()
+
+			cl, err := netshaper.NewClient(ctx,
+				http.NewNet(),
+				WithOAuth2ClientCredentials(ClientCredentialsConfig{
+					Endpoint: Endpoint{TokenURL: tokenURL.String(), ClientID: "client", AuthStyle: AuthStyleParams},
+				}),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			req, _ := http.NewPostRequest(ctx, apiURL, nil, tt.body)
+			res, err := cl.Request(req)
+			if err != nil {
+				t.Errorf("Request() error got = %v, want nil", err)
+				return
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("Request() status got = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if res.StatusCode == netHttp.StatusOK && string(body) != string(tt.body) {
+				t.Errorf("Request() body got = %v, want %v", string(body), string(tt.body))
+			}
+			if got := issued.Load(); got != tt.wantIssued {
+				t.Errorf("issued tokens got = %v, want %v", got, tt.wantIssued)
+			}
+		})
+	}
+}
+
+func TestTokenProviderRefresh(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var issued atomic.Int32
+	release := make(chan struct{}, 10)
+	provider := NewTokenProvider(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		n := issued.Add(1)
+		if n > 1 {
+			<-release
+		}
+		return &Token{AccessToken: fmt.Sprintf("token-%v", n), Expiry: clock.Now().Add(time.Minute)}, nil
+	}), WithRefreshBefore(10*time.Second), WithClock(clock))
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		release bool
+		want    string
+	}{
+		{name: "first token", want: "token-1"},
+		{name: "cached token", advance: 40 * time.Second, want: "token-1"},
+		{name: "cached token while refreshing", advance: 15 * time.Second, want: "token-1"},
+		{name: "refreshed token after expiry", advance: 10 * time.Second, release: true, want: "token-2"},
+	}
+
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		if step.release {
+			release <- struct{}{}
+		}
+
+		token, err := provider.Token(ctx)
+		if err != nil {
+			t.Errorf("%v: Token() error got = %v, want nil", step.name, err)
+			continue
+		}
+		if token.AccessToken != step.want {
+			t.Errorf("%v: Token() got = %v, want %v", step.name, token.AccessToken, step.want)
+		}
+	}
+
+	if got := issued.Load(); got != 2 {
+		t.Errorf("issued tokens got = %v, want %v", got, 2)
+	}
+}
+
+func TestTokenProviderRefreshBackoff(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	errFailed := errors.New("failed")
+
+	var calls atomic.Int32
+	provider := NewTokenProvider(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		if calls.Add(1) > 1 {
+			return nil, errFailed
+		}
+		return &Token{AccessToken: "token-1", Expiry: clock.Now().Add(time.Minute)}, nil
+	}), WithRefreshBefore(10*time.Second), WithClock(clock))
+
+	// waits for the background refresh started by the call
+	getToken := func() {
+		if token, err := provider.Token(ctx); err != nil || token.AccessToken != "token-1" {
+			t.Errorf("Token() got = %v (%v), want %v", token, err, "token-1")
+		}
+
+		provider.mu.Lock()
+		refreshing := provider.refreshing
+		provider.mu.Unlock()
+		if refreshing != nil {
+			<-refreshing
+		}
+	}
+
+	getToken()
+	clock.Advance(55 * time.Second)
+	getToken()
+	getToken()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("source calls after failed refresh got = %v, want %v", got, 2)
+	}
+
+	clock.Advance(3 * time.Second)
+	getToken()
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("source calls after backoff got = %v, want %v", got, 3)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var refreshTokens []string
+	tokenURL, _, closeTokenServer := newTokenServer(t, 3600, func(req *netHttp.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		refreshTokens = append(refreshTokens, req.PostForm.Get("refresh_token"))
+		return nil
+	})
+	defer closeTokenServer()
+
+	source := NewRefreshToken(RefreshTokenConfig{
+		Endpoint:     Endpoint{TokenURL: tokenURL.String(), ClientID: "client"},
+		RefreshToken: "initial",
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := source.Token(ctx); err != nil {
+			t.Errorf("Token() error got = %v, want nil", err)
+		}
+	}
+
+	want := []string{"initial", "refresh-1"}
+	if fmt.Sprint(refreshTokens) != fmt.Sprint(want) {
+		t.Errorf("refresh tokens got = %v, want %v", refreshTokens, want)
+	}
+}
+
+func TestTokenError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	tokenURL, _, closeTokenServer := newTokenServer(t, 3600, func(req *netHttp.Request) error {
+		return errors.New("unknown client")
+	})
+	defer closeTokenServer()
+
+	apiURL, closeApiServer := newApiServer(func(string) bool { return true })
+	defer closeApiServer()
+
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(),
+		WithOAuth2ClientCredentials(ClientCredentialsConfig{Endpoint: Endpoint{TokenURL: tokenURL.String()}}),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	req, _ := http.NewGetRequest(ctx, apiURL, nil)
+	_, err = cl.Request(req)
+
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) {
+		t.Errorf("Request() error got = %v, want %T", err, tokenErr)
+		return
+	}
+
+	want := TokenError{StatusCode: netHttp.StatusBadRequest, Code: "invalid_request", Description: "unknown client"}
+	if *tokenErr != want {
+		t.Errorf("Request() error got = %v, want %v", *tokenErr, want)
+	}
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	netHttp "net/http"
+	"net/url"
+	"netshaper"
+	"netshaper/http"
+	"netshaper/timer"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxTokenResponseSize = 1 << 20
+
+type AuthStyle int
+
+const (
+	// AuthStyleHeader sends client credentials with HTTP Basic authentication.
+	AuthStyleHeader AuthStyle = iota
+	// AuthStyleParams sends client credentials as client_id and client_secret form parameters.
+	AuthStyleParams
+)
+
+// Endpoint describes an OAuth2 token endpoint. The default net/http client is used if Client is nil.
+type Endpoint struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	AuthStyle    AuthStyle
+	Client       http.Client
+	Clock        timer.Clock
+}
+
+type ClientCredentialsConfig struct {
+	Endpoint
+	Scopes []string
+	Params url.Values
+}
+
+func NewClientCredentials(config ClientCredentialsConfig) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		params := url.Values{"grant_type": {"client_credentials"}}
+		if len(config.Scopes) > 0 {
+			params.Set("scope", strings.Join(config.Scopes, " "))
+		}
+		for name, values := range config.Params {
+			params[name] = values
+		}
+
+		return config.Endpoint.exchange(ctx, params)
+	})
+}
+
+// RefreshTokenConfig describes the refresh token grant. The refresh token is replaced if the server rotates it.
+type RefreshTokenConfig struct {
+	Endpoint
+	RefreshToken string
+	Scopes       []string
+}
+
+func NewRefreshToken(config RefreshTokenConfig) TokenSource {
+	var mu sync.Mutex
+	refreshToken := config.RefreshToken
+
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		params := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+		if len(config.Scopes) > 0 {
+			params.Set("scope", strings.Join(config.Scopes, " "))
+		}
+
+		token, err := config.Endpoint.exchange(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.RefreshToken == "" {
+			token.RefreshToken = refreshToken
+		}
+		refreshToken = token.RefreshToken
+
+		return token, nil
+	})
+}
+
+// TokenError is returned if the token endpoint rejects the request, Code is the OAuth2 error code if the server
+// returned one, e.g. "invalid_client".
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *TokenError) Error() string {
+	msg := fmt.Sprintf("token endpoint returned status code %v", e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+
+	return msg
+}
+
+type tokenResponse struct {
+	AccessToken      string          `json:"access_token"`
+	TokenType        string          `json:"token_type"`
+	RefreshToken     string          `json:"refresh_token"`
+	ExpiresIn        json.RawMessage `json:"expires_in"`
+	Error            string          `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+func (e *Endpoint) exchange(ctx context.Context, params url.Values) (*Token, error) {
+	u, err := netshaper.ParseURL(e.TokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token url: %w", err)
+	}
+
+	headers := netshaper.Headers{
+		"Content-Type": {"application/x-www-form-urlencoded"},
+		"Accept":       {"application/json"},
+	}
+
+	switch e.AuthStyle {
+	case AuthStyleParams:
+		params.Set("client_id", e.ClientID)
+		if e.ClientSecret != "" {
+			params.Set("client_secret", e.ClientSecret)
+		}
+	default:
+		headers.Set("Authorization", "Basic "+basicCredentials(url.QueryEscape(e.ClientID), url.QueryEscape(e.ClientSecret)))
+	}
+
+	req, err := http.NewPostRequest(ctx, *u, headers, []byte(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	now := timer.OrSystem(e.Clock).Now()
+
+	res, err := e.request(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxTokenResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var data tokenResponse
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" || mediaType == "text/plain" {
+		data = parseFormTokenResponse(body)
+	} else if err = json.Unmarshal(body, &data); err != nil && res.StatusCode < 300 {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 || data.Error != "" {
+		return nil, &TokenError{StatusCode: res.StatusCode, Code: data.Error, Description: data.ErrorDescription}
+	}
+	if data.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+
+	token := &Token{
+		AccessToken:  data.AccessToken,
+		TokenType:    data.TokenType,
+		RefreshToken: data.RefreshToken,
+	}
+	if expiresIn := parseExpiresIn(data.ExpiresIn); expiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (e *Endpoint) request(req *http.Request) (*http.Response, error) {
+	if e.Client != nil {
+		return e.Client.Request(req)
+	}
+
+	return netHttp.DefaultClient.Do(req)
+}
+
+func parseFormTokenResponse(body []byte) tokenResponse {
+	values, _ := url.ParseQuery(string(body))
+
+	return tokenResponse{
+		AccessToken:      values.Get("access_token"),
+		TokenType:        values.Get("token_type"),
+		RefreshToken:     values.Get("refresh_token"),
+		ExpiresIn:        json.RawMessage(values.Get("expires_in")),
+		Error:            values.Get("error"),
+		ErrorDescription: values.Get("error_description"),
+	}
+}
+
+// parseExpiresIn accepts both numbers and strings, some servers send the latter.
+func parseExpiresIn(raw json.RawMessage) int64 {
+	value := strings.Trim(string(raw), `"`)
+	if value == "" {
+		return 0
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return seconds
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/timer"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultRefreshBefore = 30 * time.Second
+
+var ErrNoToken = errors.New("no access token")
+
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is zero if the token does not expire.
+	Expiry time.Time
+}
+
+// Type returns the token type for the Authorization header, "Bearer" by default.
+func (t *Token) Type() string {
+	switch {
+	case t.TokenType == "", strings.EqualFold(t.TokenType, "bearer"):
+		return "Bearer"
+	case strings.EqualFold(t.TokenType, "mac"):
+		return "MAC"
+	case strings.EqualFold(t.TokenType, "basic"):
+		return "Basic"
+	default:
+		return t.TokenType
+	}
+}
+
+// TokenSource obtains a new token on every call. Implementations must be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (fn TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return fn(ctx)
+}
+
+func WithRefreshBefore(d time.Duration) conf.Option[TokenProviderConfig] {
+	return conf.OptionFunc[TokenProviderConfig](func(config TokenProviderConfig) TokenProviderConfig {
+		config.RefreshBefore = d
+		return config
+	})
+}
+
+func WithClock(clock timer.Clock) conf.Option[TokenProviderConfig] {
+	return conf.OptionFunc[TokenProviderConfig](func(config TokenProviderConfig) TokenProviderConfig {
+		config.Clock = clock
+		return config
+	})
+}
+
+// TokenProviderConfig describes token caching. A token is refreshed in background RefreshBefore its expiry (or in the
+// second half of its lifetime if it is shorter); if the refresh fails, the cached token is used until it expires and the
+// refresh is retried after min(RefreshBefore/4, remaining lifetime/2).
+type TokenProviderConfig struct {
+	RefreshBefore time.Duration
+	Clock         timer.Clock
+}
+
+func NewTokenProvider(source TokenSource, opts ...conf.Option[TokenProviderConfig]) *TokenProvider {
+	config := conf.ApplyOptions(opts)
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = DefaultRefreshBefore
+	}
+	config.Clock = timer.OrSystem(config.Clock)
+
+	return &TokenProvider{source: source, config: config}
+}
+
+var _ Provider = (*TokenProvider)(nil)
+var _ Invalidator = (*TokenProvider)(nil)
+
+// TokenProvider caches tokens of the source. Concurrent requests wait for a single refresh.
+type TokenProvider struct {
+	source     TokenSource
+	config     TokenProviderConfig
+	mu         sync.Mutex
+	token      *Token
+	refreshAt  time.Time
+	refreshing chan struct{}
+	refreshErr error
+}
+
+func (p *TokenProvider) Authorize(req *http.Request) error {
+	token, err := p.Token(req.Context())
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+
+	return nil
+}
+
+// Invalidate drops the cached token if it was used to authorize the request.
+func (p *TokenProvider) Invalidate(req *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != nil && req.Header.Get("Authorization") == p.token.Type()+" "+p.token.AccessToken {
+		p.token = nil
+	}
+}
+
+// Token returns the cached token or waits for a new one.
+func (p *TokenProvider) Token(ctx context.Context) (*Token, error) {
+	for {
+		p.mu.Lock()
+		now := p.config.Clock.Now()
+		token := p.token
+
+		if token != nil && (p.refreshAt.IsZero() || now.Before(p.refreshAt)) {
+			p.mu.Unlock()
+			return token, nil
+		}
+
+		refreshing := p.refreshing
+		if refreshing == nil {
+			refreshing = make(chan struct{})
+			p.refreshing = refreshing
+			go p.refresh(ctx, refreshing)
+		}
+		p.mu.Unlock()
+
+		if token != nil && p.valid(token, now) {
+			// refreshed proactively - the cached token is still valid
+			return token, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-refreshing:
+		}
+
+		p.mu.Lock()
+		token, err := p.token, p.refreshErr
+		p.mu.Unlock()
+
+		if err != nil && (token == nil || !p.valid(token, p.config.Clock.Now())) {
+			return nil, err
+		}
+		if token != nil {
+			return token, nil
+		}
+		// the token was invalidated right after the refresh - refresh again
+	}
+}
+
+// refresh keeps values of the request context, but not its cancellation: the refresh is shared by concurrent requests,
+// so it must not fail because the request which started it was cancelled.
+func (p *TokenProvider) refresh(ctx context.Context, done chan struct{}) {
+	token, err := p.source.Token(context.WithoutCancel(ctx))
+	if err == nil && (token == nil || token.AccessToken == "") {
+		token, err = nil, ErrNoToken
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.config.Clock.Now()
+	if err == nil {
+		p.token = token
+		p.refreshAt = time.Time{}
+
+		if !token.Expiry.IsZero() {
+			before := p.config.RefreshBefore
+			if lifetime := token.Expiry.Sub(now); lifetime < 2*before {
+				before = lifetime / 2
+			}
+			p.refreshAt = token.Expiry.Add(-before)
+		}
+	} else if p.token != nil && !p.token.Expiry.IsZero() && p.valid(p.token, now) {
+		// the cached token is used meanwhile, so the refresh is retried after a backoff instead of on every call
+		p.refreshAt = now.Add(min(p.config.RefreshBefore/4, p.token.Expiry.Sub(now)/2))
+	}
+	p.refreshErr = err
+	p.refreshing = nil
+	close(done)
+}
+
+func (p *TokenProvider) valid(token *Token, now time.Time) bool {
+	return token.Expiry.IsZero() || now.Before(token.Expiry)
+}
@@ -0,0 +1,629 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	netHttp "net/http"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/timer"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxBodySize         = int64(10 << 20)
+	DefaultRevalidationTimeout = 30 * time.Second
+
+	// StatusHeader is set on responses passed through the cache.
+	StatusHeader = "X-Cache-Status"
+)
+
+type Status string
+
+const (
+	StatusMiss        Status = "MISS"
+	StatusHit         Status = "HIT"
+	StatusRevalidated Status = "REVALIDATED"
+	// StatusStale is a stored response served without successful validation (max-stale, stale-while-revalidate or
+	// stale-if-error).
+	StatusStale Status = "STALE"
+)
+
+// StatusOf returns the cache status of the response, it is empty for requests that bypassed the cache.
+func StatusOf(res *http.Response) Status {
+	if res == nil {
+		return ""
+	}
+
+	return Status(res.Header.Get(StatusHeader))
+}
+
+func WithCache(opts ...conf.Option[Config]) conf.Option[http.Config] {
+	return conf.OptionFunc[http.Config](func(config http.Config) http.Config {
+		cfg := conf.ApplyOptionsInit(opts, Config{Inner: config})
+		return &cfg
+	})
+}
+
+// WithStorage sets the storage of entries, it may be shared between clients. A memory storage of
+// DefaultMemoryStorageSize is created for each client by default.
+func WithStorage(storage Storage) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Storage = storage
+		return config
+	})
+}
+
+// WithMaxBodySize sets the max size of a response body to store, larger responses are passed as is.
+func WithMaxBodySize(size int64) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.MaxBodySize = size
+		return config
+	})
+}
+
+func WithRevalidationTimeout(timeout time.Duration) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.RevalidationTimeout = timeout
+		return config
+	})
+}
+
+func WithClock(clock timer.Clock) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Clock = clock
+		return config
+	})
+}
+
+var _ http.Config = (*Config)(nil)
+
+// Config describes a private HTTP cache (RFC 9111). GET responses are stored and served while fresh, stale responses
+// are revalidated with conditional requests. Unsafe requests invalidate stored responses of their URL. Storage errors
+// are treated as cache misses.
+type Config struct {
+	Inner       http.Config
+	Storage     Storage
+	MaxBodySize int64
+	// RevalidationTimeout limits background revalidations of responses served with stale-while-revalidate.
+	RevalidationTimeout time.Duration
+	Clock               timer.Clock
+}
+
+func (c *Config) Create(ctx context.Context) (http.Client, error) {
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := c.Storage
+	if storage == nil {
+		storage = NewMemoryStorage(DefaultMemoryStorageSize)
+	}
+	maxBodySize := c.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	revalidationTimeout := c.RevalidationTimeout
+	if revalidationTimeout <= 0 {
+		revalidationTimeout = DefaultRevalidationTimeout
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &client{
+		ctx:                 ctx,
+		cancel:              cancel,
+		inner:               inner,
+		storage:             storage,
+		clock:               timer.OrSystem(c.Clock),
+		maxBodySize:         maxBodySize,
+		revalidationTimeout: revalidationTimeout,
+		revalidating:        map[string]struct{}{},
+		indexLocks:          map[string]*indexLock{},
+	}, nil
+}
+
+var _ http.Client = (*client)(nil)
+
+type client struct {
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	inner               http.Client
+	storage             Storage
+	clock               timer.Clock
+	maxBodySize         int64
+	revalidationTimeout time.Duration
+	wg                  sync.WaitGroup
+	mu                  sync.Mutex
+	revalidating        map[string]struct{}
+	indexLocks          map[string]*indexLock
+}
+
+func (c *client) Request(req *http.Request) (*http.Response, error) {
+	if req.Method != netHttp.MethodGet {
+		res, err := c.inner.Request(req)
+		if err == nil && !isSafeMethod(req.Method) && res.StatusCode < 400 {
+			c.invalidate(req, res)
+		}
+
+		return res, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") || isConditional(req) {
+		return c.inner.Request(req)
+	}
+
+	key, stored := c.lookup(req)
+	if stored == nil {
+		if reqCC.has("only-if-cached") {
+			return gatewayTimeout(req), nil
+		}
+
+		return c.fetch(req, reqCC)
+	}
+
+	now := c.clock.Now()
+	resCC := parseCacheControl(stored.Header)
+	age, lifetime := stored.age(now), stored.lifetime()
+	staleness := age - lifetime
+
+	noCache := reqCC.has("no-cache") || resCC.has("no-cache") ||
+		(len(req.Header.Values("Cache-Control")) == 0 && req.Header.Get("Pragma") == "no-cache")
+
+	if !noCache && staleness < 0 && satisfiesRequest(reqCC, age, -staleness) {
+		return stored.response(req, StatusHit, now), nil
+	}
+
+	if !noCache && staleness >= 0 && !resCC.has("must-revalidate") {
+		if maxStale, ok := reqCC["max-stale"]; ok {
+			if limit, valid := reqCC.seconds("max-stale"); maxStale == "" || (valid && staleness <= limit) {
+				return stored.response(req, StatusStale, now), nil
+			}
+		}
+
+		if limit, ok := resCC.seconds("stale-while-revalidate"); ok && staleness <= limit {
+			res := stored.response(req, StatusStale, now)
+			c.revalidateInBackground(req, key, stored)
+			return res, nil
+		}
+	}
+
+	if reqCC.has("only-if-cached") {
+		return gatewayTimeout(req), nil
+	}
+
+	return c.revalidate(req, reqCC, stored, staleness)
+}
+
+// Close waits for background revalidations until ctx is done.
+func (c *client) Close(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.cancel()
+		<-done
+	}
+
+	c.cancel()
+	c.inner.Close(ctx)
+}
+
+func (c *client) fetch(req *http.Request, reqCC directives) (*http.Response, error) {
+	requestTime := c.clock.Now()
+	res, err := c.inner.Request(req)
+	if err != nil {
+		return res, err
+	}
+
+	return c.store(req, reqCC, res, requestTime, c.clock.Now()), nil
+}
+
+// revalidate sends a conditional request for the stored response, see RFC 9111 section 4.3.
+func (c *client) revalidate(req *http.Request, reqCC directives, stored *entry, staleness time.Duration) (*http.Response, error) {
+	conditional, err := http.CloneRequest(req.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+	if etag := stored.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := stored.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := c.clock.Now()
+	res, err := c.inner.Request(conditional)
+	responseTime := c.clock.Now()
+
+	if err != nil || res.StatusCode >= 500 {
+		if allowsStaleIfError(reqCC, parseCacheControl(stored.Header), staleness) {
+			discard(res)
+			return stored.response(req, StatusStale, responseTime), nil
+		}
+
+		return res, err
+	}
+
+	if res.StatusCode != netHttp.StatusNotModified {
+		return c.store(req, reqCC, res, requestTime, responseTime), nil
+	}
+
+	discard(res)
+	stored.update(res.Header, requestTime, responseTime)
+	c.save(req, stored)
+
+	return stored.response(req, StatusRevalidated, responseTime), nil
+}
+
+func (c *client) revalidateInBackground(req *http.Request, key string, stored *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.revalidating[key]; ok {
+		return
+	}
+	c.revalidating[key] = struct{}{}
+
+	// the request context may be done right after the stale response is returned
+	ctx, cancel := context.WithTimeout(c.ctx, c.revalidationTimeout)
+	bgReq := req.Clone(ctx)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+
+		res, err := c.revalidate(bgReq, directives{}, stored, 0)
+		if err == nil {
+			discard(res)
+		}
+	}()
+}
+
+// store saves the response if it is storable and returns it with a readable body.
+func (c *client) store(req *http.Request, reqCC directives, res *http.Response, requestTime time.Time, responseTime time.Time) *http.Response {
+	if res.Header == nil {
+		res.Header = netHttp.Header{}
+	}
+	res.Header.Set(StatusHeader, string(StatusMiss))
+
+	stored := &entry{
+		Status:       res.Status,
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	if !isStorable(reqCC, stored) {
+		return res
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, c.maxBodySize+1))
+	if err != nil || int64(len(body)) > c.maxBodySize {
+		res.Body = &prefixedBody{io.MultiReader(bytes.NewReader(body), errReader{err}, res.Body), res.Body}
+		return res
+	}
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	stored.Header.Del(StatusHeader)
+	stored.Body = body
+	c.save(req, stored)
+
+	return res
+}
+
+func (c *client) lookup(req *http.Request) (string, *entry) {
+	idx := c.loadIndex(req)
+	if idx == nil {
+		return "", nil
+	}
+
+	key := idx.entryKey(req)
+	data, ok, err := c.storage.Get(key)
+	if err != nil || !ok {
+		return key, nil
+	}
+
+	var stored entry
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return key, nil
+	}
+
+	return key, &stored
+}
+
+func (c *client) save(req *http.Request, stored *entry) {
+	vary := varyHeaders(stored.Header)
+
+	url := req.URL.String()
+	defer c.lockIndex(url)()
+
+	idx := c.loadIndexOf(url)
+	if idx != nil && !slices.Equal(idx.Vary, vary) {
+		// entries of the replaced index are keyed by other request headers
+		c.deleteEntries(idx)
+		idx = nil
+	}
+	if idx == nil {
+		idx = &index{ID: newIndexID(), Vary: vary}
+	}
+
+	key := idx.entryKey(req)
+	if !slices.Contains(idx.Entries, key) {
+		idx.Entries = append(idx.Entries, key)
+		data, err := json.Marshal(idx)
+		if err != nil {
+			return
+		}
+		if err = c.storage.Set(indexKey(url), data); err != nil {
+			return
+		}
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	_ = c.storage.Set(key, data)
+}
+
+func (c *client) loadIndex(req *http.Request) *index {
+	return c.loadIndexOf(req.URL.String())
+}
+
+func (c *client) loadIndexOf(url string) *index {
+	data, ok, err := c.storage.Get(indexKey(url))
+	if err != nil || !ok {
+		return nil
+	}
+
+	var idx index
+	if err = json.Unmarshal(data, &idx); err != nil {
+		return nil
+	}
+
+	return &idx
+}
+
+// invalidate removes stored responses of the request URL and of the same origin Location / Content-Location URLs, see
+// RFC 9111 section 4.4.
+func (c *client) invalidate(req *http.Request, res *http.Response) {
+	c.remove(req.URL.String())
+
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := res.Header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		u, err := req.URL.Parse(value)
+		if err == nil && u.Scheme == req.URL.Scheme && u.Host == req.URL.Host {
+			c.remove(u.String())
+		}
+	}
+}
+
+// remove deletes the index of the URL with its entries.
+func (c *client) remove(url string) {
+	defer c.lockIndex(url)()
+
+	if idx := c.loadIndexOf(url); idx != nil {
+		c.deleteEntries(idx)
+	}
+	_ = c.storage.Delete(indexKey(url))
+}
+
+// lockIndex serializes the updates of the URL index, the returned func unlocks it.
+func (c *client) lockIndex(url string) func() {
+	c.mu.Lock()
+	lock, ok := c.indexLocks[url]
+	if !ok {
+		lock = &indexLock{}
+		c.indexLocks[url] = lock
+	}
+	lock.refs++
+	c.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if lock.refs--; lock.refs == 0 {
+			delete(c.indexLocks, url)
+		}
+	}
+}
+
+type indexLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (c *client) deleteEntries(idx *index) {
+	for _, key := range idx.Entries {
+		_ = c.storage.Delete(key)
+	}
+}
+
+// index is stored per URL, it keeps the Vary header fields of stored responses and the keys of their entries, which are
+// deleted with the index. Entries are keyed by the index ID, so entries of a replaced index are never looked up.
+type index struct {
+	ID      string   `json:"id"`
+	Vary    []string `json:"vary"`
+	Entries []string `json:"entries"`
+}
+
+func (i *index) entryKey(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString("entry:")
+	b.WriteString(i.ID)
+	b.WriteString(":")
+	b.WriteString(req.URL.String())
+
+	for _, name := range i.Vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(req.Header.Values(name), ", "))
+	}
+
+	return b.String()
+}
+
+func indexKey(url string) string {
+	return "index:" + url
+}
+
+var indexCounter atomic.Uint64
+
+func newIndexID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(indexCounter.Add(1), 36)
+}
+
+func varyHeaders(header netHttp.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, netHttp.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func isStorable(reqCC directives, stored *entry) bool {
+	resCC := parseCacheControl(stored.Header)
+	if reqCC.has("no-store") || resCC.has("no-store") || stored.StatusCode == netHttp.StatusPartialContent {
+		return false
+	}
+
+	for _, name := range varyHeaders(stored.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	_, heuristic := heuristicStatusCodes[stored.StatusCode]
+	explicit := resCC.has("max-age") || resCC.has("public") || stored.Header.Get("Expires") != ""
+	if !explicit && !heuristic {
+		return false
+	}
+
+	return stored.lifetime() > 0 || stored.hasValidators()
+}
+
+func satisfiesRequest(reqCC directives, age time.Duration, remaining time.Duration) bool {
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && remaining < minFresh {
+		return false
+	}
+
+	return true
+}
+
+func allowsStaleIfError(reqCC directives, resCC directives, staleness time.Duration) bool {
+	if resCC.has("must-revalidate") || resCC.has("no-cache") {
+		return false
+	}
+
+	for _, d := range []directives{reqCC, resCC} {
+		if limit, ok := d.seconds("stale-if-error"); ok && staleness <= limit {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case netHttp.MethodGet, netHttp.MethodHead, netHttp.MethodOptions, netHttp.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConditional reports whether the request is already conditional or partial, such requests are handled by the
+// caller and are passed as is.
+func isConditional(req *http.Request) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "Range"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", netHttp.StatusGatewayTimeout, netHttp.StatusText(netHttp.StatusGatewayTimeout)),
+		StatusCode: netHttp.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     netHttp.Header{StatusHeader: {string(StatusMiss)}},
+		Body:       netHttp.NoBody,
+		Request:    req,
+	}
+}
+
+func discard(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	_ = res.Body.Close()
+}
+
+// prefixedBody returns the already read part of a body that exceeded the max body size followed by the rest.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(_ []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return 0, io.EOF
+}
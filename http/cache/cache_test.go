@@ -0,0 +1,416 @@
+package cache
+
+import (
+	"context"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/http"
+	"netshaper/test"
+	"netshaper/timer"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ timer.Clock = (*testClock)(nil)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) timer.Timer {
+	return timer.System.NewTimer(d)
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// testSlowStorage widens the window between reading and writing an index.
+type testSlowStorage struct {
+	Storage
+}
+
+func (s *testSlowStorage) Get(key string) ([]byte, bool, error) {
+	defer time.Sleep(time.Millisecond)
+	return s.Storage.Get(key)
+}
+
+type testStep struct {
+	method     string
+	header     netHttp.Header
+	advance    time.Duration
+	wantStatus Status
+	wantBody   string
+}
+
+func TestCacheRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(writer netHttp.ResponseWriter, request *netHttp.Request, call int)
+		steps     []testStep
+		wantCalls int
+	}{
+		{
+			name: "fresh response is served from cache",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "max-age=60")
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{advance: 30 * time.Second, wantStatus: StatusHit, wantBody: "hey"},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "stale response is revalidated with etag",
+			handler: func(writer netHttp.ResponseWriter, request *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "max-age=60")
+				writer.Header().Set("ETag", `"v1"`)
+				if request.Header.Get("If-None-Match") == `"v1"` {
+					writer.WriteHeader(netHttp.StatusNotModified)
+					return
+				}
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{advance: 2 * time.Minute, wantStatus: StatusRevalidated, wantBody: "hey"},
+				{advance: 30 * time.Second, wantStatus: StatusHit, wantBody: "hey"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "changed response replaces stored one",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, call int) {
+				writer.Header().Set("Cache-Control", "no-cache")
+				writer.Header().Set("ETag", `"v`+string(rune('0'+call))+`"`)
+				_, _ = io.WriteString(writer, "v"+string(rune('0'+call)))
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "v1"},
+				{wantStatus: StatusMiss, wantBody: "v2"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "vary header selects the stored response",
+			handler: func(writer netHttp.ResponseWriter, request *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "max-age=60")
+				writer.Header().Set("Vary", "Accept-Language")
+				_, _ = io.WriteString(writer, request.Header.Get("Accept-Language"))
+			},
+			steps: []testStep{
+				{header: netHttp.Header{"Accept-Language": {"en"}}, wantStatus: StatusMiss, wantBody: "en"},
+				{header: netHttp.Header{"Accept-Language": {"fr"}}, wantStatus: StatusMiss, wantBody: "fr"},
+				{header: netHttp.Header{"Accept-Language": {"en"}}, wantStatus: StatusHit, wantBody: "en"},
+				{header: netHttp.Header{"Accept-Language": {"fr"}}, wantStatus: StatusHit, wantBody: "fr"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "stale while revalidate",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, call int) {
+				writer.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+				_, _ = io.WriteString(writer, "v"+string(rune('0'+call)))
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "v1"},
+				{advance: 10 * time.Second, wantStatus: StatusStale, wantBody: "v1"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "stale if error",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, call int) {
+				if call > 1 {
+					writer.WriteHeader(netHttp.StatusBadGateway)
+					return
+				}
+				writer.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{advance: 10 * time.Second, wantStatus: StatusStale, wantBody: "hey"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "unsafe method invalidates stored response",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "max-age=60")
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{method: netHttp.MethodPost, wantBody: "hey"},
+				{wantStatus: StatusMiss, wantBody: "hey"},
+			},
+			wantCalls: 3,
+		},
+		{
+			name: "no-store response is not stored",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "no-store")
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{wantStatus: StatusMiss, wantBody: "hey"},
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "request max-age forces revalidation",
+			handler: func(writer netHttp.ResponseWriter, _ *netHttp.Request, _ int) {
+				writer.Header().Set("Cache-Control", "max-age=60")
+				writer.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				_, _ = io.WriteString(writer, "hey")
+			},
+			steps: []testStep{
+				{wantStatus: StatusMiss, wantBody: "hey"},
+				{advance: 30 * time.Second, header: netHttp.Header{"Cache-Control": {"max-age=10"}}, wantStatus: StatusMiss, wantBody: "hey"},
+			},
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			clock := &testClock{now: time.Now()}
+
+			var mu sync.Mutex
+			calls := 0
+			url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+				writer.Header().Set("Date", clock.Now().UTC().Format(netHttp.TimeFormat))
+
+				mu.Lock()
+				calls++
+				call := calls
+				mu.Unlock()
+
+				tt.handler(writer, request, call)
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.NewClient(ctx,
+				http.NewNet(http.WithNetClient(srv.Client())),
+				WithCache(WithClock(clock)),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+
+				method := step.method
+				if method == "" {
+					method = netHttp.MethodGet
+				}
+				req, err := http.NewRequest(ctx, method, url, step.header, nil)
+				if err != nil {
+					t.Errorf("NewRequest() error got = %v, want nil", err)
+					return
+				}
+
+				res, err := cl.Request(req)
+				if err != nil {
+					t.Errorf("step %v Request() error got = %v, want nil", i, err)
+					return
+				}
+				body, err := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+
+				if err != nil || string(body) != step.wantBody {
+					t.Errorf("step %v Request() body got = %q (%v), want %q", i, body, err, step.wantBody)
+				}
+				if got := StatusOf(res); got != step.wantStatus {
+					t.Errorf("step %v StatusOf() got = %v, want %v", i, got, step.wantStatus)
+				}
+			}
+
+			// waits for background revalidations
+			cl.Close(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != tt.wantCalls {
+				t.Errorf("server calls got = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheOnlyIfCached(t *testing.T) {
+	ctx := context.Background()
+
+	inner := http.NewNet()
+	cl, err := netshaper.NewClient(ctx, inner, WithCache())
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	url, _ := netshaper.ParseURL("http://localhost:1/")
+	req, _ := http.NewGetRequest(ctx, *url, netHttp.Header{"Cache-Control": {"only-if-cached"}})
+
+	res, err := cl.Request(req)
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+	if res.StatusCode != netHttp.StatusGatewayTimeout {
+		t.Errorf("Request() status got = %v, want %v", res.StatusCode, netHttp.StatusGatewayTimeout)
+	}
+}
+
+func TestCacheDeletesEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  []testStep
+		wantFiles int
+	}{
+		{
+			name: "invalidated entries",
+			requests: []testStep{
+				{method: netHttp.MethodGet},
+				{method: netHttp.MethodPost},
+			},
+			wantFiles: 0,
+		},
+		{
+			name: "entries of replaced index",
+			requests: []testStep{
+				{method: netHttp.MethodGet, header: netHttp.Header{"X-Variant": {"1"}}},
+				{method: netHttp.MethodGet, header: netHttp.Header{"X-Variant": {"2"}}},
+			},
+			// the index and the entry of the second response
+			wantFiles: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			var mu sync.Mutex
+			calls := 0
+			url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, _ *netHttp.Request) {
+				mu.Lock()
+				calls++
+				call := calls
+				mu.Unlock()
+
+				// the Vary header fields change with each response
+				writer.Header().Set("Cache-Control", "max-age=60")
+				writer.Header().Set("Vary", "X-Variant, X-Call-"+strconv.Itoa(call))
+				_, _ = io.WriteString(writer, "hey")
+			})
+			defer srv.Close()
+
+			dir := t.TempDir()
+			storage, err := NewDiskStorage(dir)
+			if err != nil {
+				t.Errorf("NewDiskStorage() error got = %v, want nil", err)
+				return
+			}
+
+			cl, err := netshaper.NewClient(ctx,
+				http.NewNet(http.WithNetClient(srv.Client())),
+				WithCache(WithStorage(storage)),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			for i, step := range tt.requests {
+				req, err := http.NewRequest(ctx, step.method, url, step.header, nil)
+				if err != nil {
+					t.Errorf("NewRequest() error got = %v, want nil", err)
+					return
+				}
+
+				res, err := cl.Request(req)
+				if err != nil {
+					t.Errorf("step %v Request() error got = %v, want nil", i, err)
+					return
+				}
+				_, _ = io.Copy(io.Discard, res.Body)
+				_ = res.Body.Close()
+			}
+
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Errorf("ReadDir() error got = %v, want nil", err)
+				return
+			}
+			if len(files) != tt.wantFiles {
+				t.Errorf("stored files got = %v, want %v", len(files), tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestCacheConcurrentSaves(t *testing.T) {
+	ctx := context.Background()
+
+	c := &client{storage: &testSlowStorage{NewMemoryStorage(0)}, indexLocks: map[string]*indexLock{}}
+	url, _ := netshaper.ParseURL("http://localhost/")
+
+	const variants = 20
+
+	requests := make([]*http.Request, 0, variants)
+	for i := 0; i < variants; i++ {
+		req, _ := http.NewGetRequest(ctx, *url, netHttp.Header{"X-Variant": {strconv.Itoa(i)}})
+		requests = append(requests, req)
+	}
+
+	var wg sync.WaitGroup
+	for _, req := range requests {
+		wg.Add(1)
+		go func(req *http.Request) {
+			defer wg.Done()
+			c.save(req, &entry{StatusCode: netHttp.StatusOK, Header: netHttp.Header{"Vary": {"X-Variant"}}})
+		}(req)
+	}
+	wg.Wait()
+
+	// every saved entry must stay in the index of the URL
+	for i, req := range requests {
+		if _, stored := c.lookup(req); stored == nil {
+			t.Errorf("variant %v lookup() got = nil, want entry", i)
+		}
+	}
+	var entries int
+	if idx := c.loadIndex(requests[0]); idx != nil {
+		entries = len(idx.Entries)
+	}
+	if entries != variants {
+		t.Errorf("index entries amount got = %v, want %v", entries, variants)
+	}
+}
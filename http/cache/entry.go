@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	netHttp "net/http"
+	"netshaper/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heuristicStatusCodes are cacheable without explicit freshness information, see RFC 9110 section 15.1.
+var heuristicStatusCodes = map[int]struct{}{
+	netHttp.StatusOK:                   {},
+	netHttp.StatusNonAuthoritativeInfo: {},
+	netHttp.StatusNoContent:            {},
+	netHttp.StatusMultipleChoices:      {},
+	netHttp.StatusMovedPermanently:     {},
+	netHttp.StatusPermanentRedirect:    {},
+	netHttp.StatusNotFound:             {},
+	netHttp.StatusMethodNotAllowed:     {},
+	netHttp.StatusGone:                 {},
+	netHttp.StatusRequestURITooLong:    {},
+	netHttp.StatusNotImplemented:       {},
+}
+
+// entry is a stored response with the times of the request that produced it.
+type entry struct {
+	Status       string         `json:"status"`
+	StatusCode   int            `json:"status_code"`
+	Header       netHttp.Header `json:"header"`
+	Body         []byte         `json:"body"`
+	RequestTime  time.Time      `json:"request_time"`
+	ResponseTime time.Time      `json:"response_time"`
+}
+
+func (e *entry) response(req *http.Request, status Status, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	header.Set(StatusHeader, string(status))
+
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// update merges the header fields of a 304 response into the stored ones, see RFC 9111 section 3.2.
+func (e *entry) update(header netHttp.Header, requestTime time.Time, responseTime time.Time) {
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Connection", StatusHeader:
+			continue
+		}
+		e.Header[name] = values
+	}
+
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// age is the current age of the stored response, see RFC 9111 section 4.2.3.
+func (e *entry) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+
+	return correctedAge + now.Sub(e.ResponseTime)
+}
+
+// lifetime is the freshness lifetime of the stored response, see RFC 9111 section 4.2.1.
+func (e *entry) lifetime() time.Duration {
+	if maxAge, ok := parseCacheControl(e.Header).seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date := e.date()
+
+	if value := e.Header.Get("Expires"); value != "" {
+		expires, err := netHttp.ParseTime(value)
+		if err != nil {
+			// invalid date means already expired
+			return 0
+		}
+
+		return expires.Sub(date)
+	}
+
+	if _, ok := heuristicStatusCodes[e.StatusCode]; ok {
+		if lastModified, err := netHttp.ParseTime(e.Header.Get("Last-Modified")); err == nil && lastModified.Before(date) {
+			return date.Sub(lastModified) / 10
+		}
+	}
+
+	return 0
+}
+
+func (e *entry) date() time.Time {
+	if date, err := netHttp.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+
+	return e.ResponseTime
+}
+
+func (e *entry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+type directives map[string]string
+
+func parseCacheControl(header netHttp.Header) directives {
+	d := directives{}
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, item := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(item), "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				d[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+func (d directives) seconds(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const DefaultMemoryStorageSize = int64(64 << 20)
+
+// Storage keeps serialized cache entries. Implementations must be safe for concurrent use.
+type Storage interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// MemoryStorage is an LRU storage bounded by the total size of keys and values, zero size means no limit.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	items   map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+func NewMemoryStorage(maxSize int64) *MemoryStorage {
+	return &MemoryStorage{
+		maxSize: maxSize,
+		items:   map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.lru.MoveToFront(el)
+
+	return el.Value.(*memoryItem).value, true, nil
+}
+
+func (s *MemoryStorage) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+
+	size := itemSize(key, value)
+	if s.maxSize > 0 && size > s.maxSize {
+		return nil
+	}
+
+	s.items[key] = s.lru.PushFront(&memoryItem{key, value})
+	s.size += size
+
+	for s.maxSize > 0 && s.size > s.maxSize {
+		s.remove(s.lru.Back().Value.(*memoryItem).key)
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+
+	return nil
+}
+
+// Size returns the total size of stored keys and values.
+func (s *MemoryStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+func (s *MemoryStorage) remove(key string) {
+	el, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	item := s.lru.Remove(el).(*memoryItem)
+	delete(s.items, key)
+	s.size -= itemSize(item.key, item.value)
+}
+
+func itemSize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
+
+var _ Storage = (*DiskStorage)(nil)
+
+// DiskStorage keeps each entry in a separate file of the directory named by the key hash.
+type DiskStorage struct {
+	dir string
+}
+
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &DiskStorage{dir}, nil
+}
+
+func (s *DiskStorage) Get(key string) ([]byte, bool, error) {
+	value, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+func (s *DiskStorage) Set(key string, value []byte) error {
+	// write to a temporary file first, so concurrent readers never see a partially written entry
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(value); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *DiskStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *DiskStorage) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:]))
+}
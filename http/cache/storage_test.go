@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStorageEviction(t *testing.T) {
+	s := NewMemoryStorage(10)
+
+	_ = s.Set("a", []byte("1234"))
+	_ = s.Set("b", []byte("1234"))
+	_, _, _ = s.Get("a")
+	_ = s.Set("c", []byte("1234"))
+
+	var got []string
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok, _ := s.Get(key); ok {
+			got = append(got, key)
+		}
+	}
+
+	if want := []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MemoryStorage keys got = %v, want %v", got, want)
+	}
+	if size := s.Size(); size != 10 {
+		t.Errorf("MemoryStorage.Size() got = %v, want %v", size, 10)
+	}
+
+	_ = s.Set("d", []byte("too large value"))
+	if _, ok, _ := s.Get("d"); ok {
+		t.Errorf("MemoryStorage stored value larger than max size")
+	}
+}
+
+func TestDiskStorage(t *testing.T) {
+	s, err := NewDiskStorage(t.TempDir())
+	if err != nil {
+		t.Errorf("NewDiskStorage() error got = %v, want nil", err)
+		return
+	}
+
+	if _, ok, err := s.Get("key"); ok || err != nil {
+		t.Errorf("DiskStorage.Get() got = %v, %v, want false, nil", ok, err)
+	}
+
+	if err = s.Set("key", []byte("value")); err != nil {
+		t.Errorf("DiskStorage.Set() error got = %v, want nil", err)
+	}
+
+	value, ok, err := s.Get("key")
+	if !ok || err != nil || string(value) != "value" {
+		t.Errorf("DiskStorage.Get() got = %q, %v, %v, want value, true, nil", value, ok, err)
+	}
+
+	if err = s.Delete("key"); err != nil {
+		t.Errorf("DiskStorage.Delete() error got = %v, want nil", err)
+	}
+	if _, ok, _ = s.Get("key"); ok {
+		t.Errorf("DiskStorage.Get() found deleted key")
+	}
+}
@@ -3,27 +3,58 @@ package http
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	net_shaper "netshaper"
 )
 
+var ErrBodyNotRewindable = errors.New("request body is not rewindable")
+
 func NewRequest(ctx context.Context, method string, url net_shaper.URL, headers net_shaper.Headers, body net_shaper.Body) (req *Request, err error) {
 	if body == nil {
 		req, err = http.NewRequestWithContext(ctx, method, url.String(), nil)
 	} else {
-		req, err = http.NewRequestWithContext(ctx, method, url.String(), bytes.NewBuffer(body))
+		req, err = http.NewRequestWithContext(ctx, method, url.String(), bytes.NewReader(body))
 	}
 	if err != nil {
 		return
 	}
 
+	if req.Body != nil && req.Body != http.NoBody {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
 	if headers != nil {
-		req.Header = headers
+		req.Header = headers.Clone()
 	}
 
 	return
 }
 
+// CloneRequest returns a deep copy of the request bound to ctx with the body rewound via GetBody, so the copy may be
+// sent again (e.g. on retries). ErrBodyNotRewindable is returned for a non-empty body without GetBody.
+func CloneRequest(ctx context.Context, req *Request) (*Request, error) {
+	clone := req.Clone(ctx)
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, ErrBodyNotRewindable
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+
+	return clone, nil
+}
+
 func NewGetRequest(ctx context.Context, url net_shaper.URL, headers net_shaper.Headers) (*Request, error) {
 	return NewRequest(ctx, http.MethodGet, url, headers, nil)
 }
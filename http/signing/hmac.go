@@ -0,0 +1,102 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"netshaper/http"
+	"netshaper/timer"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultSignatureHeader = "X-Signature"
+	DefaultTimestampHeader = "X-Timestamp"
+)
+
+var ErrNoSecret = errors.New("no secret")
+
+// HMACConfig describes HMAC signing of a message built from the request, as used by many exchange APIs.
+//
+// The message is the timestamp, the method, the path with the query and the body concatenated by default, the
+// timestamp is in Unix milliseconds and the signature is a hex encoded HMAC-SHA256. KeyHeader is set to Key if both are
+// set, e.g. "X-Api-Key".
+type HMACConfig struct {
+	Key             string
+	KeyHeader       string
+	Secret          []byte
+	SignatureHeader string
+	TimestampHeader string
+	Timestamp       func(t time.Time) string
+	Message         func(req *http.Request, timestamp string, body []byte) string
+	Hash            func() hash.Hash
+	Encode          func(signature []byte) string
+	Clock           timer.Clock
+}
+
+func NewHMAC(config HMACConfig) *HMAC {
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = DefaultSignatureHeader
+	}
+	if config.TimestampHeader == "" {
+		config.TimestampHeader = DefaultTimestampHeader
+	}
+	if config.Timestamp == nil {
+		config.Timestamp = UnixMilliTimestamp
+	}
+	if config.Message == nil {
+		config.Message = DefaultMessage
+	}
+	if config.Hash == nil {
+		config.Hash = sha256.New
+	}
+	if config.Encode == nil {
+		config.Encode = hex.EncodeToString
+	}
+	config.Clock = timer.OrSystem(config.Clock)
+
+	return &HMAC{config: config}
+}
+
+func UnixMilliTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// DefaultMessage concatenates the timestamp, the method, the path with the query and the body.
+func DefaultMessage(req *http.Request, timestamp string, body []byte) string {
+	return timestamp + req.Method + req.URL.RequestURI() + string(body)
+}
+
+var _ Signer = (*HMAC)(nil)
+
+type HMAC struct {
+	config HMACConfig
+}
+
+// Sign sets the timestamp, signature and key headers of the request.
+func (s *HMAC) Sign(req *http.Request) error {
+	if len(s.config.Secret) == 0 {
+		return ErrNoSecret
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+
+	timestamp := s.config.Timestamp(s.config.Clock.Now())
+
+	mac := hmac.New(s.config.Hash, s.config.Secret)
+	mac.Write([]byte(s.config.Message(req, timestamp, body)))
+
+	req.Header.Set(s.config.TimestampHeader, timestamp)
+	req.Header.Set(s.config.SignatureHeader, s.config.Encode(mac.Sum(nil)))
+	if s.config.KeyHeader != "" && s.config.Key != "" {
+		req.Header.Set(s.config.KeyHeader, s.config.Key)
+	}
+
+	return nil
+}
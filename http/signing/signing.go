@@ -0,0 +1,105 @@
+// Package signing signs HTTP requests with AWS Signature Version 4 or a generic HMAC scheme.
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	netHttp "net/http"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/options"
+)
+
+// WithSigner signs every request sent by the client. Signatures include a timestamp, so put it before retries in the
+// options list to sign every attempt again.
+func WithSigner(signer Signer) conf.Option[http.Config] {
+	if signer == nil {
+		return nil
+	}
+
+	return options.WithInterceptors[*http.Request, *http.Response](NewInterceptor(signer))
+}
+
+// Signer sets the signature headers of a request. Implementations must be safe for concurrent use.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+type SignerFunc func(req *http.Request) error
+
+func (fn SignerFunc) Sign(req *http.Request) error {
+	return fn(req)
+}
+
+// NewInterceptor returns the interceptor used by WithSigner, so it may be combined with other interceptors. A request
+// body without GetBody is buffered and GetBody is set, so outer retries can replay the body.
+func NewInterceptor(signer Signer) options.Interceptor[*http.Request, *http.Response] {
+	return &interceptor{signer}
+}
+
+type interceptor struct {
+	signer Signer
+}
+
+func (i *interceptor) Intercept(req *http.Request, next func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	if err := bufferBody(req); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	// sign a copy, so the original request is signed once again with a new timestamp on the next attempt
+	signed, err := http.CloneRequest(req.Context(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	if signed.Header == nil {
+		signed.Header = netHttp.Header{}
+	}
+
+	if err = i.signer.Sign(signed); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return next(signed)
+}
+
+// readBody returns the request body leaving the request body unread.
+func readBody(req *http.Request) ([]byte, error) {
+	if err := bufferBody(req); err != nil {
+		return nil, err
+	}
+
+	if req.GetBody == nil {
+		return nil, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	return io.ReadAll(body)
+}
+
+// bufferBody reads a body which can not be rewound into memory and sets GetBody.
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == netHttp.NoBody || req.GetBody != nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+
+	return nil
+}
@@ -0,0 +1,288 @@
+package signing
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/http"
+	"netshaper/options"
+	"netshaper/test"
+	"netshaper/timer"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock advances by step on every call of Now.
+type testClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now
+	c.now = c.now.Add(c.step)
+
+	return now
+}
+
+func (c *testClock) NewTimer(d time.Duration) timer.Timer {
+	return timer.System.NewTimer(d)
+}
+
+// Test vectors of the AWS Signature Version 4 test suite and the IAM example of the AWS documentation.
+func TestSigV4(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		headers map[string]string
+		service string
+		want    string
+	}{
+		{
+			name:    "get-vanilla",
+			method:  netHttp.MethodGet,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want:    "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:    "post-vanilla",
+			method:  netHttp.MethodPost,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want:    "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:    "iam list users",
+			method:  netHttp.MethodGet,
+			url:     "https://iam.amazonaws.com/?Version=2010-05-08&Action=ListUsers",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8", "User-Agent": "test"},
+			service: "iam",
+			want:    "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigV4(SigV4Config{
+				Credentials: StaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", ""),
+				Region:      "us-east-1",
+				Service:     tt.service,
+				Clock:       &testClock{now: time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)},
+			})
+
+			req, _ := netHttp.NewRequest(tt.method, tt.url, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if err := signer.Sign(req); err != nil {
+				t.Errorf("Sign() error got = %v, want nil", err)
+				return
+			}
+
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Sign() authorization got = %v, want %v", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("Sign() date got = %v, want %v", got, "20150830T123600Z")
+			}
+		})
+	}
+}
+
+func TestSigV4Headers(t *testing.T) {
+	signer := NewSigV4(SigV4Config{
+		Credentials:         StaticCredentials("AKIDEXAMPLE", "secret", "session"),
+		Region:              "eu-west-1",
+		Service:             "s3",
+		ContentSHA256Header: true,
+		Clock:               &testClock{now: time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)},
+	})
+
+	req, _ := netHttp.NewRequest(netHttp.MethodPut, "https://bucket.s3.amazonaws.com/key", strings.NewReader("body"))
+	if err := signer.Sign(req); err != nil {
+		t.Errorf("Sign() error got = %v, want nil", err)
+		return
+	}
+
+	want := map[string]string{
+		"X-Amz-Security-Token": "session",
+		"X-Amz-Content-Sha256": "230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("Sign() %v header got = %v, want %v", name, got, value)
+		}
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Sign() authorization got = %v, want signed security token and content hash", got)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "body" {
+		t.Errorf("request body got = %v, want %v", string(body), "body")
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "b=2&a=1", want: "a=1&b=2"},
+		{query: "a=2&a=1&a-b=3", want: "a=1&a=2&a-b=3"},
+		{query: "key=a+b&space=%20&tilde=~", want: "key=a%20b&space=%20&tilde=~"},
+		{query: "flag", want: "flag="},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalQuery(tt.query); got != tt.want {
+			t.Errorf("canonicalQuery(%q) got = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        HMACConfig
+		method        string
+		url           string
+		body          string
+		wantHeaders   map[string]string
+		wantSignature string
+	}{
+		{
+			name:   "defaults",
+			config: HMACConfig{Key: "key", KeyHeader: "X-Api-Key", Secret: []byte("secret")},
+			method: netHttp.MethodPost,
+			url:    "https://api.example.com/api/orders?symbol=BTC",
+			body:   `{"qty":1}`,
+			wantHeaders: map[string]string{
+				"X-Api-Key":   "key",
+				"X-Timestamp": "1700000000000",
+				"X-Signature": "05a1efbb1b5e37c8581ad80f9323b7d036c2307989609ee74171d0deeff9d698",
+			},
+		},
+		{
+			name: "custom",
+			config: HMACConfig{
+				Secret:          []byte("secret"),
+				SignatureHeader: "Sign",
+				TimestampHeader: "Nonce",
+				Timestamp:       func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) },
+				Hash:            sha512.New,
+				Encode:          base64.StdEncoding.EncodeToString,
+			},
+			method: netHttp.MethodGet,
+			url:    "https://api.example.com/api/balance",
+			wantHeaders: map[string]string{
+				"Nonce": "1700000000",
+				"Sign":  "QXLEdpEcxDmdBlUYYcj2GozC3YSS8qwHGQAu26+wAwwH4PTQ5xRPL1CCZIW2oxGAP75WLsIVuPF7M0aUN3Xzlw==",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Clock = &testClock{now: time.UnixMilli(1700000000000)}
+			signer := NewHMAC(tt.config)
+
+			req, _ := netHttp.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err := signer.Sign(req); err != nil {
+				t.Errorf("Sign() error got = %v, want nil", err)
+				return
+			}
+
+			for name, value := range tt.wantHeaders {
+				if got := req.Header.Get(name); got != value {
+					t.Errorf("Sign() %v header got = %v, want %v", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestSignerRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var gotBodies, gotTimestamps, gotSignatures []string
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		body, _ := io.ReadAll(request.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		gotBodies = append(gotBodies, string(body))
+		gotTimestamps = append(gotTimestamps, request.Header.Get("X-Timestamp"))
+		gotSignatures = append(gotSignatures, request.Header.Get("X-Signature"))
+
+		if len(gotBodies) < 2 {
+			writer.WriteHeader(netHttp.StatusBadGateway)
+		}
+	})
+	defer srv.Close()
+
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(),
+		WithSigner(NewHMAC(HMACConfig{
+			Secret: []byte("secret"),
+			Clock:  &testClock{now: time.UnixMilli(1700000000000), step: time.Second},
+		})),
+		options.WithRetry(
+			options.WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			options.WithRetryClassifier(options.RetryHttpServerErrors),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	// a body without GetBody is buffered on the first attempt, so it may be replayed
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte("payload"))
+		_ = writer.Close()
+	}()
+	req, _ := netHttp.NewRequestWithContext(ctx, netHttp.MethodPost, url.String(), reader)
+
+	res, err := cl.Request(req)
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != netHttp.StatusOK {
+		t.Errorf("Request() status got = %v, want %v", res.StatusCode, netHttp.StatusOK)
+	}
+	if want := []string{"payload", "payload"}; !reflect.DeepEqual(gotBodies, want) {
+		t.Errorf("server bodies got = %v, want %v", gotBodies, want)
+	}
+	if want := []string{"1700000000000", "1700000001000"}; !reflect.DeepEqual(gotTimestamps, want) {
+		t.Errorf("server timestamps got = %v, want %v", gotTimestamps, want)
+	}
+	if len(gotSignatures) != 2 || gotSignatures[0] == gotSignatures[1] {
+		t.Errorf("server signatures got = %v, want a new signature per attempt", gotSignatures)
+	}
+	if req.Header.Get("X-Signature") != "" {
+		t.Errorf("original request signature got = %v, want empty", req.Header.Get("X-Signature"))
+	}
+}
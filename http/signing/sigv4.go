@@ -0,0 +1,273 @@
+package signing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"netshaper/http"
+	"netshaper/timer"
+	"sort"
+	"strings"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+
+	// UnsignedPayload replaces the payload hash if the body is not signed, e.g. for S3 uploads.
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+var ErrNoCredentials = errors.New("no credentials")
+
+// sigV4IgnoredHeaders may be changed by proxies or the transport, so they are not signed.
+var sigV4IgnoredHeaders = map[string]struct{}{
+	"authorization":     {},
+	"user-agent":        {},
+	"x-amzn-trace-id":   {},
+	"expect":            {},
+	"transfer-encoding": {},
+	"connection":        {},
+}
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// CredentialsProvider returns credentials for every signed request. Implementations must be safe for concurrent use
+// and should cache the credentials.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+func (fn CredentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return fn(ctx)
+}
+
+func StaticCredentials(accessKeyID string, secretAccessKey string, sessionToken string) CredentialsProvider {
+	return CredentialsProviderFunc(func(context.Context) (Credentials, error) {
+		return Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}, nil
+	})
+}
+
+// SigV4Config describes AWS Signature Version 4 signing.
+//
+// UnsignedPayload skips hashing of the body. ContentSHA256Header sets the X-Amz-Content-Sha256 header, S3 requires
+// it. DisableURIPathEscaping signs the path escaped once, as S3 expects; other services expect it escaped twice.
+type SigV4Config struct {
+	Credentials            CredentialsProvider
+	Region                 string
+	Service                string
+	UnsignedPayload        bool
+	ContentSHA256Header    bool
+	DisableURIPathEscaping bool
+	Clock                  timer.Clock
+}
+
+func NewSigV4(config SigV4Config) *SigV4 {
+	config.Clock = timer.OrSystem(config.Clock)
+
+	return &SigV4{config: config}
+}
+
+var _ Signer = (*SigV4)(nil)
+
+type SigV4 struct {
+	config SigV4Config
+}
+
+// Sign sets the X-Amz-Date, X-Amz-Security-Token and Authorization headers of the request.
+func (s *SigV4) Sign(req *http.Request) error {
+	if s.config.Credentials == nil {
+		return ErrNoCredentials
+	}
+
+	credentials, err := s.config.Credentials.Credentials(req.Context())
+	if err != nil {
+		return err
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return ErrNoCredentials
+	}
+
+	payloadHash := UnsignedPayload
+	if !s.config.UnsignedPayload {
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		payloadHash = hashHex(body)
+	}
+
+	now := s.config.Clock.Now().UTC()
+	date := now.Format(sigV4DateFormat)
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+	if s.config.ContentSHA256Header {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalPath(req),
+		canonicalQuery(req.URL.RawQuery),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.config.Region, s.config.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, s.config.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+
+	return nil
+}
+
+func (s *SigV4) canonicalPath(req *http.Request) string {
+	path := req.URL.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	if s.config.DisableURIPathEscaping {
+		return path
+	}
+
+	return escape(path, true)
+}
+
+// canonicalHeaders returns the signed header names and the canonical headers, the host is always signed.
+func (s *SigV4) canonicalHeaders(req *http.Request) (signed string, canonical string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string][]string{"host": {host}}
+	for name, vs := range req.Header {
+		name = strings.ToLower(name)
+		if _, ok := sigV4IgnoredHeaders[name]; ok || name == "host" {
+			continue
+		}
+		values[name] = append(values[name], vs...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(trimmed, ","))
+		b.WriteByte('\n')
+	}
+
+	return strings.Join(names, ";"), b.String()
+}
+
+// canonicalQuery escapes names and values of the query and sorts them by name and value.
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params [][2]string
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		params = append(params, [2]string{escape(name, false), escape(value, false)})
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// escape percent-encodes all bytes except the unreserved characters, and slashes if keepSlash is set.
+func escape(s string, keepSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || keepSlash && c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
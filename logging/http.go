@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"netshaper/options"
+	"time"
+)
+
+// logHttpRequest returns the request with the body restored after reading its logged prefix.
+func (c *client[T1, T2]) logHttpRequest(req *http.Request) *http.Request {
+	attrs := httpRequestAttrs(req)
+
+	if attempt := options.RetryAttempt(req.Context()); attempt > 0 {
+		attrs = append(attrs, slog.Uint64("attempt", uint64(attempt)))
+	}
+	attrs = append(attrs, c.redactor.headersAttr(req.Header))
+
+	if c.config.MaxBodySize > 0 && req.Body != nil && req.Body != http.NoBody {
+		body, rest, truncated, err := readPrefix(req.Body, c.config.MaxBodySize)
+		clone := req.Clone(req.Context())
+		clone.Body = rest
+		req = clone
+
+		if err == nil {
+			attrs = append(attrs, c.redactor.bodyAttrs(body, truncated, isJSONBody(req.Header, body))...)
+		}
+	}
+
+	c.logger.LogAttrs(req.Context(), c.config.Level, "http request", attrs...)
+
+	return req
+}
+
+// logHttpResponse returns the response with the body restored after reading its logged prefix.
+func (c *client[T1, T2]) logHttpResponse(req *http.Request, res *http.Response, err error, duration time.Duration) *http.Response {
+	attrs := append(httpRequestAttrs(req), slog.Duration("duration", duration))
+
+	if err != nil {
+		c.logger.LogAttrs(req.Context(), c.config.ErrorLevel, "http request failed", append(attrs, slog.Any("error", err))...)
+		return res
+	}
+	if res == nil {
+		c.logger.LogAttrs(req.Context(), c.config.Level, "http response", attrs...)
+		return res
+	}
+
+	attrs = append(attrs, slog.Int("status", res.StatusCode), c.redactor.headersAttr(res.Header))
+
+	if c.config.MaxBodySize > 0 && res.Body != nil && res.Body != http.NoBody {
+		body, rest, truncated, readErr := readPrefix(res.Body, c.config.MaxBodySize)
+		res.Body = rest
+
+		if readErr == nil {
+			attrs = append(attrs, c.redactor.bodyAttrs(body, truncated, isJSONBody(res.Header, body))...)
+		}
+	}
+
+	c.logger.LogAttrs(req.Context(), c.config.Level, "http response", attrs...)
+
+	return res
+}
+
+func httpRequestAttrs(req *http.Request) []slog.Attr {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	attrs := []slog.Attr{slog.String("method", method)}
+	if req.URL != nil {
+		attrs = append(attrs, slog.String("url", req.URL.Redacted()))
+	}
+
+	return attrs
+}
+
+// readPrefix reads up to size bytes of body. The returned reader yields the whole body, so it replaces the original
+// one. A read error is returned to the body consumer as well.
+func readPrefix(body io.ReadCloser, size int) (prefix []byte, rest io.ReadCloser, truncated bool, err error) {
+	prefix, err = io.ReadAll(io.LimitReader(body, int64(size)+1))
+
+	var remaining io.Reader = body
+	if err != nil {
+		remaining = &errReader{err}
+	}
+
+	rest = &readCloser{io.MultiReader(bytes.NewReader(prefix), remaining), body}
+
+	if len(prefix) > size {
+		prefix, truncated = prefix[:size], true
+	}
+
+	return
+}
+
+func isJSONBody(header http.Header, body []byte) bool {
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		return isJSONContentType(contentType)
+	}
+
+	return isJSONContent(body)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
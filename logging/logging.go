@@ -0,0 +1,179 @@
+// Package logging writes structured log/slog records for netshaper clients. Records are logged with the request
+// context, so handlers aware of tracing can add trace IDs.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/websocket"
+	"time"
+)
+
+// DefaultRedactedHeaders are redacted unless WithRedactedHeaders replaces them.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// WithLogging logs requests and responses and passes the logger to the inner layers, which log retries, rate limiter
+// waits, circuit state changes and reconnects. Put it last in the options list to log each request once.
+func WithLogging[T1 netshaper.Request, T2 any](opts ...conf.Option[Config]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return &ClientConfig[T1, T2]{Inner: config, Logging: conf.ApplyOptionsInit(opts, Config{
+			Level:         slog.LevelInfo,
+			ErrorLevel:    slog.LevelError,
+			MessageLevel:  slog.LevelDebug,
+			RedactHeaders: DefaultRedactedHeaders,
+		})}
+	})
+}
+
+func WithLogger(logger *slog.Logger) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Logger = logger
+		return config
+	})
+}
+
+func WithLevel(level slog.Level) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Level = level
+		return config
+	})
+}
+
+func WithErrorLevel(level slog.Level) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.ErrorLevel = level
+		return config
+	})
+}
+
+func WithMessageLevel(level slog.Level) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.MessageLevel = level
+		return config
+	})
+}
+
+func WithRedactedHeaders(headers ...string) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.RedactHeaders = headers
+		return config
+	})
+}
+
+// WithRedactedJSONPaths redacts fields of JSON bodies and messages, e.g. "password", "user.token" or "items.*.secret".
+func WithRedactedJSONPaths(paths ...string) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.RedactJSONPaths = paths
+		return config
+	})
+}
+
+// WithBodies logs up to maxSize bytes of HTTP bodies and websocket messages.
+func WithBodies(maxSize int) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.MaxBodySize = maxSize
+		return config
+	})
+}
+
+// Config describes logged records. Level is used for request lifecycle records, ErrorLevel for failures and
+// MessageLevel for websocket messages. Bodies are not logged if MaxBodySize is zero; a JSON body is logged as redacted
+// if RedactJSONPaths is set and the body can not be parsed, e.g. because it is truncated.
+type Config struct {
+	Logger          *slog.Logger
+	Level           slog.Level
+	ErrorLevel      slog.Level
+	MessageLevel    slog.Level
+	RedactHeaders   []string
+	RedactJSONPaths []string
+	MaxBodySize     int
+}
+
+var _ netshaper.Config[*http.Request, *http.Response] = (*ClientConfig[*http.Request, *http.Response])(nil)
+
+type ClientConfig[T1 netshaper.Request, T2 any] struct {
+	Inner   netshaper.Config[T1, T2]
+	Logging Config
+}
+
+func (c *ClientConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	logger := c.Logging.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	inner, err := c.Inner.Create(netshaper.ContextWithLogger(ctx, logger))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client[T1, T2]{
+		inner:    inner,
+		logger:   logger,
+		config:   c.Logging,
+		redactor: newRedactor(c.Logging),
+	}, nil
+}
+
+var _ netshaper.Client[*http.Request, *http.Response] = (*client[*http.Request, *http.Response])(nil)
+
+type client[T1 netshaper.Request, T2 any] struct {
+	inner    netshaper.Client[T1, T2]
+	logger   *slog.Logger
+	config   Config
+	redactor *redactor
+}
+
+func (c *client[T1, T2]) Request(req T1) (res T2, err error) {
+	switch r := any(req).(type) {
+	case *http.Request:
+		r = c.logHttpRequest(r)
+		req = any(r).(T1)
+	case *websocket.Request:
+		c.logger.LogAttrs(r.Context(), c.config.Level, "websocket connecting", slog.String("url", r.URL.Redacted()))
+	default:
+		c.logger.LogAttrs(req.Context(), c.config.Level, "request started")
+	}
+
+	start := time.Now()
+	res, err = c.inner.Request(req)
+	duration := time.Since(start)
+
+	switch r := any(req).(type) {
+	case *http.Request:
+		httpRes, _ := any(res).(*http.Response)
+		if httpRes = c.logHttpResponse(r, httpRes, err, duration); httpRes != nil {
+			res = any(httpRes).(T2)
+		}
+	case *websocket.Request:
+		if err != nil {
+			c.logger.LogAttrs(r.Context(), c.config.ErrorLevel, "websocket connect failed",
+				slog.String("url", r.URL.Redacted()), slog.Duration("duration", duration), slog.Any("error", err))
+			break
+		}
+
+		c.logger.LogAttrs(r.Context(), c.config.Level, "websocket connected",
+			slog.String("url", r.URL.Redacted()), slog.Duration("duration", duration))
+
+		if raw, ok := any(res).(websocket.RawResponse); ok && raw != nil {
+			if _, exact := any(&res).(*websocket.RawResponse); exact {
+				res = any(newLoggedResponse(c, r, raw)).(T2)
+			}
+		}
+	default:
+		if err != nil {
+			c.logger.LogAttrs(req.Context(), c.config.ErrorLevel, "request failed", slog.Duration("duration", duration), slog.Any("error", err))
+		} else {
+			c.logger.LogAttrs(req.Context(), c.config.Level, "request finished", slog.Duration("duration", duration))
+		}
+	}
+
+	return
+}
+
+func (c *client[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
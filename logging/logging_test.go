@@ -0,0 +1,363 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	netWs "golang.org/x/net/websocket"
+	"io"
+	"log/slog"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/options"
+	"netshaper/test"
+	"netshaper/websocket"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+type testRecord struct {
+	message string
+	level   slog.Level
+	attrs   map[string]any
+	ctxID   any
+}
+
+// testHandler records flattened attributes, groups are joined with ".".
+type testHandler struct {
+	mu      *sync.Mutex
+	records *[]testRecord
+}
+
+func newTestHandler() *testHandler {
+	return &testHandler{mu: &sync.Mutex{}, records: &[]testRecord{}}
+}
+
+func (h *testHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *testHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := map[string]any{}
+	record.Attrs(func(attr slog.Attr) bool {
+		flattenAttr(attrs, "", attr)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	*h.records = append(*h.records, testRecord{record.Message, record.Level, attrs, ctx.Value(testContextKey{})})
+
+	return nil
+}
+
+func (h *testHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *testHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *testHandler) find(message string) (testRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, record := range *h.records {
+		if record.message == message {
+			return record, true
+		}
+	}
+
+	return testRecord{}, false
+}
+
+func flattenAttr(attrs map[string]any, prefix string, attr slog.Attr) {
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, child := range attr.Value.Group() {
+			flattenAttr(attrs, prefix+attr.Key+".", child)
+		}
+		return
+	}
+
+	attrs[prefix+attr.Key] = attr.Value.Any()
+}
+
+func TestHttpLogging(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []conf.Option[Config]
+		reqBody     string
+		resBody     string
+		contentType string
+		wantReqBody string
+		wantResBody string
+		wantTrunc   bool
+	}{
+		{
+			name:        "bodies are not logged by default",
+			reqBody:     `{"password":"secret"}`,
+			resBody:     `{"token":"secret"}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "json fields are redacted",
+			opts:        []conf.Option[Config]{WithBodies(1024), WithRedactedJSONPaths("password", "user.*.token")},
+			reqBody:     `{"login":"john","password":"secret"}`,
+			resBody:     `{"user":[{"token":"secret","id":1}]}`,
+			contentType: "application/json",
+			wantReqBody: `{"login":"john","password":"[REDACTED]"}`,
+			wantResBody: `{"user":[{"id":1,"token":"[REDACTED]"}]}`,
+		},
+		{
+			name:        "bodies are truncated",
+			opts:        []conf.Option[Config]{WithBodies(5)},
+			reqBody:     "hello world",
+			resBody:     "hello back",
+			contentType: "text/plain",
+			wantReqBody: "hello",
+			wantResBody: "hello",
+			wantTrunc:   true,
+		},
+		{
+			name:        "truncated json is redacted as a whole",
+			opts:        []conf.Option[Config]{WithBodies(5), WithRedactedJSONPaths("password")},
+			reqBody:     `{"password":"secret"}`,
+			resBody:     `{"token":"secret"}`,
+			contentType: "application/json",
+			wantReqBody: Redacted,
+			wantResBody: Redacted,
+			wantTrunc:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), testContextKey{}, "trace"), time.Second)
+			defer cancel()
+
+			var gotServerBody []byte
+			url, srv := test.NewHttpHandlerFunc("/login", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+				gotServerBody, _ = io.ReadAll(request.Body)
+				writer.Header().Set("Content-Type", tt.contentType)
+				writer.Header().Set("Set-Cookie", "session=secret")
+				_, _ = writer.Write([]byte(tt.resBody))
+			})
+			defer srv.Close()
+
+			handler := newTestHandler()
+			cl, err := netshaper.NewClient(ctx,
+				http.NewNet(http.WithNetClient(srv.Client())),
+				WithLogging[*http.Request, *http.Response](append(tt.opts, WithLogger(slog.New(handler)))...),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			headers := netshaper.Headers{"Authorization": {"Bearer secret"}, "Content-Type": {tt.contentType}}
+			req, _ := http.NewPostRequest(ctx, url, headers, []byte(tt.reqBody))
+			res, err := cl.Request(req)
+			if err != nil {
+				t.Errorf("Request() error got = %v, want nil", err)
+				return
+			}
+
+			gotBody, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if string(gotBody) != tt.resBody {
+				t.Errorf("response body got = %v, want %v", string(gotBody), tt.resBody)
+			}
+			if string(gotServerBody) != tt.reqBody {
+				t.Errorf("request body got = %v, want %v", string(gotServerBody), tt.reqBody)
+			}
+
+			reqRecord, ok := handler.find("http request")
+			if !ok {
+				t.Errorf("http request record not found")
+				return
+			}
+			resRecord, ok := handler.find("http response")
+			if !ok {
+				t.Errorf("http response record not found")
+				return
+			}
+
+			if reqRecord.ctxID != "trace" || resRecord.ctxID != "trace" {
+				t.Errorf("record context value got = %v, %v, want %v", reqRecord.ctxID, resRecord.ctxID, "trace")
+			}
+			if got := reqRecord.attrs["headers.Authorization"]; got != Redacted {
+				t.Errorf("Authorization header got = %v, want %v", got, Redacted)
+			}
+			if got := resRecord.attrs["headers.Set-Cookie"]; got != Redacted {
+				t.Errorf("Set-Cookie header got = %v, want %v", got, Redacted)
+			}
+			if got := resRecord.attrs["status"]; got != int64(netHttp.StatusOK) {
+				t.Errorf("status got = %v, want %v", got, netHttp.StatusOK)
+			}
+
+			assertBody(t, reqRecord, tt.wantReqBody, tt.wantTrunc)
+			assertBody(t, resRecord, tt.wantResBody, tt.wantTrunc)
+		})
+	}
+}
+
+func assertBody(t *testing.T, record testRecord, want string, wantTruncated bool) {
+	t.Helper()
+
+	got, ok := record.attrs["body"]
+	if want == "" {
+		if ok {
+			t.Errorf("%v body got = %v, want none", record.message, got)
+		}
+		return
+	}
+
+	if got != want {
+		t.Errorf("%v body got = %v, want %v", record.message, got, want)
+	}
+	if got := record.attrs["body_truncated"]; got != wantTruncated {
+		t.Errorf("%v body_truncated got = %v, want %v", record.message, got, wantTruncated)
+	}
+}
+
+func TestHttpLoggingInnerLayers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	calls := 0
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, _ *netHttp.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if calls++; calls == 1 {
+			writer.WriteHeader(netHttp.StatusServiceUnavailable)
+		}
+	})
+	defer srv.Close()
+
+	handler := newTestHandler()
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(http.WithNetClient(srv.Client())),
+		options.WithRetry(
+			options.WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			options.WithRetryClassifier(options.RetryHttpServerErrors),
+		),
+		WithLogging[*http.Request, *http.Response](WithLogger(slog.New(handler))),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	req, _ := http.NewGetRequest(ctx, url, nil)
+	if _, err = cl.Request(req); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	record, ok := handler.find("retrying request")
+	if !ok {
+		t.Errorf("retrying request record not found")
+		return
+	}
+	if got := record.attrs["attempt"]; got != uint64(1) {
+		t.Errorf("attempt got = %v, want %v", got, 1)
+	}
+}
+
+func TestWebsocketLogging(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), testContextKey{}, "trace"), time.Second)
+	defer cancel()
+
+	url, srv := test.NewWsHandler(func(conn *netWs.Conn) {
+		var msg []byte
+		_ = netWs.Message.Receive(conn, &msg)
+		_ = netWs.Message.Send(conn, []byte(`{"token":"secret"}`))
+	})
+	defer srv.Close()
+
+	handler := newTestHandler()
+	cl, err := netshaper.NewClient(ctx,
+		websocket.NewNet(),
+		WithLogging[*websocket.Request, websocket.RawResponse](
+			WithLogger(slog.New(handler)),
+			WithBodies(1024),
+			WithRedactedJSONPaths("token"),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	res, err := cl.Request(&websocket.Request{Ctx: ctx, URL: url})
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+
+	_ = res.Send(websocket.ByteMessage("hey"))
+	for range res.Listen() {
+	}
+	res.Close(ctx)
+
+	want := map[string]any{
+		"websocket connecting":       nil,
+		"websocket connected":        nil,
+		"websocket message sent":     "hey",
+		"websocket message received": `{"token":"[REDACTED]"}`,
+		"websocket closed":           nil,
+	}
+
+	for message, body := range want {
+		record, ok := handler.find(message)
+		if !ok {
+			t.Errorf("%v record not found", message)
+			continue
+		}
+		if record.ctxID != "trace" {
+			t.Errorf("%v context value got = %v, want %v", message, record.ctxID, "trace")
+		}
+		if got := record.attrs["body"]; body != nil && got != body {
+			t.Errorf("%v body got = %v, want %v", message, got, body)
+		}
+	}
+}
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		path  []string
+		want  string
+	}{
+		{name: "top level field", value: `{"a":1,"b":2}`, path: []string{"a"}, want: `{"a":"[REDACTED]","b":2}`},
+		{name: "nested field", value: `{"a":{"b":1,"c":2}}`, path: []string{"a", "b"}, want: `{"a":{"b":"[REDACTED]","c":2}}`},
+		{name: "array wildcard", value: `[{"a":1},{"a":2}]`, path: []string{"*", "a"}, want: `[{"a":"[REDACTED]"},{"a":"[REDACTED]"}]`},
+		{name: "array index", value: `{"a":[1,2]}`, path: []string{"a", "1"}, want: `{"a":[1,"[REDACTED]"]}`},
+		{name: "missing field", value: `{"a":1}`, path: []string{"b"}, want: `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			_ = json.Unmarshal([]byte(tt.value), &value)
+
+			got, _ := json.Marshal(redactPath(value, tt.path))
+			if !reflect.DeepEqual(string(got), tt.want) {
+				t.Errorf("redactPath() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+type redactor struct {
+	headers     map[string]bool
+	jsonPaths   [][]string
+	maxBodySize int
+}
+
+func newRedactor(config Config) *redactor {
+	r := &redactor{
+		headers:     make(map[string]bool, len(config.RedactHeaders)),
+		maxBodySize: config.MaxBodySize,
+	}
+
+	for _, header := range config.RedactHeaders {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, path := range config.RedactJSONPaths {
+		r.jsonPaths = append(r.jsonPaths, strings.Split(path, "."))
+	}
+
+	return r
+}
+
+func (r *redactor) headersAttr(headers http.Header) slog.Attr {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]any, 0, len(headers))
+	for _, name := range names {
+		value := strings.Join(headers[name], ", ")
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			value = Redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+
+	return slog.Group("headers", attrs...)
+}
+
+// bodyAttrs redacts and truncates the body. truncated reports whether body is only a prefix of the whole body, a JSON
+// prefix can not be parsed, so it is logged as redacted if any JSON path must be redacted.
+func (r *redactor) bodyAttrs(body []byte, truncated bool, isJSON bool) []slog.Attr {
+	if isJSON && len(r.jsonPaths) > 0 {
+		redacted, ok := r.redactJSON(body)
+		if !ok {
+			return []slog.Attr{slog.String("body", Redacted), slog.Bool("body_truncated", truncated)}
+		}
+		body = redacted
+	}
+
+	if len(body) > r.maxBodySize {
+		body = body[:r.maxBodySize]
+		truncated = true
+	}
+
+	return []slog.Attr{slog.String("body", string(body)), slog.Bool("body_truncated", truncated)}
+}
+
+func (r *redactor) redactJSON(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+
+	for _, path := range r.jsonPaths {
+		value = redactPath(value, path)
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+
+	return redacted, true
+}
+
+// redactPath replaces values matching the path, "*" matches any object field or array element.
+func redactPath(value any, path []string) any {
+	if len(path) == 0 {
+		return Redacted
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = redactPath(child, path[1:])
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				v[i] = redactPath(child, path[1:])
+			}
+		}
+	}
+
+	return value
+}
+
+func isJSONContentType(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "json")
+}
+
+func isJSONContent(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
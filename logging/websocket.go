@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"netshaper"
+	"netshaper/websocket"
+	"sync"
+)
+
+var _ websocket.RawResponse = (*loggedResponse)(nil)
+
+// loggedResponse logs sent and received messages and the connection close. Records are logged with the context of
+// the request which opened the connection.
+type loggedResponse struct {
+	websocket.RawResponse
+	ctx        context.Context
+	logger     *slog.Logger
+	config     Config
+	redactor   *redactor
+	url        string
+	listenOnce sync.Once
+	messages   chan websocket.Message
+	closeOnce  sync.Once
+}
+
+func newLoggedResponse[T1 netshaper.Request, T2 any](c *client[T1, T2], req *websocket.Request, res websocket.RawResponse) *loggedResponse {
+	r := &loggedResponse{
+		RawResponse: res,
+		ctx:         req.Context(),
+		logger:      c.logger,
+		config:      c.config,
+		redactor:    c.redactor,
+		url:         req.URL.Redacted(),
+	}
+
+	go func() {
+		<-res.Closed()
+		r.logClosed()
+	}()
+
+	return r
+}
+
+func (r *loggedResponse) Send(message websocket.Message) error {
+	err := r.RawResponse.Send(message)
+	if err != nil {
+		r.logger.LogAttrs(r.ctx, r.config.ErrorLevel, "websocket message send failed",
+			slog.String("url", r.url), slog.Any("error", err))
+		return err
+	}
+
+	r.logMessage("websocket message sent", message)
+
+	return nil
+}
+
+func (r *loggedResponse) Listen() <-chan websocket.Message {
+	r.listenOnce.Do(func() {
+		inner := r.RawResponse.Listen()
+		r.messages = make(chan websocket.Message, cap(inner))
+
+		go func() {
+			defer close(r.messages)
+
+			for msg := range inner {
+				if err := msg.Err(); err != nil {
+					r.logger.LogAttrs(r.ctx, r.config.ErrorLevel, "websocket message receive failed",
+						slog.String("url", r.url), slog.Any("error", err))
+				} else {
+					r.logMessage("websocket message received", msg)
+				}
+
+				r.messages <- msg
+			}
+		}()
+	})
+
+	return r.messages
+}
+
+func (r *loggedResponse) Close(ctx context.Context) {
+	r.RawResponse.Close(ctx)
+	r.logClosed()
+}
+
+func (r *loggedResponse) logMessage(msg string, message websocket.Message) {
+	if !r.logger.Enabled(r.ctx, r.config.MessageLevel) {
+		return
+	}
+
+	buff := message.Buff()
+	attrs := []slog.Attr{slog.String("url", r.url), slog.Int("size", len(buff))}
+	if r.config.MaxBodySize > 0 {
+		attrs = append(attrs, r.redactor.bodyAttrs(buff, false, isJSONContent(buff))...)
+	}
+
+	r.logger.LogAttrs(r.ctx, r.config.MessageLevel, msg, attrs...)
+}
+
+func (r *loggedResponse) logClosed() {
+	r.closeOnce.Do(func() {
+		if err := r.RawResponse.Err(); err != nil {
+			r.logger.LogAttrs(r.ctx, r.config.ErrorLevel, "websocket closed", slog.String("url", r.url), slog.Any("error", err))
+			return
+		}
+
+		r.logger.LogAttrs(r.ctx, r.config.Level, "websocket closed", slog.String("url", r.url))
+	})
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var _ Metrics = (*Memory)(nil)
+
+// Memory keeps metrics in memory, it is useful in tests.
+type Memory struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string][]float64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		counters:   map[string]float64{},
+		gauges:     map[string]float64{},
+		histograms: map[string][]float64{},
+	}
+}
+
+func (m *Memory) AddCounter(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters[memoryKey(name, labels)] += value
+}
+
+func (m *Memory) AddGauge(name string, delta float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gauges[memoryKey(name, labels)] += delta
+}
+
+func (m *Memory) SetGauge(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gauges[memoryKey(name, labels)] = value
+}
+
+func (m *Memory) ObserveHistogram(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(name, labels)
+	m.histograms[key] = append(m.histograms[key], value)
+}
+
+func (m *Memory) Counter(name string, labels Labels) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.counters[memoryKey(name, labels)]
+}
+
+func (m *Memory) Gauge(name string, labels Labels) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.gauges[memoryKey(name, labels)]
+}
+
+// Histogram returns all observed values.
+func (m *Memory) Histogram(name string, labels Labels) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]float64{}, m.histograms[memoryKey(name, labels)]...)
+}
+
+func memoryKey(name string, labels Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
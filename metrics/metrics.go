@@ -0,0 +1,191 @@
+// Package metrics records what the client layers are doing. Layers get Metrics from the context passed to
+// netshaper.Config Create, WithMetrics puts it there.
+package metrics
+
+import (
+	"context"
+	"netshaper"
+	"netshaper/conf"
+	"time"
+)
+
+const (
+	RequestsTotal          = "netshaper_requests_total"
+	RequestDurationSeconds = "netshaper_request_duration_seconds"
+
+	RetryAttemptsTotal              = "netshaper_retry_attempts_total"
+	CircuitState                    = "netshaper_circuit_state"
+	CircuitTransitionsTotal         = "netshaper_circuit_transitions_total"
+	RateLimiterWaitSeconds          = "netshaper_rate_limiter_wait_seconds"
+	PoolQueueDepth                  = "netshaper_pool_queue_depth"
+	PoolBusyWorkers                 = "netshaper_pool_busy_workers"
+	PoolWorkers                     = "netshaper_pool_workers"
+	WebsocketConnections            = "netshaper_websocket_connections"
+	WebsocketReconnectsTotal        = "netshaper_websocket_reconnects_total"
+	WebsocketMessagesTotal          = "netshaper_websocket_messages_total"
+	WebsocketBytesTotal             = "netshaper_websocket_bytes_total"
+	WebsocketPingLatencySeconds     = "netshaper_websocket_ping_latency_seconds"
+	WebsocketHeartbeatTimeoutsTotal = "netshaper_websocket_heartbeat_timeouts_total"
+)
+
+const (
+	LabelOutcome   = "outcome"
+	LabelFrom      = "from"
+	LabelTo        = "to"
+	LabelDirection = "direction"
+
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Help describes the metrics recorded by netshaper layers.
+var Help = map[string]string{
+	RequestsTotal:                   "Total number of client requests by outcome.",
+	RequestDurationSeconds:          "Client request latency in seconds by outcome.",
+	RetryAttemptsTotal:              "Total number of retried request attempts.",
+	CircuitState:                    "Circuit breaker state: 0 - closed, 1 - open, 2 - half-open.",
+	CircuitTransitionsTotal:         "Total number of circuit breaker state transitions.",
+	RateLimiterWaitSeconds:          "Time in seconds requests waited for the rate limiter.",
+	PoolQueueDepth:                  "Number of requests waiting for a pool worker.",
+	PoolBusyWorkers:                 "Number of pool workers handling a request.",
+	PoolWorkers:                     "Number of pool workers.",
+	WebsocketConnections:            "Number of open websocket connections.",
+	WebsocketReconnectsTotal:        "Total number of websocket reconnects.",
+	WebsocketMessagesTotal:          "Total number of websocket messages by direction.",
+	WebsocketBytesTotal:             "Total number of websocket message bytes by direction.",
+	WebsocketPingLatencySeconds:     "Time in seconds websocket peers took to answer heartbeat pings.",
+	WebsocketHeartbeatTimeoutsTotal: "Total number of websocket connections closed for missed heartbeats.",
+}
+
+type Labels map[string]string
+
+// Metrics must be safe for concurrent use. A metric is always recorded with the same label names.
+type Metrics interface {
+	AddCounter(name string, value float64, labels Labels)
+	AddGauge(name string, delta float64, labels Labels)
+	SetGauge(name string, value float64, labels Labels)
+	ObserveHistogram(name string, value float64, labels Labels)
+}
+
+var Nop Metrics = nop{}
+
+type nop struct{}
+
+func (nop) AddCounter(string, float64, Labels) {}
+
+func (nop) AddGauge(string, float64, Labels) {}
+
+func (nop) SetGauge(string, float64, Labels) {}
+
+func (nop) ObserveHistogram(string, float64, Labels) {}
+
+type contextKey struct{}
+
+func ContextWith(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the metrics put by WithMetrics or Nop.
+func FromContext(ctx context.Context) Metrics {
+	if m, ok := ctx.Value(contextKey{}).(Metrics); ok && m != nil {
+		return m
+	}
+
+	return Nop
+}
+
+// WithConstLabels adds labels to every metric, e.g. to distinguish clients.
+func WithConstLabels(m Metrics, labels Labels) Metrics {
+	return &constLabels{m, labels}
+}
+
+type constLabels struct {
+	inner  Metrics
+	labels Labels
+}
+
+func (m *constLabels) AddCounter(name string, value float64, labels Labels) {
+	m.inner.AddCounter(name, value, m.merge(labels))
+}
+
+func (m *constLabels) AddGauge(name string, delta float64, labels Labels) {
+	m.inner.AddGauge(name, delta, m.merge(labels))
+}
+
+func (m *constLabels) SetGauge(name string, value float64, labels Labels) {
+	m.inner.SetGauge(name, value, m.merge(labels))
+}
+
+func (m *constLabels) ObserveHistogram(name string, value float64, labels Labels) {
+	m.inner.ObserveHistogram(name, value, m.merge(labels))
+}
+
+func (m *constLabels) merge(labels Labels) Labels {
+	merged := make(Labels, len(m.labels)+len(labels))
+	for k, v := range m.labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// WithMetrics records requests count and latency and passes metrics to the inner layers, so it should be the last
+// option of the client.
+func WithMetrics[T1 any, T2 any](m Metrics) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return &Config[T1, T2]{Inner: config, Metrics: m}
+	})
+}
+
+var _ netshaper.Config[int, string] = (*Config[int, string])(nil)
+
+type Config[T1 any, T2 any] struct {
+	Inner   netshaper.Config[T1, T2]
+	Metrics Metrics
+}
+
+func (c *Config[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	m := c.Metrics
+	if m == nil {
+		m = FromContext(ctx)
+	}
+
+	inner, err := c.Inner.Create(ContextWith(ctx, m))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client[T1, T2]{inner, m}, nil
+}
+
+var _ netshaper.Client[int, string] = (*client[int, string])(nil)
+
+type client[T1 any, T2 any] struct {
+	inner   netshaper.Client[T1, T2]
+	metrics Metrics
+}
+
+func (c *client[T1, T2]) Request(req T1) (res T2, err error) {
+	start := time.Now()
+	res, err = c.inner.Request(req)
+
+	labels := Labels{LabelOutcome: OutcomeSuccess}
+	if err != nil {
+		labels[LabelOutcome] = OutcomeError
+	}
+
+	c.metrics.AddCounter(RequestsTotal, 1, labels)
+	c.metrics.ObserveHistogram(RequestDurationSeconds, time.Since(start).Seconds(), labels)
+
+	return
+}
+
+func (c *client[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
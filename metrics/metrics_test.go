@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"netshaper/conf"
+	"reflect"
+	"testing"
+)
+
+var _ netshaper.Config[int, string] = (*testClient)(nil)
+
+type testClient struct {
+	fn      func(req int) (string, error)
+	metrics Metrics
+}
+
+func (c *testClient) Create(ctx context.Context) (netshaper.Client[int, string], error) {
+	c.metrics = FromContext(ctx)
+	return c, nil
+}
+
+func (c *testClient) Request(req int) (string, error) {
+	return c.fn(req)
+}
+
+func (c *testClient) Close(_ context.Context) {
+}
+
+func TestWithMetrics(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+	m := NewMemory()
+
+	inner := &testClient{fn: func(req int) (string, error) {
+		if req < 0 {
+			return "", errFailed
+		}
+		return "ok", nil
+	}}
+
+	cl, err := netshaper.NewClient[int, string](ctx,
+		conf.OptionFunc[netshaper.Config[int, string]](func(_ netshaper.Config[int, string]) netshaper.Config[int, string] {
+			return inner
+		}),
+		WithMetrics[int, string](m),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	if inner.metrics != m {
+		t.Errorf("FromContext() got = %v, want %v", inner.metrics, m)
+	}
+
+	for _, req := range []int{1, 2, -1} {
+		_, _ = cl.Request(req)
+	}
+
+	success := Labels{LabelOutcome: OutcomeSuccess}
+	failure := Labels{LabelOutcome: OutcomeError}
+
+	if got := m.Counter(RequestsTotal, success); got != 2 {
+		t.Errorf("Counter() got = %v, want %v", got, 2)
+	}
+	if got := m.Counter(RequestsTotal, failure); got != 1 {
+		t.Errorf("Counter() got = %v, want %v", got, 1)
+	}
+	if got := len(m.Histogram(RequestDurationSeconds, success)); got != 2 {
+		t.Errorf("Histogram() observations got = %v, want %v", got, 2)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	m := NewMemory()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want Metrics
+	}{
+		{name: "nop by default", ctx: context.Background(), want: Nop},
+		{name: "from context", ctx: ContextWith(context.Background(), m), want: m},
+		{name: "nil in context", ctx: ContextWith(context.Background(), nil), want: Nop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromContext(tt.ctx); got != tt.want {
+				t.Errorf("FromContext() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	labels := Labels{LabelDirection: DirectionIn}
+
+	m.AddCounter(WebsocketMessagesTotal, 1, labels)
+	m.AddCounter(WebsocketMessagesTotal, 2, Labels{LabelDirection: DirectionIn})
+	m.AddCounter(WebsocketMessagesTotal, 5, Labels{LabelDirection: DirectionOut})
+	m.AddGauge(PoolBusyWorkers, 2, nil)
+	m.AddGauge(PoolBusyWorkers, -1, nil)
+	m.SetGauge(PoolQueueDepth, 3, nil)
+	m.ObserveHistogram(RateLimiterWaitSeconds, 0.5, nil)
+	m.ObserveHistogram(RateLimiterWaitSeconds, 1, nil)
+
+	if got := m.Counter(WebsocketMessagesTotal, labels); got != 3 {
+		t.Errorf("Counter() got = %v, want %v", got, 3)
+	}
+	if got := m.Gauge(PoolBusyWorkers, nil); got != 1 {
+		t.Errorf("Gauge() got = %v, want %v", got, 1)
+	}
+	if got := m.Gauge(PoolQueueDepth, Labels{}); got != 3 {
+		t.Errorf("Gauge() got = %v, want %v", got, 3)
+	}
+	if got, want := m.Histogram(RateLimiterWaitSeconds, nil), []float64{0.5, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Histogram() got = %v, want %v", got, want)
+	}
+}
+
+func TestWithConstLabels(t *testing.T) {
+	m := NewMemory()
+	labeled := WithConstLabels(m, Labels{"client": "api"})
+
+	labeled.AddCounter(RequestsTotal, 1, Labels{LabelOutcome: OutcomeSuccess})
+
+	if got := m.Counter(RequestsTotal, Labels{"client": "api", LabelOutcome: OutcomeSuccess}); got != 1 {
+		t.Errorf("Counter() got = %v, want %v", got, 1)
+	}
+	if got := m.Counter(RequestsTotal, Labels{LabelOutcome: OutcomeSuccess}); got != 0 {
+		t.Errorf("Counter() got = %v, want %v", got, 0)
+	}
+}
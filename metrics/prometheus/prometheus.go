@@ -0,0 +1,178 @@
+// Package prometheus records netshaper metrics with the Prometheus client. It is a separate module, so netshaper itself
+// does not depend on the Prometheus client.
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"netshaper/conf"
+	"netshaper/metrics"
+	"sort"
+	"sync"
+)
+
+func WithBuckets(buckets []float64) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Buckets = buckets
+		return config
+	})
+}
+
+func WithConstLabels(labels prometheus.Labels) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.ConstLabels = labels
+		return config
+	})
+}
+
+// Config describes collectors created by Metrics. Histograms use prometheus.DefBuckets by default.
+type Config struct {
+	Buckets     []float64
+	ConstLabels prometheus.Labels
+}
+
+var _ metrics.Metrics = (*Metrics)(nil)
+
+// Metrics registers a collector on the first use of a metric name. Label names of a metric are taken from its first
+// use, values of unknown labels are dropped and missing labels are empty.
+type Metrics struct {
+	registerer prometheus.Registerer
+	config     Config
+	mu         sync.Mutex
+	counters   map[string]*vec[*prometheus.CounterVec]
+	gauges     map[string]*vec[*prometheus.GaugeVec]
+	histograms map[string]*vec[*prometheus.HistogramVec]
+}
+
+func New(registerer prometheus.Registerer, opts ...conf.Option[Config]) *Metrics {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	config := conf.ApplyOptions(opts)
+	if config.Buckets == nil {
+		config.Buckets = prometheus.DefBuckets
+	}
+
+	return &Metrics{
+		registerer: registerer,
+		config:     config,
+		counters:   map[string]*vec[*prometheus.CounterVec]{},
+		gauges:     map[string]*vec[*prometheus.GaugeVec]{},
+		histograms: map[string]*vec[*prometheus.HistogramVec]{},
+	}
+}
+
+func (m *Metrics) AddCounter(name string, value float64, labels metrics.Labels) {
+	v := getVec(m, m.counters, name, labels, func(opts prometheus.Opts, labelNames []string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts(opts), labelNames)
+	})
+	if v == nil {
+		return
+	}
+
+	if c, err := v.collector.GetMetricWith(v.labels(labels)); err == nil {
+		c.Add(value)
+	}
+}
+
+func (m *Metrics) AddGauge(name string, delta float64, labels metrics.Labels) {
+	if g := m.gauge(name, labels); g != nil {
+		g.Add(delta)
+	}
+}
+
+func (m *Metrics) SetGauge(name string, value float64, labels metrics.Labels) {
+	if g := m.gauge(name, labels); g != nil {
+		g.Set(value)
+	}
+}
+
+func (m *Metrics) ObserveHistogram(name string, value float64, labels metrics.Labels) {
+	v := getVec(m, m.histograms, name, labels, func(opts prometheus.Opts, labelNames []string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        opts.Name,
+			Help:        opts.Help,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     m.config.Buckets,
+		}, labelNames)
+	})
+	if v == nil {
+		return
+	}
+
+	if o, err := v.collector.GetMetricWith(v.labels(labels)); err == nil {
+		o.Observe(value)
+	}
+}
+
+func (m *Metrics) gauge(name string, labels metrics.Labels) prometheus.Gauge {
+	v := getVec(m, m.gauges, name, labels, func(opts prometheus.Opts, labelNames []string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labelNames)
+	})
+	if v == nil {
+		return nil
+	}
+
+	g, err := v.collector.GetMetricWith(v.labels(labels))
+	if err != nil {
+		return nil
+	}
+
+	return g
+}
+
+type vec[T prometheus.Collector] struct {
+	collector  T
+	labelNames []string
+}
+
+func (v *vec[T]) labels(labels metrics.Labels) prometheus.Labels {
+	values := make(prometheus.Labels, len(v.labelNames))
+	for _, name := range v.labelNames {
+		values[name] = labels[name]
+	}
+
+	return values
+}
+
+// getVec returns nil if the collector can not be registered, e.g. if the name is used by a collector of another type.
+func getVec[T prometheus.Collector](m *Metrics, vecs map[string]*vec[T], name string, labels metrics.Labels, create func(opts prometheus.Opts, labelNames []string) T) *vec[T] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := vecs[name]; ok {
+		return v
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for label := range labels {
+		labelNames = append(labelNames, label)
+	}
+	sort.Strings(labelNames)
+
+	help := metrics.Help[name]
+	if help == "" {
+		help = name
+	}
+
+	collector := create(prometheus.Opts{Name: name, Help: help, ConstLabels: m.config.ConstLabels}, labelNames)
+	if err := m.registerer.Register(collector); err != nil {
+		registered, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			vecs[name] = nil
+			return nil
+		}
+
+		existing, ok := registered.ExistingCollector.(T)
+		if !ok {
+			vecs[name] = nil
+			return nil
+		}
+		collector = existing
+	}
+
+	v := &vec[T]{collector, labelNames}
+	vecs[name] = v
+
+	return v
+}
@@ -0,0 +1,94 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"netshaper/metrics"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New(registry, WithBuckets([]float64{0.1, 1}))
+
+	m.AddCounter(metrics.RequestsTotal, 1, metrics.Labels{metrics.LabelOutcome: metrics.OutcomeSuccess})
+	m.AddCounter(metrics.RequestsTotal, 2, metrics.Labels{metrics.LabelOutcome: metrics.OutcomeError})
+	m.AddGauge(metrics.PoolBusyWorkers, 3, nil)
+	m.AddGauge(metrics.PoolBusyWorkers, -1, nil)
+	m.SetGauge(metrics.CircuitState, 1, nil)
+	m.ObserveHistogram(metrics.RateLimiterWaitSeconds, 0.5, nil)
+
+	want := `
+# HELP netshaper_circuit_state Circuit breaker state: 0 - closed, 1 - open, 2 - half-open.
+# TYPE netshaper_circuit_state gauge
+netshaper_circuit_state 1
+# HELP netshaper_pool_busy_workers Number of pool workers handling a request.
+# TYPE netshaper_pool_busy_workers gauge
+netshaper_pool_busy_workers 2
+# HELP netshaper_rate_limiter_wait_seconds Time in seconds requests waited for the rate limiter.
+# TYPE netshaper_rate_limiter_wait_seconds histogram
+netshaper_rate_limiter_wait_seconds_bucket{le="0.1"} 0
+netshaper_rate_limiter_wait_seconds_bucket{le="1"} 1
+netshaper_rate_limiter_wait_seconds_bucket{le="+Inf"} 1
+netshaper_rate_limiter_wait_seconds_sum 0.5
+netshaper_rate_limiter_wait_seconds_count 1
+# HELP netshaper_requests_total Total number of client requests by outcome.
+# TYPE netshaper_requests_total counter
+netshaper_requests_total{outcome="error"} 2
+netshaper_requests_total{outcome="success"} 1
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Errorf("GatherAndCompare() error got = %v, want nil", err)
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New(registry, WithConstLabels(prometheus.Labels{"client": "api"}))
+
+	m.AddCounter(metrics.WebsocketMessagesTotal, 1, metrics.Labels{metrics.LabelDirection: metrics.DirectionIn})
+	// unknown labels are dropped, missing labels are empty
+	m.AddCounter(metrics.WebsocketMessagesTotal, 1, metrics.Labels{metrics.LabelDirection: metrics.DirectionIn, "unknown": "x"})
+	m.AddCounter(metrics.WebsocketMessagesTotal, 1, nil)
+
+	want := `
+# HELP netshaper_websocket_messages_total Total number of websocket messages by direction.
+# TYPE netshaper_websocket_messages_total counter
+netshaper_websocket_messages_total{client="api",direction=""} 1
+netshaper_websocket_messages_total{client="api",direction="in"} 2
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Errorf("GatherAndCompare() error got = %v, want nil", err)
+	}
+}
+
+func TestMetricsRegistered(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	New(registry).AddCounter(metrics.RetryAttemptsTotal, 1, nil)
+	// the second adapter reuses the registered collector
+	New(registry).AddCounter(metrics.RetryAttemptsTotal, 1, nil)
+	// the name is registered as a counter, the gauge is skipped
+	New(registry).SetGauge(metrics.RetryAttemptsTotal, 10, nil)
+
+	if got := testutil.ToFloat64(mustCounter(t, registry)); got != 2 {
+		t.Errorf("counter value got = %v, want %v", got, 2)
+	}
+}
+
+func mustCounter(t *testing.T, registry *prometheus.Registry) prometheus.Collector {
+	t.Helper()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: metrics.RetryAttemptsTotal, Help: metrics.Help[metrics.RetryAttemptsTotal]})
+	err := registry.Register(counter)
+
+	registered, ok := err.(prometheus.AlreadyRegisteredError)
+	if !ok {
+		t.Fatalf("Register() error got = %v, want AlreadyRegisteredError", err)
+	}
+
+	return registered.ExistingCollector
+}
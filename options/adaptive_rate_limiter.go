@@ -0,0 +1,305 @@
+package options
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/timer"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAdaptiveInitialRate = 10.0
+	DefaultAdaptiveMinRate     = 0.1
+	DefaultAdaptiveIncrease    = 1.0
+	DefaultAdaptiveDecrease    = 0.5
+)
+
+func WithAdaptiveRateLimiter[T1 netshaper.Request](opts ...conf.Option[AdaptiveRateLimitConfig]) conf.Option[netshaper.Config[T1, *http.Response]] {
+	return WithRateLimiter[T1, *http.Response](NewAdaptiveRateLimiter[T1](opts...))
+}
+
+func WithAdaptiveInitialRate(rps float64) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.InitialRate = rps
+		return config
+	})
+}
+
+func WithAdaptiveRateBounds(minRps float64, maxRps float64) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.MinRate = minRps
+		config.MaxRate = maxRps
+		return config
+	})
+}
+
+func WithAdaptiveIncrease(rpsPerSecond float64) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.Increase = rpsPerSecond
+		return config
+	})
+}
+
+func WithAdaptiveDecrease(factor float64) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.Decrease = factor
+		return config
+	})
+}
+
+func WithAdaptiveBurst(burst uint) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.Burst = burst
+		return config
+	})
+}
+
+func WithAdaptiveClock(clock timer.Clock) conf.Option[AdaptiveRateLimitConfig] {
+	return conf.OptionFunc[AdaptiveRateLimitConfig](func(config AdaptiveRateLimitConfig) AdaptiveRateLimitConfig {
+		config.Clock = clock
+		return config
+	})
+}
+
+// AdaptiveRateLimitConfig configures AIMD rate limiting: the rate is multiplied by Decrease when the server throttles
+// (429, 503, exhausted quota) and grows by Increase requests per second for every second without throttling.
+type AdaptiveRateLimitConfig struct {
+	InitialRate float64
+	MinRate     float64
+	MaxRate     float64
+	Increase    float64
+	Decrease    float64
+	Burst       uint
+	Clock       timer.Clock
+}
+
+func NewAdaptiveRateLimiter[T1 netshaper.Request](opts ...conf.Option[AdaptiveRateLimitConfig]) RateLimiter[T1, *http.Response] {
+	config := conf.ApplyOptions(opts)
+
+	if config.InitialRate <= 0 {
+		config.InitialRate = config.MaxRate
+	}
+	if config.InitialRate <= 0 {
+		config.InitialRate = DefaultAdaptiveInitialRate
+	}
+	if config.MinRate <= 0 {
+		config.MinRate = math.Min(DefaultAdaptiveMinRate, config.InitialRate)
+	}
+	if config.MaxRate <= 0 {
+		config.MaxRate = math.Inf(1)
+	}
+	if config.Increase <= 0 {
+		config.Increase = DefaultAdaptiveIncrease
+	}
+	if config.Decrease <= 0 || config.Decrease >= 1 {
+		config.Decrease = DefaultAdaptiveDecrease
+	}
+	config.Clock = timer.OrSystem(config.Clock)
+
+	return &adaptiveRateLimiter[T1]{
+		config:       config,
+		bucket:       newTokenBucket(config.InitialRate, config.Burst, config.Clock),
+		rate:         config.InitialRate,
+		lastIncrease: config.Clock.Now(),
+	}
+}
+
+type adaptiveRateLimiter[T1 netshaper.Request] struct {
+	config       AdaptiveRateLimitConfig
+	bucket       *tokenBucket
+	mu           sync.Mutex
+	rate         float64
+	lastIncrease time.Time
+}
+
+func (l *adaptiveRateLimiter[T1]) Enter(req T1) error {
+	return l.enterContext(req.Context(), req)
+}
+
+func (l *adaptiveRateLimiter[T1]) enterContext(ctx context.Context, _ T1) error {
+	return l.bucket.wait(ctx)
+}
+
+func (l *adaptiveRateLimiter[T1]) Exit(_ T1, res *http.Response, _ error) {
+	if res == nil {
+		return
+	}
+
+	now := l.config.Clock.Now()
+	feedback := parseRateLimitFeedback(res, now)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := l.rate
+	switch {
+	case feedback.throttled:
+		rate *= l.config.Decrease
+	case feedback.quotaRate >= 0 && feedback.quotaRate < rate:
+		rate = feedback.quotaRate
+	default:
+		rate += l.config.Increase * now.Sub(l.lastIncrease).Seconds()
+	}
+	l.lastIncrease = now
+
+	l.setRate(rate)
+
+	if feedback.pauseUntil.After(now) {
+		l.bucket.pause(feedback.pauseUntil)
+	}
+}
+
+func (l *adaptiveRateLimiter[T1]) setRate(rate float64) {
+	rate = math.Max(l.config.MinRate, math.Min(l.config.MaxRate, rate))
+	if rate != l.rate {
+		l.rate = rate
+		l.bucket.setRate(rate)
+	}
+}
+
+type rateLimitFeedback struct {
+	throttled  bool
+	pauseUntil time.Time
+	quotaRate  float64
+}
+
+func parseRateLimitFeedback(res *http.Response, now time.Time) (feedback rateLimitFeedback) {
+	feedback.quotaRate = -1
+	feedback.throttled = res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
+
+	if until, ok := parseRetryAfter(res.Header.Get("Retry-After"), now); ok {
+		feedback.pauseUntil = until
+	}
+
+	remaining, reset, ok := parseXRateLimit(res.Header, now)
+	if !ok {
+		remaining, reset, ok = parseIETFRateLimit(res.Header, now)
+	}
+	if ok {
+		if remaining <= 0 {
+			feedback.throttled = true
+			if reset.After(feedback.pauseUntil) {
+				feedback.pauseUntil = reset
+			}
+		} else if window := reset.Sub(now); window > 0 {
+			feedback.quotaRate = remaining / window.Seconds()
+		}
+	}
+
+	return
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return now.Add(time.Duration(seconds * float64(time.Second))), true
+	}
+
+	if ts, err := http.ParseTime(value); err == nil {
+		return ts, true
+	}
+
+	return time.Time{}, false
+}
+
+func parseXRateLimit(header http.Header, now time.Time) (remaining float64, reset time.Time, ok bool) {
+	remaining, err := strconv.ParseFloat(header.Get("X-RateLimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+
+	resetValue, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset"), 64)
+	if err != nil {
+		return
+	}
+
+	// some servers send the epoch time of reset, others send the delay in seconds
+	if resetValue > 1e9 {
+		reset = time.Unix(0, int64(resetValue*float64(time.Second)))
+	} else {
+		reset = now.Add(time.Duration(resetValue * float64(time.Second)))
+	}
+
+	return remaining, reset, true
+}
+
+// parseIETFRateLimit supports both the separate RateLimit-Remaining / RateLimit-Reset fields and the structured
+// RateLimit field (e.g. `"default";r=50;t=30` or `limit=100, remaining=50, reset=30`), choosing the most strict policy.
+func parseIETFRateLimit(header http.Header, now time.Time) (remaining float64, reset time.Time, ok bool) {
+	if r, err := strconv.ParseFloat(header.Get("RateLimit-Remaining"), 64); err == nil {
+		if t, err := strconv.ParseFloat(header.Get("RateLimit-Reset"), 64); err == nil {
+			return r, now.Add(time.Duration(t * float64(time.Second))), true
+		}
+	}
+
+	value := header.Get("RateLimit")
+	if value == "" {
+		return
+	}
+
+	var policies []map[string]string
+	if strings.Contains(value, ";") {
+		for _, item := range strings.Split(value, ",") {
+			policies = append(policies, parseRateLimitParams(strings.Split(item, ";")))
+		}
+	} else {
+		policies = append(policies, parseRateLimitParams(strings.Split(value, ",")))
+	}
+
+	minRate := math.Inf(1)
+	for _, params := range policies {
+		r, err := strconv.ParseFloat(firstNonEmpty(params["r"], params["remaining"]), 64)
+		if err != nil {
+			continue
+		}
+		t, err := strconv.ParseFloat(firstNonEmpty(params["t"], params["reset"]), 64)
+		if err != nil {
+			continue
+		}
+
+		rate := math.Inf(1)
+		if t > 0 {
+			rate = r / t
+		}
+		if r <= 0 {
+			rate = -t
+		}
+
+		if !ok || rate < minRate {
+			remaining, reset, ok = r, now.Add(time.Duration(t*float64(time.Second))), true
+			minRate = rate
+		}
+	}
+
+	return
+}
+
+func parseRateLimitParams(parts []string) map[string]string {
+	params := map[string]string{}
+	for _, part := range parts {
+		if key, value, found := strings.Cut(strings.TrimSpace(part), "="); found {
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+
+	return params
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,133 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitFeedback(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   rateLimitFeedback
+	}{
+		{
+			name:   "ok without headers",
+			status: http.StatusOK,
+			want:   rateLimitFeedback{quotaRate: -1},
+		},
+		{
+			name:   "too many requests with retry after seconds",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": {"3"}},
+			want:   rateLimitFeedback{throttled: true, pauseUntil: now.Add(3 * time.Second), quotaRate: -1},
+		},
+		{
+			name:   "service unavailable with retry after date",
+			status: http.StatusServiceUnavailable,
+			header: http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}},
+			want:   rateLimitFeedback{throttled: true, pauseUntil: now.Add(time.Minute), quotaRate: -1},
+		},
+		{
+			name:   "x-ratelimit exhausted with epoch reset",
+			status: http.StatusOK,
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(now.Add(10*time.Second).Unix(), 10)},
+			},
+			want: rateLimitFeedback{throttled: true, pauseUntil: now.Add(10 * time.Second), quotaRate: -1},
+		},
+		{
+			name:   "x-ratelimit remaining with delta reset",
+			status: http.StatusOK,
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"20"},
+				"X-Ratelimit-Reset":     {"10"},
+			},
+			want: rateLimitFeedback{quotaRate: 2},
+		},
+		{
+			name:   "ietf separate fields",
+			status: http.StatusOK,
+			header: http.Header{
+				"Ratelimit-Remaining": {"5"},
+				"Ratelimit-Reset":     {"10"},
+			},
+			want: rateLimitFeedback{quotaRate: 0.5},
+		},
+		{
+			name:   "ietf structured field with the most strict policy",
+			status: http.StatusOK,
+			header: http.Header{"Ratelimit": {`"burst";r=50;t=10, "daily";r=10;t=100`}},
+			want:   rateLimitFeedback{quotaRate: 0.1},
+		},
+		{
+			name:   "ietf legacy combined field exhausted",
+			status: http.StatusOK,
+			header: http.Header{"Ratelimit": {"limit=100, remaining=0, reset=30"}},
+			want:   rateLimitFeedback{throttled: true, pauseUntil: now.Add(30 * time.Second), quotaRate: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRateLimitFeedback(&http.Response{StatusCode: tt.status, Header: tt.header}, now)
+
+			if got.throttled != tt.want.throttled || !got.pauseUntil.Equal(tt.want.pauseUntil) || got.quotaRate != tt.want.quotaRate {
+				t.Errorf("parseRateLimitFeedback() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	clock := newTestClock()
+	limiter := NewAdaptiveRateLimiter[*http.Request](
+		WithAdaptiveInitialRate(8),
+		WithAdaptiveRateBounds(1, 10),
+		WithAdaptiveIncrease(1),
+		WithAdaptiveClock(clock),
+	).(*adaptiveRateLimiter[*http.Request])
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost", nil)
+
+	if err := limiter.Enter(req); err != nil {
+		t.Errorf("Enter() error got = %v, want nil", err)
+	}
+	limiter.Exit(req, &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"2"}},
+	}, nil)
+
+	if limiter.rate != 4 {
+		t.Errorf("rate after throttling got = %v, want %v", limiter.rate, 4.0)
+	}
+
+	start := clock.Now()
+	if err := limiter.Enter(req); err != nil {
+		t.Errorf("Enter() error got = %v, want nil", err)
+	}
+	if elapsed := clock.Now().Sub(start); elapsed < 2*time.Second {
+		t.Errorf("Enter() elapsed after retry after got = %v, want at least %v", elapsed, 2*time.Second)
+	}
+
+	clock.Advance(3 * time.Second)
+	limiter.Exit(req, &http.Response{StatusCode: http.StatusOK}, nil)
+
+	if limiter.rate <= 4 {
+		t.Errorf("rate after recovery got = %v, want greater than %v", limiter.rate, 4.0)
+	}
+
+	clock.Advance(time.Minute)
+	limiter.Exit(req, &http.Response{StatusCode: http.StatusOK}, nil)
+
+	if limiter.rate != 10 {
+		t.Errorf("rate after full recovery got = %v, want %v", limiter.rate, 10.0)
+	}
+}
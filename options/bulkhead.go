@@ -0,0 +1,293 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/timer"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBulkheadMaxConcurrent     = uint(10)
+	DefaultBulkheadAdaptiveSmoothing = 0.2
+	DefaultBulkheadAdaptiveWindow    = uint(100)
+)
+
+// ErrRejected is returned by a saturated bulkhead, the request was not sent, so callers may shed load or fall back.
+var ErrRejected = errors.New("request rejected")
+
+func WithBulkhead[T1 netshaper.Request, T2 any](opts ...conf.Option[BulkheadConfig]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return &BulkheadClientConfig[T1, T2]{Inner: config, Bulkhead: conf.ApplyOptions(opts)}
+	})
+}
+
+func WithBulkheadMaxConcurrent(limit uint) conf.Option[BulkheadConfig] {
+	return conf.OptionFunc[BulkheadConfig](func(config BulkheadConfig) BulkheadConfig {
+		config.MaxConcurrent = limit
+		return config
+	})
+}
+
+func WithBulkheadQueue(size uint, maxWait time.Duration) conf.Option[BulkheadConfig] {
+	return conf.OptionFunc[BulkheadConfig](func(config BulkheadConfig) BulkheadConfig {
+		config.MaxQueue = size
+		config.MaxWait = maxWait
+		return config
+	})
+}
+
+// WithBulkheadAdaptiveLimit makes the concurrency limit follow the observed latency starting from MaxConcurrent.
+func WithBulkheadAdaptiveLimit(minLimit uint, maxLimit uint) conf.Option[BulkheadConfig] {
+	return conf.OptionFunc[BulkheadConfig](func(config BulkheadConfig) BulkheadConfig {
+		config.Adaptive = true
+		config.MinLimit = minLimit
+		config.MaxLimit = maxLimit
+		return config
+	})
+}
+
+func WithBulkheadClock(clock timer.Clock) conf.Option[BulkheadConfig] {
+	return conf.OptionFunc[BulkheadConfig](func(config BulkheadConfig) BulkheadConfig {
+		config.Clock = clock
+		return config
+	})
+}
+
+// BulkheadConfig bounds in-flight requests by MaxConcurrent. Up to MaxQueue requests wait for a free slot at most
+// MaxWait (zero means until the request context is done), other requests are rejected with ErrRejected.
+//
+// With Adaptive enabled the limit is adjusted in gradient style: it shrinks by the ratio of the minimal observed
+// latency to the current one and grows by sqrt(limit) while the latency stays close to the minimal.
+type BulkheadConfig struct {
+	MaxConcurrent uint
+	MaxQueue      uint
+	MaxWait       time.Duration
+	Adaptive      bool
+	MinLimit      uint
+	MaxLimit      uint
+	// Smoothing is the weight of a new limit estimation, (0, 1].
+	Smoothing float64
+	// Window is the amount of samples after which the minimal latency is measured again.
+	Window uint
+	Clock  timer.Clock
+}
+
+var _ netshaper.Config[*http.Request, string] = (*BulkheadClientConfig[*http.Request, string])(nil)
+
+type BulkheadClientConfig[T1 netshaper.Request, T2 any] struct {
+	Inner    netshaper.Config[T1, T2]
+	Bulkhead BulkheadConfig
+}
+
+func (c *BulkheadClientConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bulkheadClient[T1, T2]{inner, NewBulkhead(c.Bulkhead)}, nil
+}
+
+var _ netshaper.Client[*http.Request, string] = (*bulkheadClient[*http.Request, string])(nil)
+
+type bulkheadClient[T1 netshaper.Request, T2 any] struct {
+	inner    netshaper.Client[T1, T2]
+	bulkhead *Bulkhead
+}
+
+func (c *bulkheadClient[T1, T2]) Request(req T1) (res T2, err error) {
+	release, err := c.bulkhead.Acquire(req.Context())
+	if err != nil {
+		return
+	}
+
+	res, err = c.inner.Request(req)
+	release(err)
+
+	return
+}
+
+func (c *bulkheadClient[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
+
+func NewBulkhead(config BulkheadConfig) *Bulkhead {
+	if config.MaxConcurrent == 0 {
+		config.MaxConcurrent = DefaultBulkheadMaxConcurrent
+	}
+	if config.MinLimit == 0 {
+		config.MinLimit = 1
+	}
+	if config.MaxLimit < config.MaxConcurrent {
+		config.MaxLimit = config.MaxConcurrent
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = DefaultBulkheadAdaptiveSmoothing
+	}
+	if config.Window == 0 {
+		config.Window = DefaultBulkheadAdaptiveWindow
+	}
+	config.Clock = timer.OrSystem(config.Clock)
+
+	return &Bulkhead{
+		config: config,
+		limit:  float64(config.MaxConcurrent),
+	}
+}
+
+// Bulkhead is a semaphore with a bounded FIFO wait queue. It is safe for concurrent use.
+type Bulkhead struct {
+	config   BulkheadConfig
+	mu       sync.Mutex
+	limit    float64
+	inFlight uint
+	queue    []*bulkheadWaiter
+	minRtt   time.Duration
+	samples  uint
+}
+
+type bulkheadWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// Limit returns the current concurrency limit.
+func (b *Bulkhead) Limit() uint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentLimit()
+}
+
+func (b *Bulkhead) InFlight() uint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.inFlight
+}
+
+// Acquire takes a slot, waiting in the queue if needed. The caller must return the slot with the release func passing
+// the call outcome. An error wrapping ErrRejected is returned if the queue is full or the max wait time is exceeded.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(err error), err error) {
+	b.mu.Lock()
+
+	if len(b.queue) == 0 && b.inFlight < b.currentLimit() {
+		b.inFlight++
+		b.mu.Unlock()
+
+		return b.releaser(), nil
+	}
+
+	if uint(len(b.queue)) >= b.config.MaxQueue {
+		inFlight := b.inFlight
+		b.mu.Unlock()
+
+		return nil, fmt.Errorf("%w: bulkhead is full, %v requests in flight", ErrRejected, inFlight)
+	}
+
+	w := &bulkheadWaiter{ready: make(chan struct{})}
+	b.queue = append(b.queue, w)
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if b.config.MaxWait > 0 {
+		t := b.config.Clock.NewTimer(b.config.MaxWait)
+		defer t.Stop()
+		timeout = t.Ticks()
+	}
+
+	select {
+	case <-w.ready:
+		return b.releaser(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = fmt.Errorf("%w: bulkhead max wait time exceeded %v", ErrRejected, b.config.MaxWait)
+	}
+
+	b.mu.Lock()
+	if w.granted {
+		// the slot was granted concurrently with the cancellation - pass it to the next waiter
+		b.mu.Unlock()
+		b.release(0, context.Canceled)
+
+		return nil, err
+	}
+	b.removeWaiter(w)
+	b.mu.Unlock()
+
+	return nil, err
+}
+
+func (b *Bulkhead) releaser() func(err error) {
+	start := b.config.Clock.Now()
+	var once sync.Once
+
+	return func(err error) {
+		once.Do(func() {
+			b.release(b.config.Clock.Now().Sub(start), err)
+		})
+	}
+}
+
+func (b *Bulkhead) release(rtt time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.config.Adaptive && !errors.Is(err, context.Canceled) {
+		b.adapt(rtt)
+	}
+	b.inFlight--
+
+	for len(b.queue) > 0 && b.inFlight < b.currentLimit() {
+		w := b.queue[0]
+		b.queue = b.queue[1:]
+		w.granted = true
+		b.inFlight++
+		close(w.ready)
+	}
+}
+
+func (b *Bulkhead) adapt(rtt time.Duration) {
+	if b.samples >= b.config.Window {
+		b.minRtt, b.samples = 0, 0
+	}
+	b.samples++
+
+	if rtt <= 0 {
+		return
+	}
+	if b.minRtt == 0 || rtt < b.minRtt {
+		b.minRtt = rtt
+	}
+
+	gradient := math.Max(0.5, math.Min(1, float64(b.minRtt)/float64(rtt)))
+	estimation := b.limit * gradient
+	if gradient >= 1 && float64(b.inFlight) >= b.limit/2 {
+		// latency is not growing and the limit is actually used - probe a higher one
+		estimation += math.Sqrt(b.limit)
+	}
+
+	limit := b.limit*(1-b.config.Smoothing) + estimation*b.config.Smoothing
+	b.limit = math.Max(float64(b.config.MinLimit), math.Min(float64(b.config.MaxLimit), limit))
+}
+
+func (b *Bulkhead) currentLimit() uint {
+	return uint(b.limit)
+}
+
+func (b *Bulkhead) removeWaiter(w *bulkheadWaiter) {
+	for i, item := range b.queue {
+		if item == w {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"testing"
+	"time"
+)
+
+func TestBulkheadRejects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	release := make(chan struct{})
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		<-release
+		return "ok", nil
+	}}
+
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithBulkhead[*testRequest, string](WithBulkheadMaxConcurrent(2), WithBulkheadQueue(1, 0)),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, reqErr := cl.Request(&testRequest{ctx: ctx})
+			results <- reqErr
+		}()
+	}
+
+	// wait until 2 requests are in flight and the third one is queued
+	for inner.calls() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err = cl.Request(&testRequest{ctx: ctx}); !errors.Is(err, ErrRejected) {
+		t.Errorf("Request() error got = %v, want %v", err, ErrRejected)
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err = <-results; err != nil {
+			t.Errorf("Request() error got = %v, want nil", err)
+		}
+	}
+	if calls := inner.calls(); calls != 3 {
+		t.Errorf("inner requests amount got = %v, want %v", calls, 3)
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("max wait exceeded", func(t *testing.T) {
+		b := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1, MaxWait: time.Second, Clock: newTestClock()})
+
+		done, err := b.Acquire(ctx)
+		if err != nil {
+			t.Errorf("Acquire() error got = %v, want nil", err)
+			return
+		}
+		defer done(nil)
+
+		if _, err = b.Acquire(ctx); !errors.Is(err, ErrRejected) {
+			t.Errorf("Acquire() error got = %v, want %v", err, ErrRejected)
+		}
+	})
+
+	t.Run("context cancelled while waiting", func(t *testing.T) {
+		b := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1})
+
+		done, err := b.Acquire(ctx)
+		if err != nil {
+			t.Errorf("Acquire() error got = %v, want nil", err)
+			return
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		if _, err = b.Acquire(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Acquire() error got = %v, want %v", err, context.DeadlineExceeded)
+		}
+
+		done(nil)
+		if inFlight := b.InFlight(); inFlight != 0 {
+			t.Errorf("InFlight() got = %v, want 0", inFlight)
+		}
+	})
+
+	t.Run("slot is passed to the waiter", func(t *testing.T) {
+		b := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1})
+
+		done, err := b.Acquire(ctx)
+		if err != nil {
+			t.Errorf("Acquire() error got = %v, want nil", err)
+			return
+		}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			done(nil)
+		}()
+
+		waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		next, err := b.Acquire(waitCtx)
+		if err != nil {
+			t.Errorf("Acquire() error got = %v, want nil", err)
+			return
+		}
+		next(nil)
+	})
+}
+
+func TestBulkheadAdaptiveLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		wantLimit func(limit uint) bool
+	}{
+		{
+			name:      "stable latency increases the limit",
+			latencies: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+			wantLimit: func(limit uint) bool { return limit > 4 },
+		},
+		{
+			name:      "growing latency decreases the limit",
+			latencies: []time.Duration{10 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond},
+			wantLimit: func(limit uint) bool { return limit < 4 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			b := NewBulkhead(BulkheadConfig{
+				MaxConcurrent: 4,
+				Adaptive:      true,
+				MinLimit:      1,
+				MaxLimit:      100,
+				Smoothing:     0.5,
+				Clock:         clock,
+			})
+
+			for _, latency := range tt.latencies {
+				// keep the limit used, otherwise it is not increased
+				dones := make([]func(err error), 0, 4)
+				for i := uint(0); i < b.Limit(); i++ {
+					done, err := b.Acquire(context.Background())
+					if err != nil {
+						t.Errorf("Acquire() error got = %v, want nil", err)
+						return
+					}
+					dones = append(dones, done)
+				}
+
+				clock.Advance(latency)
+				dones[0](nil)
+				for _, done := range dones[1:] {
+					done(context.Canceled)
+				}
+			}
+
+			if limit := b.Limit(); !tt.wantLimit(limit) {
+				t.Errorf("Limit() got unexpected %v", limit)
+			}
+		})
+	}
+}
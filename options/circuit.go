@@ -0,0 +1,398 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"netshaper/conf"
+	"netshaper/timer"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCircuitWindow              = 10 * time.Second
+	DefaultCircuitWindowBuckets       = uint(10)
+	DefaultCircuitConsecutiveFailures = uint(5)
+	DefaultCircuitOpenTimeout         = 30 * time.Second
+	DefaultCircuitHalfOpenProbes      = uint(1)
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+func WithCircuit[T1 any, T2 any](opts ...conf.Option[CircuitConfig]) conf.Option[CircuitBreakerConfig[T1, T2]] {
+	return conf.OptionFunc[CircuitBreakerConfig[T1, T2]](func(config CircuitBreakerConfig[T1, T2]) CircuitBreakerConfig[T1, T2] {
+		cfg := conf.ApplyOptions(opts)
+		config.Circuit = &cfg
+		return config
+	})
+}
+
+func WithCircuitWindow(window time.Duration, buckets uint) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.Window = window
+		config.WindowBuckets = buckets
+		return config
+	})
+}
+
+func WithCircuitFailureRatio(ratio float64, minRequests uint) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.FailureRatio = ratio
+		config.MinRequests = minRequests
+		return config
+	})
+}
+
+func WithCircuitConsecutiveFailures(failures uint) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.ConsecutiveFailures = failures
+		return config
+	})
+}
+
+func WithCircuitOpenTimeout(timeout time.Duration) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.OpenTimeout = timeout
+		return config
+	})
+}
+
+func WithCircuitHalfOpenProbes(probes uint) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.HalfOpenProbes = probes
+		return config
+	})
+}
+
+func WithCircuitFailureCheck(isFailure func(err error) bool) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.IsFailure = isFailure
+		return config
+	})
+}
+
+func WithCircuitStateListener(listener func(from CircuitState, to CircuitState)) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.OnStateChange = listener
+		return config
+	})
+}
+
+func WithCircuitClock(clock timer.Clock) conf.Option[CircuitConfig] {
+	return conf.OptionFunc[CircuitConfig](func(config CircuitConfig) CircuitConfig {
+		config.Clock = clock
+		return config
+	})
+}
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitConfig describes when a Circuit trips. A circuit opens when either ConsecutiveFailures failures happen in a
+// row or, once at least MinRequests outcomes were recorded in the rolling Window, the failure ratio reaches
+// FailureRatio. Zero thresholds are disabled; if both are zero DefaultCircuitConsecutiveFailures is used.
+type CircuitConfig struct {
+	Window              time.Duration
+	WindowBuckets       uint
+	FailureRatio        float64
+	MinRequests         uint
+	ConsecutiveFailures uint
+	OpenTimeout         time.Duration
+	HalfOpenProbes      uint
+	IsFailure           func(err error) bool
+	OnStateChange       func(from CircuitState, to CircuitState)
+	Clock               timer.Clock
+}
+
+func NewCircuit(config CircuitConfig) *Circuit {
+	if config.Window <= 0 {
+		config.Window = DefaultCircuitWindow
+	}
+	if config.WindowBuckets == 0 {
+		config.WindowBuckets = DefaultCircuitWindowBuckets
+	}
+	if config.FailureRatio <= 0 && config.ConsecutiveFailures == 0 {
+		config.ConsecutiveFailures = DefaultCircuitConsecutiveFailures
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+	if config.HalfOpenProbes == 0 {
+		config.HalfOpenProbes = DefaultCircuitHalfOpenProbes
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isCircuitFailure
+	}
+	config.Clock = timer.OrSystem(config.Clock)
+
+	// windows shorter than their amount of buckets still have buckets of 1ns
+	bucketSize := config.Window / time.Duration(config.WindowBuckets)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+
+	return &Circuit{
+		config: config,
+		window: circuitWindow{
+			buckets:    make([]circuitBucket, config.WindowBuckets),
+			bucketSize: bucketSize,
+		},
+	}
+}
+
+// Circuit is a client-wide breaker state shared by all requests. It is safe for concurrent use.
+type Circuit struct {
+	config         CircuitConfig
+	mu             sync.Mutex
+	state          CircuitState
+	generation     uint64
+	window         circuitWindow
+	consecutive    uint
+	openedAt       time.Time
+	probes         uint
+	probeSuccesses uint
+	transitions    []circuitTransition
+}
+
+type circuitTransition struct {
+	from CircuitState
+	to   CircuitState
+}
+
+func (c *Circuit) State() CircuitState {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.refresh(c.config.Clock.Now())
+
+	return c.state
+}
+
+// Allow reserves a slot for a single call. It returns ErrCircuitOpen if the circuit is open (or half-open with all
+// probes in flight), otherwise the caller must report the call outcome with the returned done func. Calls cancelled
+// with context.Canceled are neither successes nor failures, they only free their slot.
+func (c *Circuit) Allow() (done func(err error), err error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.refresh(c.config.Clock.Now())
+
+	switch c.state {
+	case CircuitOpen:
+		return nil, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if c.probes >= c.config.HalfOpenProbes {
+			return nil, ErrCircuitOpen
+		}
+		c.probes++
+	}
+
+	generation := c.generation
+	var once sync.Once
+
+	return func(err error) {
+		once.Do(func() {
+			if errors.Is(err, context.Canceled) {
+				// the caller gave up, the call says nothing about the upstream
+				c.release(generation)
+				return
+			}
+
+			c.record(generation, c.config.IsFailure(err))
+		})
+	}, nil
+}
+
+// release frees the probe slot of a cancelled call without recording an outcome.
+func (c *Circuit) release(generation uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.refresh(c.config.Clock.Now())
+
+	if generation == c.generation && c.state == CircuitHalfOpen {
+		c.probes--
+	}
+}
+
+func (c *Circuit) record(generation uint64, failed bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := c.config.Clock.Now()
+	c.refresh(now)
+
+	if generation != c.generation {
+		// outcome of a call started in a previous state - ignore it
+		return
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		c.window.add(now, failed)
+		if !failed {
+			c.consecutive = 0
+			return
+		}
+
+		c.consecutive++
+		if c.shouldTrip(now) {
+			c.transit(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		c.probes--
+		if failed {
+			c.transit(CircuitOpen, now)
+			return
+		}
+
+		c.probeSuccesses++
+		if c.probeSuccesses >= c.config.HalfOpenProbes {
+			c.transit(CircuitClosed, now)
+		}
+	}
+}
+
+func (c *Circuit) shouldTrip(now time.Time) bool {
+	if limit := c.config.ConsecutiveFailures; limit > 0 && c.consecutive >= limit {
+		return true
+	}
+
+	if ratio := c.config.FailureRatio; ratio > 0 {
+		successes, failures := c.window.totals(now)
+		total := successes + failures
+		if total > 0 && total >= c.config.MinRequests && float64(failures)/float64(total) >= ratio {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Circuit) refresh(now time.Time) {
+	if c.state == CircuitOpen && !now.Before(c.openedAt.Add(c.config.OpenTimeout)) {
+		c.transit(CircuitHalfOpen, now)
+	}
+}
+
+func (c *Circuit) transit(state CircuitState, now time.Time) {
+	prev := c.state
+
+	c.state = state
+	c.generation++
+	c.consecutive = 0
+	c.probes = 0
+	c.probeSuccesses = 0
+
+	switch state {
+	case CircuitOpen:
+		c.openedAt = now
+	case CircuitClosed:
+		c.window.reset()
+	}
+
+	if prev != state {
+		c.transitions = append(c.transitions, circuitTransition{from: prev, to: state})
+	}
+}
+
+// unlock notifies the state listener of the transitions made under the lock after releasing it, so the listener may
+// call the circuit.
+func (c *Circuit) unlock() {
+	transitions := c.transitions
+	c.transitions = nil
+	c.mu.Unlock()
+
+	if listener := c.config.OnStateChange; listener != nil {
+		for _, transition := range transitions {
+			listener(transition.from, transition.to)
+		}
+	}
+}
+
+func isCircuitFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+type circuitWindow struct {
+	buckets    []circuitBucket
+	bucketSize time.Duration
+	head       int
+	headStart  time.Time
+}
+
+type circuitBucket struct {
+	successes uint
+	failures  uint
+}
+
+func (w *circuitWindow) add(now time.Time, failed bool) {
+	w.advance(now)
+
+	if failed {
+		w.buckets[w.head].failures++
+	} else {
+		w.buckets[w.head].successes++
+	}
+}
+
+func (w *circuitWindow) totals(now time.Time) (successes uint, failures uint) {
+	w.advance(now)
+
+	for _, b := range w.buckets {
+		successes += b.successes
+		failures += b.failures
+	}
+
+	return
+}
+
+func (w *circuitWindow) advance(now time.Time) {
+	if w.headStart.IsZero() {
+		w.headStart = now
+		return
+	}
+
+	steps := int(now.Sub(w.headStart) / w.bucketSize)
+	if steps <= 0 {
+		return
+	}
+
+	if steps >= len(w.buckets) {
+		w.reset()
+		w.headStart = now
+		return
+	}
+
+	for i := 0; i < steps; i++ {
+		w.head = (w.head + 1) % len(w.buckets)
+		w.buckets[w.head] = circuitBucket{}
+	}
+	w.headStart = w.headStart.Add(time.Duration(steps) * w.bucketSize)
+}
+
+func (w *circuitWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = circuitBucket{}
+	}
+	w.headStart = time.Time{}
+}
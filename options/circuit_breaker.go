@@ -2,9 +2,12 @@ package options
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"netshaper"
 	"netshaper/conf"
+	"netshaper/metrics"
 	"time"
 )
 
@@ -15,6 +18,15 @@ func WithCircuitBreaker[T1 any, T2 any](opts ...conf.Option[CircuitBreakerConfig
 	})
 }
 
+func WithRequestCloner[T1 any, T2 any](cloner RequestCloner[T1]) conf.Option[CircuitBreakerConfig[T1, T2]] {
+	return conf.OptionFunc[CircuitBreakerConfig[T1, T2]](func(config CircuitBreakerConfig[T1, T2]) CircuitBreakerConfig[T1, T2] {
+		config.Cloner = cloner
+		return config
+	})
+}
+
+// WithMaxRetriesLimit limits the amount of attempts including the first one, e.g. a limit of 3 sends a failing request
+// at most 3 times.
 func WithMaxRetriesLimit[T1 any, T2 any](limit uint) conf.Option[CircuitBreakerConfig[T1, T2]] {
 	if limit == 0 {
 		return nil
@@ -29,8 +41,8 @@ func WithMaxRetriesLimit[T1 any, T2 any](limit uint) conf.Option[CircuitBreakerC
 	})
 }
 
-func WithExponentialDelayRetries[T1 netshaper.Request, T2 any](initial time.Duration, mul time.Duration, maxDelay time.Duration) conf.Option[CircuitBreakerConfig[T1, T2]] {
-	if mul == 0 {
+func WithExponentialDelayRetries[T1 netshaper.Request, T2 any](initial time.Duration, mul float64, maxDelay time.Duration) conf.Option[CircuitBreakerConfig[T1, T2]] {
+	if mul <= 0 {
 		return nil
 	}
 
@@ -43,6 +55,8 @@ func WithExponentialDelayRetries[T1 netshaper.Request, T2 any](initial time.Dura
 	})
 }
 
+// CircuitBreaker decides whether another attempt is made. Next gets the request before it's cloned for the attempt and
+// returns the request for the next attempt, which may be rewritten, e.g. with another endpoint.
 type CircuitBreaker[T1 any, T2 any] interface {
 	Next(req T1, res T2, err error) (bool, T1, error)
 }
@@ -59,6 +73,12 @@ func (b *noopCircuitBreaker[T1, T2]) Next(req T1, _ T2, err error) (bool, T1, er
 	}
 }
 
+type singleAttemptCircuitBreaker[T1 any, T2 any] struct{}
+
+func (b *singleAttemptCircuitBreaker[T1, T2]) Next(req T1, _ T2, err error) (bool, T1, error) {
+	return false, req, err
+}
+
 type attemptLimitCircuitBreaker[I any, O any] struct {
 	inner      CircuitBreaker[I, O]
 	maxRetries uint
@@ -83,7 +103,7 @@ type exponentialDelayCircuitBreaker[T1 netshaper.Request, T2 any] struct {
 	inner    CircuitBreaker[T1, T2]
 	maxDelay time.Duration
 	delay    time.Duration
-	mul      time.Duration
+	mul      float64
 }
 
 func (b *exponentialDelayCircuitBreaker[T1, T2]) Next(req T1, res T2, err error) (bool, T1, error) {
@@ -99,7 +119,7 @@ func (b *exponentialDelayCircuitBreaker[T1, T2]) Next(req T1, res T2, err error)
 			break
 		}
 
-		b.delay *= b.mul
+		b.delay = time.Duration(float64(b.delay) * b.mul)
 		if b.maxDelay > 0 && b.delay > b.maxDelay {
 			b.delay = b.maxDelay
 		}
@@ -113,6 +133,8 @@ var _ netshaper.Config[int, string] = (*CircuitBreakerConfig[int, string])(nil)
 type CircuitBreakerConfig[T1 any, T2 any] struct {
 	Inner          netshaper.Config[T1, T2]
 	BreakerFactory func() CircuitBreaker[T1, T2]
+	Circuit        *CircuitConfig
+	Cloner         RequestCloner[T1]
 }
 
 func (c *CircuitBreakerConfig[T1, T2]) wrapFactory(wrapper func(inner CircuitBreaker[T1, T2]) CircuitBreaker[T1, T2]) {
@@ -134,11 +156,49 @@ func (c *CircuitBreakerConfig[T1, T2]) Create(ctx context.Context) (netshaper.Cl
 		return nil, err
 	}
 
-	if c.BreakerFactory == nil {
+	if c.BreakerFactory == nil && c.Circuit == nil {
 		return inner, nil
 	}
 
-	return &circuitBreakerClient[T1, T2]{inner, c.BreakerFactory}, nil
+	breakerFactory := c.BreakerFactory
+	if breakerFactory == nil {
+		breakerFactory = func() CircuitBreaker[T1, T2] {
+			return &singleAttemptCircuitBreaker[T1, T2]{}
+		}
+	}
+
+	m := metrics.FromContext(ctx)
+	logger := netshaper.LoggerFromContext(ctx)
+
+	var circuit *Circuit
+	if c.Circuit != nil {
+		circuit = NewCircuit(observeCircuit(*c.Circuit, m, logger))
+	}
+
+	cloner := c.Cloner
+	if cloner == nil {
+		cloner = defaultRequestCloner[T1]()
+	}
+
+	return &circuitBreakerClient[T1, T2]{inner, breakerFactory, circuit, cloner, m, logger}, nil
+}
+
+func observeCircuit(config CircuitConfig, m metrics.Metrics, logger *slog.Logger) CircuitConfig {
+	m.SetGauge(metrics.CircuitState, float64(CircuitClosed), nil)
+
+	listener := config.OnStateChange
+	config.OnStateChange = func(from CircuitState, to CircuitState) {
+		m.SetGauge(metrics.CircuitState, float64(to), nil)
+		m.AddCounter(metrics.CircuitTransitionsTotal, 1, metrics.Labels{metrics.LabelFrom: from.String(), metrics.LabelTo: to.String()})
+		logger.LogAttrs(context.Background(), slog.LevelWarn, "circuit state changed",
+			slog.String("from", from.String()), slog.String("to", to.String()))
+
+		if listener != nil {
+			listener(from, to)
+		}
+	}
+
+	return config
 }
 
 var _ netshaper.Client[int, string] = (*circuitBreakerClient[int, string])(nil)
@@ -146,18 +206,80 @@ var _ netshaper.Client[int, string] = (*circuitBreakerClient[int, string])(nil)
 type circuitBreakerClient[T1 any, T2 any] struct {
 	inner          netshaper.Client[T1, T2]
 	breakerFactory func() CircuitBreaker[T1, T2]
+	circuit        *Circuit
+	cloner         RequestCloner[T1]
+	metrics        metrics.Metrics
+	logger         *slog.Logger
 }
 
 func (c *circuitBreakerClient[T1, T2]) Request(req T1) (res T2, err error) {
 	breaker := c.breakerFactory()
+	var attemptErr error
 
-	for ok := true; ok; ok, req, err = breaker.Next(req, res, err) {
-		res, err = c.inner.Request(req)
+	for attempt, ok := uint(0), true; ok; attempt++ {
+		attemptReq, cloneErr := c.prepare(req, attempt)
+		if cloneErr != nil {
+			var zero T2
+			return zero, errors.Join(fmt.Errorf("failed to prepare request attempt %v: %w", attempt+1, cloneErr), attemptErr)
+		}
+
+		if attempt > 0 {
+			c.metrics.AddCounter(metrics.RetryAttemptsTotal, 1, nil)
+			attrs := []slog.Attr{slog.Uint64("attempt", uint64(attempt))}
+			if attemptErr != nil {
+				attrs = append(attrs, slog.Any("error", attemptErr))
+			}
+			c.logger.LogAttrs(requestContext(attemptReq), slog.LevelInfo, "retrying request", attrs...)
+		}
+
+		res, err = c.attempt(attemptReq)
+		if errors.Is(err, ErrCircuitOpen) {
+			// circuit is open - fail fast without consulting retries
+			return
+		}
+		attemptErr = err
+
+		// the breaker gets the request before cloning, the request it returns is cloned for the next attempt
+		ok, req, err = breaker.Next(req, res, err)
+		if ok {
+			discardResponse(res)
+		}
 	}
 
 	return
 }
 
+// prepare returns a copy of the request returned by the breaker for each attempt, so the body is rewound and changes
+// made by inner decorators do not accumulate. The original request is sent as is on the first attempt if it can not be cloned.
+func (c *circuitBreakerClient[T1, T2]) prepare(req T1, attempt uint) (T1, error) {
+	if c.cloner == nil {
+		return req, nil
+	}
+
+	clone, err := c.cloner(ContextWithRetryAttempt(requestContext(req), attempt), req)
+	if err != nil && attempt == 0 {
+		return req, nil
+	}
+
+	return clone, err
+}
+
+func (c *circuitBreakerClient[T1, T2]) attempt(req T1) (res T2, err error) {
+	if c.circuit == nil {
+		return c.inner.Request(req)
+	}
+
+	done, err := c.circuit.Allow()
+	if err != nil {
+		return
+	}
+
+	res, err = c.inner.Request(req)
+	done(err)
+
+	return
+}
+
 func (c *circuitBreakerClient[T1, T2]) Close(ctx context.Context) {
 	c.inner.Close(ctx)
 }
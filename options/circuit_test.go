@@ -0,0 +1,266 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitStates(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		config     CircuitConfig
+		steps      []error
+		advance    time.Duration
+		wantStates []CircuitState
+	}{
+		{
+			name:       "closed on successes",
+			config:     CircuitConfig{ConsecutiveFailures: 2},
+			steps:      []error{nil, nil, nil},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed},
+		},
+		{
+			name:       "open after consecutive failures",
+			config:     CircuitConfig{ConsecutiveFailures: 2},
+			steps:      []error{errFailed, nil, errFailed, errFailed, nil},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed, CircuitOpen, CircuitOpen},
+		},
+		{
+			name:       "open after failure ratio",
+			config:     CircuitConfig{FailureRatio: 0.5, MinRequests: 4},
+			steps:      []error{nil, errFailed, nil, errFailed},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed, CircuitOpen},
+		},
+		{
+			name:       "failures outside of window are forgotten",
+			config:     CircuitConfig{FailureRatio: 0.5, MinRequests: 2, Window: time.Second, WindowBuckets: 2},
+			steps:      []error{errFailed, nil, nil},
+			advance:    2 * time.Second,
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed},
+		},
+		{
+			name:       "cancellations between failures do not reset consecutive failures",
+			config:     CircuitConfig{ConsecutiveFailures: 2},
+			steps:      []error{errFailed, context.Canceled, context.Canceled, errFailed},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed, CircuitOpen},
+		},
+		{
+			name:       "cancellations are not successes in the window",
+			config:     CircuitConfig{FailureRatio: 0.5, MinRequests: 2},
+			steps:      []error{nil, context.Canceled, context.Canceled, errFailed},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed, CircuitOpen},
+		},
+		{
+			name:       "window with more buckets than nanoseconds",
+			config:     CircuitConfig{ConsecutiveFailures: 2, Window: 2, WindowBuckets: 10},
+			steps:      []error{errFailed, nil, errFailed},
+			advance:    time.Second,
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed, CircuitClosed},
+		},
+		{
+			name:       "context cancellation is not a failure",
+			config:     CircuitConfig{ConsecutiveFailures: 1},
+			steps:      []error{context.Canceled, context.Canceled},
+			wantStates: []CircuitState{CircuitClosed, CircuitClosed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			tt.config.Clock = clock
+			circuit := NewCircuit(tt.config)
+
+			gotStates := []CircuitState{}
+			for _, stepErr := range tt.steps {
+				if done, err := circuit.Allow(); err == nil {
+					done(stepErr)
+				}
+				clock.Advance(tt.advance)
+				gotStates = append(gotStates, circuit.State())
+			}
+
+			if !reflect.DeepEqual(gotStates, tt.wantStates) {
+				t.Errorf("Circuit.State() got = %v, want %v", gotStates, tt.wantStates)
+			}
+		})
+	}
+}
+
+func TestCircuitHalfOpen(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	clock := newTestClock()
+	var transitions []CircuitState
+	circuit := NewCircuit(CircuitConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Second,
+		HalfOpenProbes:      2,
+		Clock:               clock,
+		OnStateChange: func(_ CircuitState, to CircuitState) {
+			transitions = append(transitions, to)
+		},
+	})
+
+	done, _ := circuit.Allow()
+	done(errFailed)
+
+	if _, err := circuit.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Circuit.Allow() error got = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	clock.Advance(time.Second)
+
+	probe1, err := circuit.Allow()
+	if err != nil {
+		t.Errorf("Circuit.Allow() first probe error got = %v, want nil", err)
+	}
+	probe2, err := circuit.Allow()
+	if err != nil {
+		t.Errorf("Circuit.Allow() second probe error got = %v, want nil", err)
+	}
+	if _, err = circuit.Allow(); err != ErrCircuitOpen {
+		t.Errorf("Circuit.Allow() third probe error got = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	probe1(nil)
+	if state := circuit.State(); state != CircuitHalfOpen {
+		t.Errorf("Circuit.State() after first probe got = %v, want %v", state, CircuitHalfOpen)
+	}
+	probe2(nil)
+	if state := circuit.State(); state != CircuitClosed {
+		t.Errorf("Circuit.State() after second probe got = %v, want %v", state, CircuitClosed)
+	}
+
+	// stale outcome of a call started before circuit was closed must be ignored
+	probe1(errFailed)
+	if state := circuit.State(); state != CircuitClosed {
+		t.Errorf("Circuit.State() after stale outcome got = %v, want %v", state, CircuitClosed)
+	}
+
+	wantTransitions := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if !reflect.DeepEqual(transitions, wantTransitions) {
+		t.Errorf("Circuit transitions got = %v, want %v", transitions, wantTransitions)
+	}
+}
+
+func TestCircuitHalfOpenCancelledProbe(t *testing.T) {
+	clock := newTestClock()
+	circuit := NewCircuit(CircuitConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Second,
+		HalfOpenProbes:      1,
+		Clock:               clock,
+	})
+
+	done, _ := circuit.Allow()
+	done(errors.New("failed"))
+	clock.Advance(time.Second)
+
+	probe, err := circuit.Allow()
+	if err != nil {
+		t.Errorf("Circuit.Allow() probe error got = %v, want nil", err)
+		return
+	}
+	probe(context.Canceled)
+
+	if state := circuit.State(); state != CircuitHalfOpen {
+		t.Errorf("Circuit.State() after cancelled probe got = %v, want %v", state, CircuitHalfOpen)
+	}
+	// the slot of the cancelled probe is free again
+	if _, err = circuit.Allow(); err != nil {
+		t.Errorf("Circuit.Allow() next probe error got = %v, want nil", err)
+	}
+}
+
+func TestCircuitStateListenerCallsCircuit(t *testing.T) {
+	var circuit *Circuit
+	var states []CircuitState
+	circuit = NewCircuit(CircuitConfig{
+		ConsecutiveFailures: 1,
+		Clock:               newTestClock(),
+		OnStateChange: func(_ CircuitState, _ CircuitState) {
+			_, err := circuit.Allow()
+			if err != ErrCircuitOpen {
+				t.Errorf("Circuit.Allow() in listener error got = %v, want %v", err, ErrCircuitOpen)
+			}
+			states = append(states, circuit.State())
+		},
+	})
+
+	done, _ := circuit.Allow()
+	done(errors.New("failed"))
+
+	wantStates := []CircuitState{CircuitOpen}
+	if !reflect.DeepEqual(states, wantStates) {
+		t.Errorf("Circuit.State() in listener got = %v, want %v", states, wantStates)
+	}
+}
+
+func TestCircuitBreakerClientFailsFast(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	inner := &testClientConfig[int, string]{fn: func(_ int) (string, error) {
+		return "", errFailed
+	}}
+
+	cl, err := netshaper.NewClient[int, string](ctx,
+		testConfigOption[int, string](inner),
+		WithCircuitBreaker(
+			WithMaxRetriesLimit[int, string](3),
+			WithCircuit[int, string](WithCircuitConsecutiveFailures(2)),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	// circuit opens on the second attempt and the third attempt fails fast
+	if _, err = cl.Request(1); err != ErrCircuitOpen {
+		t.Errorf("Request() error got = %v, want %v", err, ErrCircuitOpen)
+	}
+	if _, err = cl.Request(2); err != ErrCircuitOpen {
+		t.Errorf("Request() error got = %v, want %v", err, ErrCircuitOpen)
+	}
+	if got := inner.calls(); got != 2 {
+		t.Errorf("inner requests amount got = %v, want %v", got, 2)
+	}
+}
+
+func TestMaxRetriesLimitAttempts(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	for _, limit := range []uint{1, 2, 3} {
+		inner := &testClientConfig[int, string]{fn: func(_ int) (string, error) {
+			return "", errFailed
+		}}
+
+		cl, err := netshaper.NewClient[int, string](ctx,
+			testConfigOption[int, string](inner),
+			WithCircuitBreaker(WithMaxRetriesLimit[int, string](limit)),
+		)
+		if err != nil {
+			t.Errorf("NewClient() error got = %v, want nil", err)
+			return
+		}
+
+		if _, err = cl.Request(1); !errors.Is(err, errFailed) {
+			t.Errorf("Request() error got = %v, want %v", err, errFailed)
+		}
+		if got := inner.calls(); got != int(limit) {
+			t.Errorf("inner requests amount with limit %v got = %v, want %v", limit, got, limit)
+		}
+
+		cl.Close(ctx)
+	}
+}
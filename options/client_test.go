@@ -0,0 +1,46 @@
+package options
+
+import (
+	"context"
+	"netshaper"
+	"netshaper/conf"
+	"sync"
+)
+
+func testConfigOption[T1 any, T2 any](config netshaper.Config[T1, T2]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(_ netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return config
+	})
+}
+
+var _ netshaper.Config[int, string] = (*testClientConfig[int, string])(nil)
+var _ netshaper.Client[int, string] = (*testClientConfig[int, string])(nil)
+
+// testClientConfig is a config and a client at the same time, it records every request passed to fn.
+type testClientConfig[T1 any, T2 any] struct {
+	fn       func(req T1) (T2, error)
+	mu       sync.Mutex
+	requests []T1
+}
+
+func (c *testClientConfig[T1, T2]) Create(_ context.Context) (netshaper.Client[T1, T2], error) {
+	return c, nil
+}
+
+func (c *testClientConfig[T1, T2]) Request(req T1) (T2, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
+
+	return c.fn(req)
+}
+
+func (c *testClientConfig[T1, T2]) Close(_ context.Context) {
+}
+
+func (c *testClientConfig[T1, T2]) calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.requests)
+}
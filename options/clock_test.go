@@ -0,0 +1,57 @@
+package options
+
+import (
+	"netshaper/timer"
+	"sync"
+	"time"
+)
+
+var _ timer.Clock = (*testClock)(nil)
+
+// testClock is a virtual clock: timers fire immediately and advance the clock by their duration.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) timer.Timer {
+	now := c.Advance(d)
+
+	ticks := make(chan time.Time, 1)
+	ticks <- now
+
+	return &testTimer{ticks}
+}
+
+func (c *testClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+
+	return c.now
+}
+
+type testTimer struct {
+	ticks chan time.Time
+}
+
+func (t *testTimer) Ticks() <-chan time.Time {
+	return t.ticks
+}
+
+func (t *testTimer) Stop() {
+}
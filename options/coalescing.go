@@ -0,0 +1,338 @@
+package options
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"strings"
+	"sync"
+)
+
+// DefaultCoalescingMaxBodySize limits the response body buffered by HttpResponseSharer.
+const DefaultCoalescingMaxBodySize = 10 << 20
+
+// ErrResponseNotShared is returned by a ResponseSharer along with the func returning the response to the first caller
+// only, the other callers send their own requests.
+var ErrResponseNotShared = errors.New("response is not shared")
+
+// DefaultCoalescingHeaders are the request headers that may change a response, requests differing in them are not
+// coalesced by HttpCoalescingKey.
+var DefaultCoalescingHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"}
+
+func WithCoalescing[T1 netshaper.Request, T2 any](opts ...conf.Option[CoalescingConfig[T1, T2]]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		cfg := conf.ApplyOptionsInit(opts, CoalescingConfig[T1, T2]{Inner: config})
+		return &cfg
+	})
+}
+
+// WithCoalescingKey sets the key of identical requests, requests with an empty key are never coalesced.
+func WithCoalescingKey[T1 netshaper.Request, T2 any](key func(req T1) string) conf.Option[CoalescingConfig[T1, T2]] {
+	return conf.OptionFunc[CoalescingConfig[T1, T2]](func(config CoalescingConfig[T1, T2]) CoalescingConfig[T1, T2] {
+		config.Key = key
+		return config
+	})
+}
+
+func WithCoalescingSharer[T1 netshaper.Request, T2 any](sharer ResponseSharer[T2]) conf.Option[CoalescingConfig[T1, T2]] {
+	return conf.OptionFunc[CoalescingConfig[T1, T2]](func(config CoalescingConfig[T1, T2]) CoalescingConfig[T1, T2] {
+		config.Sharer = sharer
+		return config
+	})
+}
+
+func WithCoalescingCloner[T1 netshaper.Request, T2 any](cloner RequestCloner[T1]) conf.Option[CoalescingConfig[T1, T2]] {
+	return conf.OptionFunc[CoalescingConfig[T1, T2]](func(config CoalescingConfig[T1, T2]) CoalescingConfig[T1, T2] {
+		config.Cloner = cloner
+		return config
+	})
+}
+
+// ResponseSharer prepares a response to be returned to several callers, the returned func is called once per caller.
+type ResponseSharer[T2 any] func(res T2) (func() T2, error)
+
+// HttpResponseSharer buffers the response body, so every caller gets a response copy with an independent body reader.
+// Bodies larger than DefaultCoalescingMaxBodySize are not shared.
+func HttpResponseSharer(res *http.Response) (func() *http.Response, error) {
+	return NewHttpResponseSharer(DefaultCoalescingMaxBodySize)(res)
+}
+
+// NewHttpResponseSharer returns HttpResponseSharer buffering at most maxBodySize bytes, larger responses are returned
+// to the first caller only.
+func NewHttpResponseSharer(maxBodySize int64) ResponseSharer[*http.Response] {
+	return func(res *http.Response) (func() *http.Response, error) {
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize+1))
+		if err != nil {
+			_ = res.Body.Close()
+			return nil, err
+		}
+
+		if int64(len(body)) > maxBodySize {
+			res.Body = &struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+
+			return func() *http.Response {
+				return res
+			}, ErrResponseNotShared
+		}
+		_ = res.Body.Close()
+
+		return func() *http.Response {
+			clone := *res
+			clone.Header = res.Header.Clone()
+			clone.Trailer = res.Trailer.Clone()
+			clone.Body = io.NopCloser(bytes.NewReader(body))
+
+			return &clone
+		}, nil
+	}
+}
+
+// HttpCoalescingKey keys requests with safe methods by method, URL and the values of the given headers
+// (DefaultCoalescingHeaders if none given). Requests with other methods are not coalesced.
+func HttpCoalescingKey(headers ...string) func(req *http.Request) string {
+	if len(headers) == 0 {
+		headers = DefaultCoalescingHeaders
+	}
+
+	return func(req *http.Request) string {
+		switch req.Method {
+		case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			return ""
+		}
+
+		var b strings.Builder
+		b.WriteString(req.Method)
+		b.WriteString(" ")
+		b.WriteString(req.URL.String())
+
+		for _, name := range headers {
+			b.WriteString("\n")
+			b.WriteString(name)
+			b.WriteString(": ")
+			b.WriteString(strings.Join(req.Header.Values(name), ", "))
+		}
+
+		return b.String()
+	}
+}
+
+var _ netshaper.Config[*http.Request, string] = (*CoalescingConfig[*http.Request, string])(nil)
+
+// CoalescingConfig shares a single in-flight call among all concurrent requests with the same key. The shared call is
+// sent with a copy of the first request bound to a context that keeps its values but is cancelled only when all
+// waiting callers are gone. Without a cloner the first request is sent as is, so its cancellation fails all callers.
+type CoalescingConfig[T1 netshaper.Request, T2 any] struct {
+	Inner  netshaper.Config[T1, T2]
+	Key    func(req T1) string
+	Sharer ResponseSharer[T2]
+	Cloner RequestCloner[T1]
+}
+
+func (c *CoalescingConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	key := c.Key
+	if key == nil {
+		key = defaultCoalescingKey[T1]()
+	}
+	if key == nil {
+		var req T1
+		return nil, fmt.Errorf("coalescing requires a request key for %T", req)
+	}
+
+	sharer := c.Sharer
+	if sharer == nil {
+		sharer = defaultResponseSharer[T2]()
+	}
+
+	cloner := c.Cloner
+	if cloner == nil {
+		cloner = defaultRequestCloner[T1]()
+	}
+
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coalescingClient[T1, T2]{
+		inner:  inner,
+		key:    key,
+		sharer: sharer,
+		cloner: cloner,
+		calls:  map[string]*coalescedCall[T2]{},
+	}, nil
+}
+
+var _ netshaper.Client[*http.Request, string] = (*coalescingClient[*http.Request, string])(nil)
+
+type coalescingClient[T1 netshaper.Request, T2 any] struct {
+	inner  netshaper.Client[T1, T2]
+	key    func(req T1) string
+	sharer ResponseSharer[T2]
+	cloner RequestCloner[T1]
+	mu     sync.Mutex
+	calls  map[string]*coalescedCall[T2]
+}
+
+type coalescedCall[T2 any] struct {
+	done    chan struct{}
+	share   func() T2
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+	// exclusive response is returned to the leader (the first caller) only
+	exclusive  bool
+	leaderGone bool
+}
+
+func (c *coalescingClient[T1, T2]) Request(req T1) (res T2, err error) {
+	key := c.key(req)
+	if key == "" {
+		return c.inner.Request(req)
+	}
+	if err = req.Context().Err(); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+		call = &coalescedCall[T2]{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = call
+
+		go c.run(ctx, key, call, req)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	leader := !ok
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return res, call.err
+		}
+		if call.exclusive && !leader {
+			return c.inner.Request(req)
+		}
+
+		return call.share(), nil
+	case <-req.Context().Done():
+		c.leave(key, call, leader)
+		return res, req.Context().Err()
+	}
+}
+
+func (c *coalescingClient[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
+
+func (c *coalescingClient[T1, T2]) run(ctx context.Context, key string, call *coalescedCall[T2], req T1) {
+	shared := req
+	if c.cloner != nil {
+		if clone, err := c.cloner(ctx, req); err == nil {
+			shared = clone
+		}
+	}
+
+	res, err := c.inner.Request(shared)
+	if err == nil {
+		call.share, err = c.sharer(res)
+		if errors.Is(err, ErrResponseNotShared) {
+			call.exclusive, err = true, nil
+		}
+	} else {
+		discardResponse(res)
+	}
+	// the sharer has read the response, so the shared call context is released
+	call.cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	if err == nil && (call.waiters == 0 || (call.exclusive && call.leaderGone)) {
+		// all callers (or the only one to get the response) are gone
+		discardResponse(call.share())
+	}
+
+	call.err = err
+	close(call.done)
+}
+
+func (c *coalescingClient[T1, T2]) leave(key string, call *coalescedCall[T2], leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	call.waiters--
+	if leader {
+		call.leaderGone = true
+
+		select {
+		case <-call.done:
+			if call.err == nil && call.exclusive {
+				// the response was left by the leader after the call finished
+				discardResponse(call.share())
+			}
+		default:
+		}
+	}
+	if call.waiters > 0 {
+		return
+	}
+
+	select {
+	case <-call.done:
+	default:
+		call.cancel()
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+	}
+}
+
+func defaultCoalescingKey[T1 any]() func(req T1) string {
+	var req T1
+	if _, ok := any(req).(*http.Request); !ok {
+		return nil
+	}
+
+	key := HttpCoalescingKey()
+
+	return func(req T1) string {
+		return key(any(req).(*http.Request))
+	}
+}
+
+func defaultResponseSharer[T2 any]() ResponseSharer[T2] {
+	var res T2
+	if _, ok := any(res).(*http.Response); ok {
+		return func(res T2) (func() T2, error) {
+			share, err := HttpResponseSharer(any(res).(*http.Response))
+			if err != nil {
+				return nil, err
+			}
+
+			return func() T2 {
+				return any(share()).(T2)
+			}, nil
+		}
+	}
+
+	return func(res T2) (func() T2, error) {
+		return func() T2 {
+			return res
+		}, nil
+	}
+}
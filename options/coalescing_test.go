@@ -0,0 +1,139 @@
+package options
+
+import (
+	"context"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalescingRequest(t *testing.T) {
+	const waiters = 5
+
+	tests := []struct {
+		name          string
+		method        string
+		sharer        ResponseSharer[*http.Response]
+		cancelWaiters int
+		wantCalls     int
+		wantCancelled bool
+	}{
+		{
+			name:      "identical requests share a call",
+			method:    netHttp.MethodGet,
+			wantCalls: 1,
+		},
+		{
+			name:          "cancelled waiter does not cancel the shared call",
+			method:        netHttp.MethodGet,
+			cancelWaiters: 2,
+			wantCalls:     1,
+		},
+		{
+			name:          "shared call is cancelled when all waiters are gone",
+			method:        netHttp.MethodGet,
+			cancelWaiters: waiters,
+			wantCalls:     1,
+			wantCancelled: true,
+		},
+		{
+			name:      "responses over the body size limit are not shared",
+			method:    netHttp.MethodGet,
+			sharer:    NewHttpResponseSharer(2),
+			wantCalls: waiters,
+		},
+		{
+			name:      "unsafe requests are not coalesced",
+			method:    netHttp.MethodPost,
+			wantCalls: waiters,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			release := make(chan struct{})
+			cancelled := make(chan struct{}, waiters)
+			inner := &testClientConfig[*http.Request, *http.Response]{fn: func(req *http.Request) (*http.Response, error) {
+				select {
+				case <-release:
+				case <-req.Context().Done():
+					cancelled <- struct{}{}
+					return nil, req.Context().Err()
+				}
+
+				return &http.Response{StatusCode: netHttp.StatusOK, Header: netHttp.Header{}, Body: io.NopCloser(strings.NewReader("hey"))}, nil
+			}}
+
+			cl, err := netshaper.NewClient[*http.Request, *http.Response](ctx,
+				testConfigOption[*http.Request, *http.Response](inner),
+				WithCoalescing(WithCoalescingSharer[*http.Request](tt.sharer)),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			var wg sync.WaitGroup
+			bodies := make(chan string, waiters)
+			cancels := make([]context.CancelFunc, 0, waiters)
+			for i := 0; i < waiters; i++ {
+				reqCtx, reqCancel := context.WithCancel(ctx)
+				defer reqCancel()
+				cancels = append(cancels, reqCancel)
+
+				req, _ := http.NewRequest(reqCtx, tt.method, netshaper.URL{Scheme: "http", Host: "localhost", Path: "/"}, nil, nil)
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					res, reqErr := cl.Request(req)
+					if reqErr != nil {
+						return
+					}
+					body, _ := io.ReadAll(res.Body)
+					bodies <- string(body)
+				}()
+			}
+
+			// let all waiters join the call, then some of them leave
+			time.Sleep(20 * time.Millisecond)
+			for _, reqCancel := range cancels[:tt.cancelWaiters] {
+				reqCancel()
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(bodies)
+
+			got := 0
+			for body := range bodies {
+				got++
+				if body != "hey" {
+					t.Errorf("Request() body got = %q, want %q", body, "hey")
+				}
+			}
+			if want := waiters - tt.cancelWaiters; got != want {
+				t.Errorf("Request() responses got = %v, want %v", got, want)
+			}
+			if calls := inner.calls(); calls != tt.wantCalls {
+				t.Errorf("inner requests amount got = %v, want %v", calls, tt.wantCalls)
+			}
+			if gotCancelled := len(cancelled) > 0; gotCancelled != tt.wantCancelled {
+				t.Errorf("shared call cancelled got = %v, want %v", gotCancelled, tt.wantCancelled)
+			}
+			if tt.method == netHttp.MethodGet && inner.requests[0].Context().Err() == nil {
+				t.Errorf("shared call context must be done once the call finished")
+			}
+		})
+	}
+}
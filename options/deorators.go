@@ -53,6 +53,10 @@ func (fn PreProcessingFunc[T1, T2]) Exit(_ T1, res T2, err error) (T2, error) {
 	return res, err
 }
 
+func (fn PreProcessingFunc[T1, T2]) Intercept(req T1, next func(req T1) (T2, error)) (T2, error) {
+	return next(fn(req))
+}
+
 type PostProcessingFunc[T1 netshaper.Request, T2 any] func(req T1, res T2, err error) (T2, error)
 
 func (fn PostProcessingFunc[T1, T2]) Enter(req T1) T1 {
@@ -62,3 +66,8 @@ func (fn PostProcessingFunc[T1, T2]) Enter(req T1) T1 {
 func (fn PostProcessingFunc[T1, T2]) Exit(req T1, res T2, err error) (T2, error) {
 	return fn(req, res, err)
 }
+
+func (fn PostProcessingFunc[T1, T2]) Intercept(req T1, next func(req T1) (T2, error)) (T2, error) {
+	res, err := next(req)
+	return fn(req, res, err)
+}
@@ -0,0 +1,284 @@
+package options
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/timer"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHedgingDelay       = 100 * time.Millisecond
+	DefaultHedgingMaxAttempts = uint(2)
+	DefaultHedgingSamples     = uint(100)
+)
+
+func WithHedging[T1 netshaper.Request, T2 any](opts ...conf.Option[HedgingConfig[T1, T2]]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		cfg := conf.ApplyOptionsInit(opts, HedgingConfig[T1, T2]{Inner: config})
+		return &cfg
+	})
+}
+
+func WithHedgingDelay[T1 netshaper.Request, T2 any](delay time.Duration) conf.Option[HedgingConfig[T1, T2]] {
+	return conf.OptionFunc[HedgingConfig[T1, T2]](func(config HedgingConfig[T1, T2]) HedgingConfig[T1, T2] {
+		config.Delay = delay
+		return config
+	})
+}
+
+// WithHedgingPercentile sets the hedging delay to the latency percentile (e.g. 0.95) of the last successful requests.
+// The fixed delay is used until the samples amount is collected.
+func WithHedgingPercentile[T1 netshaper.Request, T2 any](percentile float64, samples uint) conf.Option[HedgingConfig[T1, T2]] {
+	return conf.OptionFunc[HedgingConfig[T1, T2]](func(config HedgingConfig[T1, T2]) HedgingConfig[T1, T2] {
+		config.Percentile = percentile
+		config.Samples = samples
+		return config
+	})
+}
+
+func WithHedgingMaxAttempts[T1 netshaper.Request, T2 any](attempts uint) conf.Option[HedgingConfig[T1, T2]] {
+	return conf.OptionFunc[HedgingConfig[T1, T2]](func(config HedgingConfig[T1, T2]) HedgingConfig[T1, T2] {
+		config.MaxAttempts = attempts
+		return config
+	})
+}
+
+func WithHedgingCloner[T1 netshaper.Request, T2 any](cloner RequestCloner[T1]) conf.Option[HedgingConfig[T1, T2]] {
+	return conf.OptionFunc[HedgingConfig[T1, T2]](func(config HedgingConfig[T1, T2]) HedgingConfig[T1, T2] {
+		config.Cloner = cloner
+		return config
+	})
+}
+
+func WithHedgingClock[T1 netshaper.Request, T2 any](clock timer.Clock) conf.Option[HedgingConfig[T1, T2]] {
+	return conf.OptionFunc[HedgingConfig[T1, T2]](func(config HedgingConfig[T1, T2]) HedgingConfig[T1, T2] {
+		config.Clock = clock
+		return config
+	})
+}
+
+var _ netshaper.Config[*http.Request, string] = (*HedgingConfig[*http.Request, string])(nil)
+
+// HedgingConfig describes hedged requests: if an attempt is not completed after the delay (or failed) another one is
+// sent in parallel, up to MaxAttempts in total. The first successful response wins, other attempts are cancelled via
+// their request contexts, so Cloner must bind the request copy to the given context.
+type HedgingConfig[T1 netshaper.Request, T2 any] struct {
+	Inner       netshaper.Config[T1, T2]
+	Delay       time.Duration
+	Percentile  float64
+	Samples     uint
+	MaxAttempts uint
+	Cloner      RequestCloner[T1]
+	Clock       timer.Clock
+}
+
+func (c *HedgingConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	cloner := c.Cloner
+	if cloner == nil {
+		cloner = defaultRequestCloner[T1]()
+	}
+	if cloner == nil {
+		var req T1
+		return nil, fmt.Errorf("hedging requires a request cloner for %T", req)
+	}
+
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := c.Delay
+	if delay <= 0 {
+		delay = DefaultHedgingDelay
+	}
+	maxAttempts := c.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultHedgingMaxAttempts
+	}
+	samples := c.Samples
+	if samples == 0 {
+		samples = DefaultHedgingSamples
+	}
+
+	return &hedgingClient[T1, T2]{
+		inner:       inner,
+		cloner:      cloner,
+		clock:       timer.OrSystem(c.Clock),
+		delay:       delay,
+		percentile:  c.Percentile,
+		maxAttempts: maxAttempts,
+		latencies:   make([]time.Duration, 0, samples),
+	}, nil
+}
+
+var _ netshaper.Client[*http.Request, string] = (*hedgingClient[*http.Request, string])(nil)
+
+type hedgingClient[T1 netshaper.Request, T2 any] struct {
+	inner       netshaper.Client[T1, T2]
+	cloner      RequestCloner[T1]
+	clock       timer.Clock
+	delay       time.Duration
+	percentile  float64
+	maxAttempts uint
+	mu          sync.Mutex
+	latencies   []time.Duration
+	next        int
+}
+
+type hedgingResult[T2 any] struct {
+	attempt  int
+	response T2
+	err      error
+	latency  time.Duration
+}
+
+func (c *hedgingClient[T1, T2]) Request(req T1) (res T2, err error) {
+	results := make(chan *hedgingResult[T2], c.maxAttempts)
+	cancels := make([]context.CancelFunc, 0, c.maxAttempts)
+	winner := -1
+
+	defer func() {
+		for i, cancel := range cancels {
+			// the winner's context lives until its response body is closed, if any
+			if i != winner || !cancelOnBodyClose(res, cancel) {
+				cancel()
+			}
+		}
+	}()
+
+	launch := func() error {
+		attemptCtx, cancel := context.WithCancel(req.Context())
+		clone, cloneErr := c.cloner(attemptCtx, req)
+		if cloneErr != nil {
+			cancel()
+			return cloneErr
+		}
+
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		start := c.clock.Now()
+		go func() {
+			attemptRes, attemptErr := c.inner.Request(clone)
+			results <- &hedgingResult[T2]{attempt, attemptRes, attemptErr, c.clock.Now().Sub(start)}
+		}()
+
+		return nil
+	}
+
+	if launchErr := launch(); launchErr != nil {
+		// request can not be copied (e.g. streaming body) - send it without hedging
+		return c.inner.Request(req)
+	}
+
+	delay := c.hedgingDelay()
+	pending := 1
+
+	defer func() {
+		if pending > 0 {
+			go discardHedgingResults(results, pending)
+		}
+	}()
+
+	for pending > 0 {
+		tmr := timer.Timer(nil)
+		var ticks <-chan time.Time
+		if uint(len(cancels)) < c.maxAttempts {
+			tmr = c.clock.NewTimer(delay)
+			ticks = tmr.Ticks()
+		}
+
+		select {
+		case <-req.Context().Done():
+			discardResponse(res)
+			var zero T2
+			res, err = zero, req.Context().Err()
+		case <-ticks:
+			if launch() == nil {
+				pending++
+			}
+		case result := <-results:
+			pending--
+
+			if result.err == nil {
+				discardResponse(res)
+				winner = result.attempt
+				c.record(result.latency)
+				res, err = result.response, nil
+			} else {
+				discardResponse(res)
+				res, err = result.response, result.err
+
+				if uint(len(cancels)) < c.maxAttempts && launch() == nil {
+					pending++
+				}
+			}
+		}
+
+		if tmr != nil {
+			tmr.Stop()
+		}
+		if winner >= 0 || req.Context().Err() != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (c *hedgingClient[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
+
+func (c *hedgingClient[T1, T2]) hedgingDelay() time.Duration {
+	if c.percentile <= 0 {
+		return c.delay
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.latencies) < cap(c.latencies) {
+		return c.delay
+	}
+
+	sorted := append([]time.Duration{}, c.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(math.Ceil(c.percentile*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	return sorted[idx]
+}
+
+func (c *hedgingClient[T1, T2]) record(latency time.Duration) {
+	if c.percentile <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.latencies) < cap(c.latencies) {
+		c.latencies = append(c.latencies, latency)
+	} else {
+		c.latencies[c.next] = latency
+		c.next = (c.next + 1) % len(c.latencies)
+	}
+}
+
+func discardHedgingResults[T2 any](results <-chan *hedgingResult[T2], amount int) {
+	for i := 0; i < amount; i++ {
+		discardResponse((<-results).response)
+	}
+}
@@ -0,0 +1,207 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"netshaper"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRequestCloner(ctx context.Context, req *testRequest) (*testRequest, error) {
+	return &testRequest{ctx: ctx, id: req.id}, nil
+}
+
+func TestHedgingRequest(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name         string
+		attempts     []func(ctx context.Context) (string, error)
+		want         string
+		wantErr      error
+		wantAttempts int
+	}{
+		{
+			name: "fast first attempt",
+			attempts: []func(ctx context.Context) (string, error){
+				func(_ context.Context) (string, error) { return "first", nil },
+			},
+			want:         "first",
+			wantAttempts: 1,
+		},
+		{
+			name: "slow first attempt is cancelled",
+			attempts: []func(ctx context.Context) (string, error){
+				func(ctx context.Context) (string, error) {
+					<-ctx.Done()
+					return "", ctx.Err()
+				},
+				func(_ context.Context) (string, error) { return "second", nil },
+			},
+			want:         "second",
+			wantAttempts: 2,
+		},
+		{
+			name: "failed first attempt triggers the next one",
+			attempts: []func(ctx context.Context) (string, error){
+				func(_ context.Context) (string, error) { return "", errFailed },
+				func(_ context.Context) (string, error) { return "second", nil },
+			},
+			want:         "second",
+			wantAttempts: 2,
+		},
+		{
+			name: "all attempts failed",
+			attempts: []func(ctx context.Context) (string, error){
+				func(_ context.Context) (string, error) { return "", errFailed },
+				func(_ context.Context) (string, error) { return "", errFailed },
+			},
+			wantErr:      errFailed,
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			cancelled := make(chan struct{}, len(tt.attempts))
+			inner := &testClientConfig[*testRequest, string]{}
+			inner.fn = func(req *testRequest) (string, error) {
+				res, err := tt.attempts[inner.calls()-1](req.Context())
+				if errors.Is(err, context.Canceled) {
+					cancelled <- struct{}{}
+				}
+				return res, err
+			}
+
+			cl, err := netshaper.NewClient[*testRequest, string](ctx,
+				testConfigOption[*testRequest, string](inner),
+				WithHedging(
+					WithHedgingDelay[*testRequest, string](20*time.Millisecond),
+					WithHedgingMaxAttempts[*testRequest, string](uint(len(tt.attempts))),
+					WithHedgingCloner[*testRequest, string](testRequestCloner),
+				),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			got, err := cl.Request(&testRequest{ctx: ctx})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Request() error got = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Request() got = %v, want %v", got, tt.want)
+			}
+			if calls := inner.calls(); calls != tt.wantAttempts {
+				t.Errorf("inner requests amount got = %v, want %v", calls, tt.wantAttempts)
+			}
+			if tt.name == "slow first attempt is cancelled" {
+				select {
+				case <-cancelled:
+				case <-ctx.Done():
+					t.Errorf("slow attempt must be cancelled")
+				}
+			}
+		})
+	}
+}
+
+func TestHedgingWinnerContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	t.Run("string response", func(t *testing.T) {
+		var attemptCtx context.Context
+		inner := &testClientConfig[*testRequest, string]{fn: func(req *testRequest) (string, error) {
+			attemptCtx = req.Context()
+			return "first", nil
+		}}
+
+		cl, _ := netshaper.NewClient[*testRequest, string](ctx,
+			testConfigOption[*testRequest, string](inner),
+			WithHedging(WithHedgingCloner[*testRequest, string](testRequestCloner)),
+		)
+		defer cl.Close(ctx)
+
+		if _, err := cl.Request(&testRequest{ctx: ctx}); err != nil {
+			t.Errorf("Request() error got = %v, want nil", err)
+			return
+		}
+		if attemptCtx.Err() == nil {
+			t.Errorf("winner context must be done once the result is returned")
+		}
+	})
+
+	t.Run("http response", func(t *testing.T) {
+		var attemptCtx context.Context
+		inner := &testClientConfig[*http.Request, *http.Response]{fn: func(req *http.Request) (*http.Response, error) {
+			attemptCtx = req.Context()
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("body"))}, nil
+		}}
+
+		cl, _ := netshaper.NewClient[*http.Request, *http.Response](ctx,
+			testConfigOption[*http.Request, *http.Response](inner),
+			WithHedging[*http.Request, *http.Response](),
+		)
+		defer cl.Close(ctx)
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+		res, err := cl.Request(req)
+		if err != nil {
+			t.Errorf("Request() error got = %v, want nil", err)
+			return
+		}
+		if attemptCtx.Err() != nil {
+			t.Errorf("winner context must not be done before the body is closed, got = %v", attemptCtx.Err())
+		}
+
+		_ = res.Body.Close()
+		if attemptCtx.Err() == nil {
+			t.Errorf("winner context must be done once the body is closed")
+		}
+	})
+}
+
+func TestHedgingPercentileDelay(t *testing.T) {
+	cl := &hedgingClient[*testRequest, string]{
+		delay:      time.Second,
+		percentile: 0.9,
+		latencies:  make([]time.Duration, 0, 10),
+	}
+
+	if got := cl.hedgingDelay(); got != time.Second {
+		t.Errorf("hedgingDelay() without samples got = %v, want %v", got, time.Second)
+	}
+
+	for i := 1; i <= 20; i++ {
+		cl.record(time.Duration(i) * time.Millisecond)
+	}
+
+	if got, want := cl.hedgingDelay(), 19*time.Millisecond; got != want {
+		t.Errorf("hedgingDelay() got = %v, want %v", got, want)
+	}
+}
+
+func TestHedgingRequiresCloner(t *testing.T) {
+	ctx := context.Background()
+	inner := &testClientConfig[*testRequest, string]{}
+
+	if _, err := netshaper.NewClient[*testRequest, string](ctx, testConfigOption[*testRequest, string](inner), WithHedging[*testRequest, string]()); err == nil {
+		t.Errorf("NewClient() error got = nil, want error")
+	}
+
+	httpInner := &testClientConfig[*http.Request, *http.Response]{}
+	if _, err := netshaper.NewClient[*http.Request, *http.Response](ctx, testConfigOption[*http.Request, *http.Response](httpInner), WithHedging[*http.Request, *http.Response]()); err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+	}
+}
@@ -0,0 +1,65 @@
+package options
+
+import (
+	"context"
+	"io"
+	netHttp "net/http"
+	"netshaper/http"
+)
+
+const maxDiscardedBodySize = 64 << 10
+
+type RequestCloner[T1 any] func(ctx context.Context, req T1) (T1, error)
+
+func HttpRequestCloner(ctx context.Context, req *netHttp.Request) (*netHttp.Request, error) {
+	return http.CloneRequest(ctx, req)
+}
+
+func defaultRequestCloner[T1 any]() RequestCloner[T1] {
+	var req T1
+	if _, ok := any(req).(*netHttp.Request); !ok {
+		return nil
+	}
+
+	return func(ctx context.Context, req T1) (clone T1, err error) {
+		httpClone, err := HttpRequestCloner(ctx, any(req).(*netHttp.Request))
+		if err != nil {
+			return
+		}
+
+		return any(httpClone).(T1), nil
+	}
+}
+
+// cancelOnBodyClose makes closing the body of an *http.Response call cancel, it reports whether res has a body.
+func cancelOnBodyClose[T2 any](res T2, cancel context.CancelFunc) bool {
+	httpRes, ok := any(res).(*netHttp.Response)
+	if !ok || httpRes == nil || httpRes.Body == nil {
+		return false
+	}
+
+	httpRes.Body = &cancelingBody{ReadCloser: httpRes.Body, cancel: cancel}
+
+	return true
+}
+
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// discardResponse drains and closes the body of an unused *http.Response, so its connection can be reused.
+func discardResponse[T2 any](res T2) {
+	httpRes, ok := any(res).(*netHttp.Response)
+	if !ok || httpRes == nil || httpRes.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(httpRes.Body, maxDiscardedBodySize))
+	_ = httpRes.Body.Close()
+}
@@ -0,0 +1,258 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"io"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/http"
+	"netshaper/test"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryHttpRequestReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var gotBodies []string
+	var gotHeaders [][]string
+	var gotAttempts []uint
+
+	url, srv := test.NewHttpHandlerFunc("/", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		body, _ := io.ReadAll(request.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		gotBodies = append(gotBodies, string(body))
+		gotHeaders = append(gotHeaders, request.Header.Values("X-Attempt"))
+
+		if len(gotBodies) < 3 {
+			writer.WriteHeader(netHttp.StatusBadGateway)
+		}
+	})
+	defer srv.Close()
+
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(http.WithNetClient(srv.Client())),
+		WithDecorators[*http.Request, *http.Response](PreProcessingFunc[*http.Request, *http.Response](func(req *http.Request) *http.Request {
+			mu.Lock()
+			defer mu.Unlock()
+			gotAttempts = append(gotAttempts, RetryAttempt(req.Context()))
+			req.Header.Add("X-Attempt", "1")
+			return req
+		})),
+		WithRetry(
+			WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			WithRetryClassifier(RetryHttpServerErrors),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	req, _ := http.NewPutRequest(ctx, url, nil, []byte("payload"))
+	res, err := cl.Request(req)
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != netHttp.StatusOK {
+		t.Errorf("Request() status got = %v, want %v", res.StatusCode, netHttp.StatusOK)
+	}
+	if want := []string{"payload", "payload", "payload"}; !reflect.DeepEqual(gotBodies, want) {
+		t.Errorf("server bodies got = %v, want %v", gotBodies, want)
+	}
+	if want := [][]string{{"1"}, {"1"}, {"1"}}; !reflect.DeepEqual(gotHeaders, want) {
+		t.Errorf("server headers got = %v, want %v", gotHeaders, want)
+	}
+	if want := []uint{0, 1, 2}; !reflect.DeepEqual(gotAttempts, want) {
+		t.Errorf("retry attempts got = %v, want %v", gotAttempts, want)
+	}
+	if len(req.Header.Values("X-Attempt")) != 0 {
+		t.Errorf("original request headers must not be changed, got = %v", req.Header)
+	}
+}
+
+func TestRetryHttpRequestNotRewindable(t *testing.T) {
+	ctx := context.Background()
+
+	inner := &testClientConfig[*http.Request, *http.Response]{fn: func(req *http.Request) (*http.Response, error) {
+		_, _ = io.ReadAll(req.Body)
+		return &http.Response{StatusCode: netHttp.StatusBadGateway, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}}
+
+	cl, _ := netshaper.NewClient[*http.Request, *http.Response](ctx,
+		testConfigOption[*http.Request, *http.Response](inner),
+		WithRetry(
+			WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			WithRetryClassifier(RetryHttpServerErrors),
+		),
+	)
+	defer cl.Close(ctx)
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte("stream"))
+		_ = writer.Close()
+	}()
+	req, _ := netHttp.NewRequestWithContext(ctx, netHttp.MethodPut, "http://localhost", reader)
+
+	if _, err := cl.Request(req); !errors.Is(err, http.ErrBodyNotRewindable) {
+		t.Errorf("Request() error got = %v, want %v", err, http.ErrBodyNotRewindable)
+	}
+	if got := inner.calls(); got != 1 {
+		t.Errorf("inner requests amount got = %v, want %v", got, 1)
+	}
+}
+
+func TestRetryHttpRequestNotRewindableKeepsAttemptError(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	inner := &testClientConfig[*http.Request, *http.Response]{fn: func(req *http.Request) (*http.Response, error) {
+		_, _ = io.ReadAll(req.Body)
+		return nil, errFailed
+	}}
+
+	cl, _ := netshaper.NewClient[*http.Request, *http.Response](ctx,
+		testConfigOption[*http.Request, *http.Response](inner),
+		WithRetry(WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond)),
+	)
+	defer cl.Close(ctx)
+
+	req, _ := netHttp.NewRequestWithContext(ctx, netHttp.MethodPut, "http://localhost", io.NopCloser(strings.NewReader("stream")))
+
+	_, err := cl.Request(req)
+	if !errors.Is(err, http.ErrBodyNotRewindable) {
+		t.Errorf("Request() error got = %v, want %v", err, http.ErrBodyNotRewindable)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Errorf("Request() error got = %v, want %v", err, errFailed)
+	}
+}
+
+// testRewritingCircuitBreaker retries once on another endpoint.
+type testRewritingCircuitBreaker struct {
+	retried bool
+}
+
+func (b *testRewritingCircuitBreaker) Next(req *http.Request, _ *http.Response, err error) (bool, *http.Request, error) {
+	if b.retried {
+		return false, req, err
+	}
+	b.retried = true
+
+	next := req.Clone(req.Context())
+	next.URL.Path = "/fallback"
+	next.Header.Set("X-Endpoint", "fallback")
+
+	return true, next, nil
+}
+
+func TestCircuitBreakerRewritesHttpRequest(t *testing.T) {
+	ctx := context.Background()
+
+	inner := &testClientConfig[*http.Request, *http.Response]{fn: func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		return &http.Response{StatusCode: netHttp.StatusOK, Body: io.NopCloser(strings.NewReader(string(body)))}, nil
+	}}
+
+	cl, _ := netshaper.NewClient[*http.Request, *http.Response](ctx,
+		testConfigOption[*http.Request, *http.Response](inner),
+		WithCircuitBreaker(conf.OptionFunc[CircuitBreakerConfig[*http.Request, *http.Response]](
+			func(config CircuitBreakerConfig[*http.Request, *http.Response]) CircuitBreakerConfig[*http.Request, *http.Response] {
+				config.BreakerFactory = func() CircuitBreaker[*http.Request, *http.Response] {
+					return &testRewritingCircuitBreaker{}
+				}
+				return config
+			},
+		)),
+	)
+	defer cl.Close(ctx)
+
+	req, _ := netHttp.NewRequestWithContext(ctx, netHttp.MethodPut, "http://localhost/primary", strings.NewReader("payload"))
+
+	res, err := cl.Request(req)
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "payload" {
+		t.Errorf("Request() body got = %v, want %v", string(body), "payload")
+	}
+
+	var gotPaths, gotEndpoints []string
+	for _, attemptReq := range inner.requests {
+		gotPaths = append(gotPaths, attemptReq.URL.Path)
+		gotEndpoints = append(gotEndpoints, attemptReq.Header.Get("X-Endpoint"))
+	}
+	if want := []string{"/primary", "/fallback"}; !reflect.DeepEqual(gotPaths, want) {
+		t.Errorf("inner request paths got = %v, want %v", gotPaths, want)
+	}
+	if want := []string{"", "fallback"}; !reflect.DeepEqual(gotEndpoints, want) {
+		t.Errorf("inner request endpoints got = %v, want %v", gotEndpoints, want)
+	}
+}
+
+func TestRetryDiscardsFailedResponses(t *testing.T) {
+	ctx := context.Background()
+
+	var bodies []*testBody
+	inner := &testClientConfig[*http.Request, *http.Response]{}
+	inner.fn = func(_ *http.Request) (*http.Response, error) {
+		body := &testBody{Reader: strings.NewReader("failed")}
+		bodies = append(bodies, body)
+
+		status := netHttp.StatusBadGateway
+		if inner.calls() == 2 {
+			status = netHttp.StatusOK
+		}
+
+		return &http.Response{StatusCode: status, Body: body}, nil
+	}
+
+	cl, _ := netshaper.NewClient[*http.Request, *http.Response](ctx,
+		testConfigOption[*http.Request, *http.Response](inner),
+		WithRetry(
+			WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			WithRetryClassifier(RetryHttpServerErrors),
+		),
+	)
+	defer cl.Close(ctx)
+
+	req, _ := http.NewGetRequest(ctx, netshaper.URL{Scheme: "http", Host: "localhost"}, nil)
+	if _, err := cl.Request(req); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	if !bodies[0].closed || bodies[0].Len() != 0 {
+		t.Errorf("failed attempt body must be drained and closed")
+	}
+	if bodies[1].closed {
+		t.Errorf("returned response body must not be closed")
+	}
+}
+
+type testBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *testBody) Close() error {
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,103 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+)
+
+// WithInterceptors wraps the client into the interceptors, the first one is the outermost: it sees the request first
+// and the response last.
+func WithInterceptors[T1 netshaper.Request, T2 any](interceptors ...Interceptor[T1, T2]) conf.Option[netshaper.Config[T1, T2]] {
+	cleanInterceptors := make([]Interceptor[T1, T2], 0, len(interceptors))
+	for _, i := range interceptors {
+		if i != nil {
+			cleanInterceptors = append(cleanInterceptors, i)
+		}
+	}
+
+	if len(cleanInterceptors) == 0 {
+		return nil
+	}
+
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return &InterceptorConfig[T1, T2]{Inner: config, Interceptors: cleanInterceptors}
+	})
+}
+
+// Interceptor handles a request instead of the client, it may change the request, call next any number of times (or
+// not call it at all) and change the result.
+type Interceptor[T1 netshaper.Request, T2 any] interface {
+	Intercept(req T1, next func(req T1) (T2, error)) (T2, error)
+}
+
+type InterceptorFunc[T1 netshaper.Request, T2 any] func(req T1, next func(req T1) (T2, error)) (T2, error)
+
+func (fn InterceptorFunc[T1, T2]) Intercept(req T1, next func(req T1) (T2, error)) (T2, error) {
+	return fn(req, next)
+}
+
+// DecoratorInterceptor adapts the decorator, Exit receives the request returned by Enter.
+func DecoratorInterceptor[T1 netshaper.Request, T2 any](decorator Decorator[T1, T2]) Interceptor[T1, T2] {
+	if decorator == nil {
+		return nil
+	}
+
+	if i, ok := decorator.(Interceptor[T1, T2]); ok {
+		return i
+	}
+
+	return InterceptorFunc[T1, T2](func(req T1, next func(req T1) (T2, error)) (T2, error) {
+		req = decorator.Enter(req)
+		res, err := next(req)
+
+		return decorator.Exit(req, res, err)
+	})
+}
+
+var _ netshaper.Config[*http.Request, string] = (*InterceptorConfig[*http.Request, string])(nil)
+
+type InterceptorConfig[T1 netshaper.Request, T2 any] struct {
+	Inner        netshaper.Config[T1, T2]
+	Interceptors []Interceptor[T1, T2]
+}
+
+func (c *InterceptorConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Interceptors) == 0 {
+		return inner, nil
+	}
+
+	handler := inner.Request
+	for i := len(c.Interceptors) - 1; i >= 0; i-- {
+		handler = chainInterceptor(c.Interceptors[i], handler)
+	}
+
+	return &interceptorClient[T1, T2]{inner, handler}, nil
+}
+
+func chainInterceptor[T1 netshaper.Request, T2 any](interceptor Interceptor[T1, T2], next func(req T1) (T2, error)) func(req T1) (T2, error) {
+	return func(req T1) (T2, error) {
+		return interceptor.Intercept(req, next)
+	}
+}
+
+var _ netshaper.Client[*http.Request, string] = (*interceptorClient[*http.Request, string])(nil)
+
+type interceptorClient[T1 netshaper.Request, T2 any] struct {
+	inner   netshaper.Client[T1, T2]
+	handler func(req T1) (T2, error)
+}
+
+func (c *interceptorClient[T1, T2]) Request(req T1) (T2, error) {
+	return c.handler(req)
+}
+
+func (c *interceptorClient[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
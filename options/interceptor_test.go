@@ -0,0 +1,193 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"netshaper/conf"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type testRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *testRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func (r *testRecorder) interceptor(name string) Interceptor[*testRequest, string] {
+	return InterceptorFunc[*testRequest, string](func(req *testRequest, next func(req *testRequest) (string, error)) (string, error) {
+		r.record(name + " before")
+		res, err := next(req)
+		r.record(name + " after")
+
+		return res + name, err
+	})
+}
+
+func (r *testRecorder) decorator(name string) Decorator[*testRequest, string] {
+	return &testDecorator{r, name}
+}
+
+type testDecorator struct {
+	recorder *testRecorder
+	name     string
+}
+
+func (d *testDecorator) Enter(req *testRequest) *testRequest {
+	d.recorder.record(d.name + " enter")
+	return req
+}
+
+func (d *testDecorator) Exit(_ *testRequest, res string, err error) (string, error) {
+	d.recorder.record(d.name + " exit")
+	return res + d.name, err
+}
+
+func TestInterceptorsOrder(t *testing.T) {
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name       string
+		options    func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]]
+		want       string
+		wantErr    error
+		wantEvents []string
+		wantCalls  int
+	}{
+		{
+			name: "first interceptor is the outermost",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](r.interceptor("a"), r.interceptor("b")),
+				}
+			},
+			want:       "okba",
+			wantEvents: []string{"a before", "b before", "inner", "b after", "a after"},
+			wantCalls:  1,
+		},
+		{
+			name: "interceptors options applied later are outer",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](r.interceptor("a")),
+					WithInterceptors[*testRequest, string](r.interceptor("b")),
+				}
+			},
+			want:       "okab",
+			wantEvents: []string{"b before", "a before", "inner", "a after", "b after"},
+			wantCalls:  1,
+		},
+		{
+			name: "decorator adapters keep decorators order",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](
+						DecoratorInterceptor(r.decorator("a")),
+						r.interceptor("b"),
+						DecoratorInterceptor(r.decorator("c")),
+					),
+				}
+			},
+			want:       "okcba",
+			wantEvents: []string{"a enter", "b before", "c enter", "inner", "c exit", "b after", "a exit"},
+			wantCalls:  1,
+		},
+		{
+			name: "processing funcs are interceptors",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](
+						PostProcessingFunc[*testRequest, string](func(_ *testRequest, res string, err error) (string, error) {
+							r.record("post")
+							return res + "post", err
+						}),
+						PreProcessingFunc[*testRequest, string](func(req *testRequest) *testRequest {
+							r.record("pre")
+							return req
+						}),
+					),
+				}
+			},
+			want:       "okpost",
+			wantEvents: []string{"pre", "inner", "post"},
+			wantCalls:  1,
+		},
+		{
+			name: "interceptor short-circuits the call",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](
+						r.interceptor("a"),
+						InterceptorFunc[*testRequest, string](func(_ *testRequest, _ func(req *testRequest) (string, error)) (string, error) {
+							return "", errStop
+						}),
+						r.interceptor("b"),
+					),
+				}
+			},
+			want:       "a",
+			wantErr:    errStop,
+			wantEvents: []string{"a before", "a after"},
+		},
+		{
+			name: "interceptor calls next twice",
+			options: func(r *testRecorder) []conf.Option[netshaper.Config[*testRequest, string]] {
+				return []conf.Option[netshaper.Config[*testRequest, string]]{
+					WithInterceptors[*testRequest, string](
+						InterceptorFunc[*testRequest, string](func(req *testRequest, next func(req *testRequest) (string, error)) (string, error) {
+							first, _ := next(req)
+							second, err := next(req)
+							return first + second, err
+						}),
+						r.interceptor("b"),
+					),
+				}
+			},
+			want:       "okbokb",
+			wantEvents: []string{"b before", "inner", "b after", "b before", "inner", "b after"},
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			recorder := &testRecorder{}
+			inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+				recorder.record("inner")
+				return "ok", nil
+			}}
+
+			opts := append([]conf.Option[netshaper.Config[*testRequest, string]]{testConfigOption[*testRequest, string](inner)}, tt.options(recorder)...)
+			cl, err := netshaper.NewClient(ctx, opts...)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			got, err := cl.Request(&testRequest{ctx: ctx})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Request() error got = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Request() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(recorder.events, tt.wantEvents) {
+				t.Errorf("events got = %v, want %v", recorder.events, tt.wantEvents)
+			}
+			if calls := inner.calls(); calls != tt.wantCalls {
+				t.Errorf("inner requests amount got = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/timer"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultKeyedRateLimiterIdleTimeout = 5 * time.Minute
+
+func WithKeyedRateLimiter[T1 netshaper.Request, T2 any](key func(req T1) string, factory func(key string) RateLimiter[T1, T2], idleTimeout time.Duration) conf.Option[netshaper.Config[T1, T2]] {
+	if key == nil || factory == nil {
+		return nil
+	}
+
+	return WithRateLimiter[T1, T2](NewKeyedRateLimiter[T1, T2](key, factory, idleTimeout, nil))
+}
+
+// NewKeyedRateLimiter lazily creates a limiter per request key using factory. Limiters of keys without requests for
+// idleTimeout are evicted.
+func NewKeyedRateLimiter[T1 any, T2 any](key func(req T1) string, factory func(key string) RateLimiter[T1, T2], idleTimeout time.Duration, clock timer.Clock) RateLimiter[T1, T2] {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultKeyedRateLimiterIdleTimeout
+	}
+
+	clock = timer.OrSystem(clock)
+
+	return &keyedRateLimiter[T1, T2]{
+		key:         key,
+		factory:     factory,
+		idleTimeout: idleTimeout,
+		clock:       clock,
+		lastSweep:   clock.Now(),
+		limiters:    map[string]*keyedRateLimiterEntry[T1, T2]{},
+	}
+}
+
+func HttpHostKey(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+
+	return req.URL.Host
+}
+
+func HttpHeaderKey(name string) func(req *http.Request) string {
+	return func(req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+// HttpPathTemplateKey returns the first template matching request path, e.g. "/users/{id}" matches "/users/42".
+// Template segments in curly braces or "*" match any single path segment. Request path is used if no template matches.
+func HttpPathTemplateKey(templates ...string) func(req *http.Request) string {
+	splitTemplates := make([][]string, 0, len(templates))
+	for _, template := range templates {
+		splitTemplates = append(splitTemplates, splitPath(template))
+	}
+
+	return func(req *http.Request) string {
+		segments := splitPath(req.URL.Path)
+
+		for i, template := range splitTemplates {
+			if matchPathTemplate(template, segments) {
+				return templates[i]
+			}
+		}
+
+		return req.URL.Path
+	}
+}
+
+func JoinKeys[T any](keys ...func(req T) string) func(req T) string {
+	return func(req T) string {
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			parts = append(parts, key(req))
+		}
+
+		return strings.Join(parts, " ")
+	}
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func matchPathTemplate(template []string, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+
+	for i, t := range template {
+		isParam := t == "*" || (strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}"))
+		if !isParam && t != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type keyedRateLimiter[T1 any, T2 any] struct {
+	key         func(req T1) string
+	factory     func(key string) RateLimiter[T1, T2]
+	idleTimeout time.Duration
+	clock       timer.Clock
+	mu          sync.Mutex
+	lastSweep   time.Time
+	limiters    map[string]*keyedRateLimiterEntry[T1, T2]
+}
+
+type keyedRateLimiterEntry[T1 any, T2 any] struct {
+	limiter  RateLimiter[T1, T2]
+	active   uint
+	lastUsed time.Time
+}
+
+func (l *keyedRateLimiter[T1, T2]) Enter(req T1) error {
+	entry := l.acquire(l.key(req))
+
+	if err := entry.limiter.Enter(req); err != nil {
+		l.release(entry)
+		return err
+	}
+
+	return nil
+}
+
+func (l *keyedRateLimiter[T1, T2]) enterContext(ctx context.Context, req T1) error {
+	entry := l.acquire(l.key(req))
+
+	if err := enterLimiter(ctx, entry.limiter, req); err != nil {
+		l.release(entry)
+		return err
+	}
+
+	return nil
+}
+
+func (l *keyedRateLimiter[T1, T2]) Exit(req T1, res T2, err error) {
+	l.mu.Lock()
+	entry, ok := l.limiters[l.key(req)]
+	l.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	defer l.release(entry)
+	entry.limiter.Exit(req, res, err)
+}
+
+func (l *keyedRateLimiter[T1, T2]) acquire(key string) *keyedRateLimiterEntry[T1, T2] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if now.Sub(l.lastSweep) >= l.idleTimeout {
+		l.sweep(now)
+	}
+
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &keyedRateLimiterEntry[T1, T2]{limiter: l.factory(key)}
+		l.limiters[key] = entry
+	}
+
+	entry.active++
+	entry.lastUsed = now
+
+	return entry
+}
+
+func (l *keyedRateLimiter[T1, T2]) release(entry *keyedRateLimiterEntry[T1, T2]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.active > 0 {
+		entry.active--
+	}
+	entry.lastUsed = l.clock.Now()
+}
+
+func (l *keyedRateLimiter[T1, T2]) sweep(now time.Time) {
+	for key, entry := range l.limiters {
+		if entry.active == 0 && now.Sub(entry.lastUsed) >= l.idleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,212 @@
+package options
+
+import (
+	"context"
+	"net/http"
+	"netshaper"
+	"sync"
+	"testing"
+	"time"
+)
+
+func (l *keyedRateLimiter[T1, T2]) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.limiters)
+}
+
+func TestKeyedRateLimiter(t *testing.T) {
+	clock := newTestClock()
+	limiter := NewKeyedRateLimiter[*testRequest, string](
+		func(req *testRequest) string {
+			if req.id%2 == 0 {
+				return "even"
+			}
+			return "odd"
+		},
+		func(_ string) RateLimiter[*testRequest, string] {
+			return NewTokenBucketLimiter[*testRequest, string](1, 2, clock)
+		},
+		time.Minute,
+		clock,
+	).(*keyedRateLimiter[*testRequest, string])
+
+	start := clock.Now()
+	for i := 0; i < 4; i++ {
+		req := &testRequest{ctx: context.Background(), id: i}
+		if err := limiter.Enter(req); err != nil {
+			t.Errorf("Enter() error got = %v, want nil", err)
+		}
+		limiter.Exit(req, "", nil)
+	}
+
+	if got := clock.Now().Sub(start); got != 0 {
+		t.Errorf("Enter() elapsed got = %v, want %v", got, time.Duration(0))
+	}
+	if got := limiter.size(); got != 2 {
+		t.Errorf("limiters amount got = %v, want %v", got, 2)
+	}
+
+	clock.Advance(2 * time.Minute)
+
+	req := &testRequest{ctx: context.Background(), id: 1}
+	if err := limiter.Enter(req); err != nil {
+		t.Errorf("Enter() error got = %v, want nil", err)
+	}
+	if got := limiter.size(); got != 1 {
+		t.Errorf("limiters amount after eviction got = %v, want %v", got, 1)
+	}
+}
+
+func TestKeyedRateLimiterDoesNotBlockOtherKeys(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		return "ok", nil
+	}}
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithKeyedRateLimiter[*testRequest, string](
+			func(req *testRequest) string {
+				if req.id == 0 {
+					return "slow"
+				}
+				return "fast"
+			},
+			func(key string) RateLimiter[*testRequest, string] {
+				if key == "slow" {
+					return NewTokenBucketLimiter[*testRequest, string](0.1, 1, nil)
+				}
+				return NewTokenBucketLimiter[*testRequest, string](100, 1, nil)
+			},
+			time.Minute,
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	if _, err = cl.Request(&testRequest{ctx: ctx, id: 0}); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	slowCtx, slowCancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// waits for about 10 seconds until cancelled
+		_, _ = cl.Request(&testRequest{ctx: slowCtx, id: 0})
+	}()
+	defer wg.Wait()
+	defer slowCancel()
+
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		if _, err = cl.Request(&testRequest{ctx: ctx, id: i}); err != nil {
+			t.Errorf("Request() error got = %v, want nil", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Request() for other key elapsed got = %v, want less than %v", elapsed, 500*time.Millisecond)
+	}
+}
+
+func TestKeyedRateLimiterClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		return "ok", nil
+	}}
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithKeyedRateLimiter[*testRequest, string](
+			func(_ *testRequest) string { return "slow" },
+			func(_ string) RateLimiter[*testRequest, string] {
+				return NewTokenBucketLimiter[*testRequest, string](0.1, 1, nil)
+			},
+			time.Minute,
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+
+	if _, err = cl.Request(&testRequest{ctx: ctx}); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// waits for about 10 seconds until the client is closed
+		if _, reqErr := cl.Request(&testRequest{ctx: ctx}); reqErr == nil {
+			t.Errorf("Request() error got = nil, want error")
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	cl.Close(ctx)
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Close() elapsed got = %v, want less than %v", elapsed, 500*time.Millisecond)
+	}
+	if calls := inner.calls(); calls != 1 {
+		t.Errorf("inner requests amount got = %v, want %v", calls, 1)
+	}
+}
+
+func TestHttpKeys(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/users/42/orders", nil)
+	req.Header.Set("X-Api-Key", "secret")
+
+	tests := []struct {
+		name string
+		key  func(req *http.Request) string
+		want string
+	}{
+		{
+			name: "host",
+			key:  HttpHostKey,
+			want: "example.com",
+		},
+		{
+			name: "header",
+			key:  HttpHeaderKey("X-Api-Key"),
+			want: "secret",
+		},
+		{
+			name: "matched path template",
+			key:  HttpPathTemplateKey("/users/{id}", "/users/{id}/orders"),
+			want: "/users/{id}/orders",
+		},
+		{
+			name: "unmatched path template",
+			key:  HttpPathTemplateKey("/users/{id}"),
+			want: "/users/42/orders",
+		},
+		{
+			name: "joined",
+			key:  JoinKeys(HttpHostKey, HttpPathTemplateKey("/users/*/orders")),
+			want: "example.com /users/*/orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key(req); got != tt.want {
+				t.Errorf("key() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
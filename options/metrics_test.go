@@ -0,0 +1,110 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"netshaper/metrics"
+	"testing"
+)
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	m := metrics.NewMemory()
+	ctx := metrics.ContextWith(context.Background(), m)
+	errFailed := errors.New("failed")
+
+	inner := &testClientConfig[int, string]{fn: func(_ int) (string, error) {
+		return "", errFailed
+	}}
+
+	cl, err := netshaper.NewClient[int, string](ctx,
+		testConfigOption[int, string](inner),
+		WithCircuitBreaker(
+			WithMaxRetriesLimit[int, string](3),
+			WithCircuit[int, string](WithCircuitConsecutiveFailures(2)),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	_, _ = cl.Request(1)
+
+	transition := metrics.Labels{metrics.LabelFrom: CircuitClosed.String(), metrics.LabelTo: CircuitOpen.String()}
+
+	if got := m.Counter(metrics.RetryAttemptsTotal, nil); got != 2 {
+		t.Errorf("retry attempts got = %v, want %v", got, 2)
+	}
+	if got := m.Gauge(metrics.CircuitState, nil); got != float64(CircuitOpen) {
+		t.Errorf("circuit state got = %v, want %v", got, float64(CircuitOpen))
+	}
+	if got := m.Counter(metrics.CircuitTransitionsTotal, transition); got != 1 {
+		t.Errorf("circuit transitions got = %v, want %v", got, 1)
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	m := metrics.NewMemory()
+	ctx := metrics.ContextWith(context.Background(), m)
+
+	busy := make(chan float64, 1)
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		busy <- m.Gauge(metrics.PoolBusyWorkers, nil)
+		return "ok", nil
+	}}
+
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithPool(WithPoolSize[*testRequest, string](2)),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	if _, err = cl.Request(&testRequest{ctx: ctx}); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	if got := <-busy; got != 1 {
+		t.Errorf("busy workers during request got = %v, want %v", got, 1)
+	}
+	if got := m.Gauge(metrics.PoolWorkers, nil); got != 2 {
+		t.Errorf("workers got = %v, want %v", got, 2)
+	}
+	if got := m.Gauge(metrics.PoolQueueDepth, nil); got != 0 {
+		t.Errorf("queue depth got = %v, want %v", got, 0)
+	}
+}
+
+func TestRateLimiterMetrics(t *testing.T) {
+	m := metrics.NewMemory()
+	ctx := metrics.ContextWith(context.Background(), m)
+
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		return "ok", nil
+	}}
+
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithTokenBucketLimiter[*testRequest, string](1000, 2),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		if _, err = cl.Request(&testRequest{ctx: ctx, id: i}); err != nil {
+			t.Errorf("Request() error got = %v, want nil", err)
+		}
+	}
+
+	if got := len(m.Histogram(metrics.RateLimiterWaitSeconds, nil)); got != 3 {
+		t.Errorf("wait observations got = %v, want %v", got, 3)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"netshaper"
 	"netshaper/conf"
+	"netshaper/metrics"
 	"sync"
 )
 
@@ -56,7 +57,9 @@ func (c *PoolConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T
 		ctx:     poolCtx,
 		cancel:  poolCancel,
 		pending: pending,
+		metrics: metrics.FromContext(ctx),
 	}
+	p.metrics.SetGauge(metrics.PoolWorkers, float64(c.Size), nil)
 
 	for i := uint(0); i < c.Size; i++ {
 		inner, err := c.Inner.Create(ctx)
@@ -79,17 +82,28 @@ type pool[T1 netshaper.Request, T2 any] struct {
 	cancel  context.CancelFunc
 	pending chan<- *requestJob[T1, T2]
 	wg      sync.WaitGroup
+	once    sync.Once
+	metrics metrics.Metrics
 }
 
 func (c *pool[T1, T2]) Request(req T1) (res T2, err error) {
 	results := make(chan *responseResult[T2], 1)
-	defer close(results)
-
-	c.pending <- &requestJob[T1, T2]{
+	job := &requestJob[T1, T2]{
 		request: req,
 		results: results,
 	}
 
+	select {
+	case <-c.ctx.Done():
+		err = c.ctx.Err()
+		return
+	case <-req.Context().Done():
+		err = req.Context().Err()
+		return
+	case c.pending <- job:
+		c.metrics.SetGauge(metrics.PoolQueueDepth, float64(len(c.pending)), nil)
+	}
+
 	select {
 	case <-c.ctx.Done():
 		err = c.ctx.Err()
@@ -105,12 +119,12 @@ func (c *pool[T1, T2]) Request(req T1) (res T2, err error) {
 
 func (c *pool[T1, T2]) Close(_ context.Context) {
 	c.close()
+	c.wg.Wait()
 }
 
 func (c *pool[T1, T2]) close() {
-	defer c.wg.Wait()
-	defer close(c.pending)
-	c.cancel()
+	// pending channel is not closed: workers stop on the context, so concurrent requests never send to a closed channel
+	c.once.Do(c.cancel)
 }
 
 func (c *pool[T1, T2]) runWorker(cl netshaper.Client[T1, T2], pending <-chan *requestJob[T1, T2]) {
@@ -122,6 +136,7 @@ func (c *pool[T1, T2]) runWorker(cl netshaper.Client[T1, T2], pending <-chan *re
 		case <-c.ctx.Done():
 			return
 		case r := <-pending:
+			c.metrics.SetGauge(metrics.PoolQueueDepth, float64(len(pending)), nil)
 			c.handleJob(cl, r)
 		}
 	}
@@ -129,12 +144,17 @@ func (c *pool[T1, T2]) runWorker(cl netshaper.Client[T1, T2], pending <-chan *re
 
 func (c *pool[T1, T2]) handleJob(cl netshaper.Client[T1, T2], job *requestJob[T1, T2]) {
 	req := job.request
+
+	c.metrics.AddGauge(metrics.PoolBusyWorkers, 1, nil)
 	res, err := cl.Request(req)
+	c.metrics.AddGauge(metrics.PoolBusyWorkers, -1, nil)
 
 	select {
 	case <-c.ctx.Done():
+		discardResponse(res)
 		return
 	case <-req.Context().Done():
+		discardResponse(res)
 		return
 	default:
 		job.results <- &responseResult[T2]{res, err}
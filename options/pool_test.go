@@ -0,0 +1,49 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"testing"
+	"time"
+)
+
+func TestPoolRequestContextWhilePending(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	release := make(chan struct{})
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		<-release
+		return "ok", nil
+	}}
+
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithPool(WithPoolSize[*testRequest, string](2), WithPoolPendingSize[*testRequest, string](2)),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+	defer close(release)
+
+	// occupy both workers and the pending queue
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, _ = cl.Request(&testRequest{ctx: ctx})
+		}()
+	}
+	for inner.calls() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	reqCtx, reqCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer reqCancel()
+
+	if _, err = cl.Request(&testRequest{ctx: reqCtx}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Request() error got = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
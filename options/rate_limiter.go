@@ -2,9 +2,13 @@ package options
 
 import (
 	"context"
+	"log/slog"
+	"math"
 	"net/http"
 	"netshaper"
 	"netshaper/conf"
+	"netshaper/metrics"
+	"netshaper/timer"
 	"sync"
 	"time"
 )
@@ -20,56 +24,254 @@ func WithRateLimiter[T1 netshaper.Request, T2 any](limiter RateLimiter[T1, T2])
 }
 
 func WithRequestPerSecondLimiter[T1 netshaper.Request, T2 any](rps float64) conf.Option[netshaper.Config[T1, T2]] {
-	if rps == 0 {
+	return WithTokenBucketLimiter[T1, T2](rps, 1)
+}
+
+func WithRequestPerDurationLimiter[T1 netshaper.Request, T2 any](amount uint, interval time.Duration) conf.Option[netshaper.Config[T1, T2]] {
+	return WithSlidingWindowLimiter[T1, T2](amount, interval)
+}
+
+func WithTokenBucketLimiter[T1 netshaper.Request, T2 any](rps float64, burst uint) conf.Option[netshaper.Config[T1, T2]] {
+	if rps <= 0 {
 		return nil
 	}
 
-	return WithRateLimiter[T1, T2](&timeBucketRateLimiter[T1, T2]{
-		maxRps: rps,
-		now:    time.Now,
-	})
+	return WithRateLimiter[T1, T2](NewTokenBucketLimiter[T1, T2](rps, burst, nil))
 }
 
-func WithRequestPerDurationLimiter[T1 netshaper.Request, T2 any](amount uint, interval time.Duration) conf.Option[netshaper.Config[T1, T2]] {
-	return WithRequestPerSecondLimiter[T1, T2](float64(amount) / float64(interval/time.Second))
+func WithSlidingWindowLimiter[T1 netshaper.Request, T2 any](limit uint, window time.Duration) conf.Option[netshaper.Config[T1, T2]] {
+	if limit == 0 || window <= 0 {
+		return nil
+	}
+
+	return WithRateLimiter[T1, T2](NewSlidingWindowLimiter[T1, T2](limit, window, nil))
 }
 
+// RateLimiter implementations must be safe for concurrent use. Enter blocks until the request is allowed to be sent
+// and returns an error (e.g. the request context error) if it must not be sent at all; Exit is called only for
+// requests which entered successfully. Limiters of this package also stop waiting once the client is closed.
 type RateLimiter[T1 any, T2 any] interface {
-	Enter(req T1)
+	Enter(req T1) error
 	Exit(req T1, res T2, err error)
 }
 
-type timeBucketRateLimiter[T1 netshaper.Request, T2 any] struct {
-	maxRps     float64
-	now        func() time.Time
-	lastUpdate time.Time
-	lastCount  float64
+// contextRateLimiter is implemented by the limiters of this package, they wait with the given context instead of the
+// request context, so closing the client interrupts waiting requests.
+type contextRateLimiter[T1 any] interface {
+	enterContext(ctx context.Context, req T1) error
 }
 
-func (l *timeBucketRateLimiter[T1, T2]) Enter(req T1) {
-	count := l.lastCount + 1.0
-	seconds := float64(l.now().Sub(l.lastUpdate) / time.Second)
+// enterLimiter waits for the limiter with the context, limiters not implementing contextRateLimiter wait with the
+// request context only.
+func enterLimiter[T1 any, T2 any](ctx context.Context, limiter RateLimiter[T1, T2], req T1) error {
+	if l, ok := limiter.(contextRateLimiter[T1]); ok {
+		return l.enterContext(ctx, req)
+	}
 
-	if count/seconds > l.maxRps {
-		t := time.NewTimer(time.Duration(int(count/l.maxRps)) * time.Second)
-		select {
-		case <-req.Context().Done():
-			if t.Stop() {
-				<-t.C
-			}
-			return
-		case <-t.C:
-			break
+	return limiter.Enter(req)
+}
+
+func NewTokenBucketLimiter[T1 netshaper.Request, T2 any](rps float64, burst uint, clock timer.Clock) RateLimiter[T1, T2] {
+	return &tokenBucketRateLimiter[T1, T2]{newTokenBucket(rps, burst, clock)}
+}
+
+func NewSlidingWindowLimiter[T1 netshaper.Request, T2 any](limit uint, window time.Duration, clock timer.Clock) RateLimiter[T1, T2] {
+	return &slidingWindowRateLimiter[T1, T2]{newSlidingWindow(limit, window, clock)}
+}
+
+type tokenBucketRateLimiter[T1 netshaper.Request, T2 any] struct {
+	bucket *tokenBucket
+}
+
+func (l *tokenBucketRateLimiter[T1, T2]) Enter(req T1) error {
+	return l.enterContext(req.Context(), req)
+}
+
+func (l *tokenBucketRateLimiter[T1, T2]) enterContext(ctx context.Context, _ T1) error {
+	return l.bucket.wait(ctx)
+}
+
+func (l *tokenBucketRateLimiter[T1, T2]) Exit(_ T1, _ T2, _ error) {
+}
+
+type slidingWindowRateLimiter[T1 netshaper.Request, T2 any] struct {
+	window *slidingWindow
+}
+
+func (l *slidingWindowRateLimiter[T1, T2]) Enter(req T1) error {
+	return l.enterContext(req.Context(), req)
+}
+
+func (l *slidingWindowRateLimiter[T1, T2]) enterContext(ctx context.Context, _ T1) error {
+	return l.window.wait(ctx)
+}
+
+func (l *slidingWindowRateLimiter[T1, T2]) Exit(_ T1, _ T2, _ error) {
+}
+
+func newTokenBucket(rps float64, burst uint, clock timer.Clock) *tokenBucket {
+	if burst == 0 {
+		burst = 1
+	}
+
+	clock = timer.OrSystem(clock)
+
+	return &tokenBucket{
+		clock:  clock,
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// tokenBucket hands out reservations: tokens may become negative, a caller then waits until its token is refilled.
+type tokenBucket struct {
+	clock  timer.Clock
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := b.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, b.clock, delay); err != nil {
+		b.release()
+		return err
+	}
+
+	return nil
+}
+
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens--
+
+	now := b.clock.Now()
+	if b.tokens >= 0 && !b.last.After(now) {
+		return 0
+	}
+
+	// last is in the future while the bucket is paused
+	refilledAt := b.last.Add(time.Duration(math.Max(0, -b.tokens) / b.rate * float64(time.Second)))
+
+	return refilledAt.Sub(now)
+}
+
+func (b *tokenBucket) setRate(rps float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.rate = rps
+}
+
+func (b *tokenBucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if until.After(b.last) {
+		b.tokens = math.Min(b.tokens, 0)
+		b.last = until
+	}
+}
+
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+func (b *tokenBucket) refill() {
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+func newSlidingWindow(limit uint, window time.Duration, clock timer.Clock) *slidingWindow {
+	return &slidingWindow{
+		clock:  timer.OrSystem(clock),
+		limit:  int(limit),
+		window: window,
+		log:    make([]time.Time, 0, limit),
+	}
+}
+
+// slidingWindow keeps the log of request times and allows at most limit requests within any window.
+type slidingWindow struct {
+	clock  timer.Clock
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	log    []time.Time
+}
+
+func (w *slidingWindow) wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		delay := w.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		if err := sleep(ctx, w.clock, delay); err != nil {
+			return err
 		}
+	}
+}
+
+func (w *slidingWindow) reserve() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.clock.Now()
+	since := now.Add(-w.window)
+
+	expired := 0
+	for expired < len(w.log) && !w.log[expired].After(since) {
+		expired++
+	}
+	w.log = append(w.log[:0], w.log[expired:]...)
 
-		count = 1.0
+	if len(w.log) < w.limit {
+		w.log = append(w.log, now)
+		return 0
 	}
 
-	l.lastUpdate = l.now()
-	l.lastCount = count
+	return w.log[0].Add(w.window).Sub(now)
 }
 
-func (l *timeBucketRateLimiter[T1, T2]) Exit(_ T1, _ T2, _ error) {
+func sleep(ctx context.Context, clock timer.Clock, delay time.Duration) error {
+	t := clock.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.Ticks():
+		return nil
+	}
 }
 
 var _ netshaper.Config[*http.Request, string] = (*RateLimitConfig[*http.Request, string])(nil)
@@ -96,6 +298,8 @@ func (c *RateLimitConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[
 		limiter: c.Limiter,
 		inner:   inner,
 		pending: pending,
+		metrics: metrics.FromContext(ctx),
+		logger:  netshaper.LoggerFromContext(ctx),
 	}
 
 	defer cl.wg.Add(1)
@@ -113,11 +317,12 @@ type rateLimitClient[T1 netshaper.Request, T2 any] struct {
 	inner   netshaper.Client[T1, T2]
 	wg      sync.WaitGroup
 	pending chan<- *requestJob[T1, T2]
+	metrics metrics.Metrics
+	logger  *slog.Logger
 }
 
 func (c *rateLimitClient[T1, T2]) Request(req T1) (res T2, err error) {
 	results := make(chan *responseResult[T2], 1)
-	defer close(results)
 
 	c.pending <- &requestJob[T1, T2]{
 		request: req,
@@ -150,13 +355,22 @@ func (c *rateLimitClient[T1, T2]) runWorker(pending <-chan *requestJob[T1, T2])
 		select {
 		case <-c.ctx.Done():
 			return
-		case req := <-pending:
-			c.handleJob(req)
+		case job, ok := <-pending:
+			if !ok {
+				return
+			}
+
+			// each job waits for the limiter on its own, so a request blocked by the limiter (e.g. by its key) does
+			// not block the others
+			c.wg.Add(1)
+			go c.handleJob(job)
 		}
 	}
 }
 
 func (c *rateLimitClient[T1, T2]) handleJob(job *requestJob[T1, T2]) {
+	defer c.wg.Done()
+
 	var res T2
 	var err error
 
@@ -168,10 +382,32 @@ func (c *rateLimitClient[T1, T2]) handleJob(job *requestJob[T1, T2]) {
 	case <-req.Context().Done():
 		err = req.Context().Err()
 	default:
-		c.limiter.Enter(req)
-		defer func() { c.limiter.Exit(req, res, err) }()
+		// the wait is interrupted once the client is closed
+		waitCtx, waitCancel := context.WithCancel(req.Context())
+		stop := context.AfterFunc(c.ctx, waitCancel)
+
+		start := time.Now()
+		err = enterLimiter(waitCtx, c.limiter, req)
+		stop()
+		waitCancel()
+		if err == nil && c.ctx.Err() != nil {
+			// the inner client is closed
+			c.limiter.Exit(req, res, c.ctx.Err())
+			err = c.ctx.Err()
+		}
+		wait := time.Since(start)
+		c.metrics.ObserveHistogram(metrics.RateLimiterWaitSeconds, wait.Seconds(), nil)
+		if err != nil {
+			c.logger.LogAttrs(req.Context(), slog.LevelDebug, "rate limiter wait failed", slog.Duration("wait", wait), slog.Any("error", err))
+		} else {
+			c.logger.LogAttrs(req.Context(), slog.LevelDebug, "rate limiter wait", slog.Duration("wait", wait))
+		}
+
+		if err == nil {
+			defer func() { c.limiter.Exit(req, res, err) }()
 
-		res, err = c.inner.Request(req)
+			res, err = c.inner.Request(req)
+		}
 	}
 
 	select {
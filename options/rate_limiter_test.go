@@ -0,0 +1,113 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"netshaper"
+	"testing"
+	"time"
+)
+
+type testRequest struct {
+	ctx context.Context
+	id  int
+}
+
+func (r *testRequest) Context() context.Context {
+	return r.ctx
+}
+
+func TestRateLimiterEnter(t *testing.T) {
+	tests := []struct {
+		name        string
+		limiter     func(clock *testClock) RateLimiter[*testRequest, string]
+		requests    int
+		wantElapsed time.Duration
+	}{
+		{
+			name: "token bucket within burst",
+			limiter: func(clock *testClock) RateLimiter[*testRequest, string] {
+				return NewTokenBucketLimiter[*testRequest, string](2, 3, clock)
+			},
+			requests:    3,
+			wantElapsed: 0,
+		},
+		{
+			name: "token bucket over burst",
+			limiter: func(clock *testClock) RateLimiter[*testRequest, string] {
+				return NewTokenBucketLimiter[*testRequest, string](2, 3, clock)
+			},
+			requests:    5,
+			wantElapsed: time.Second,
+		},
+		{
+			name: "token bucket with sub-second rate",
+			limiter: func(clock *testClock) RateLimiter[*testRequest, string] {
+				return NewTokenBucketLimiter[*testRequest, string](0.5, 1, clock)
+			},
+			requests:    3,
+			wantElapsed: 4 * time.Second,
+		},
+		{
+			name: "sliding window with sub-second window",
+			limiter: func(clock *testClock) RateLimiter[*testRequest, string] {
+				return NewSlidingWindowLimiter[*testRequest, string](2, 500*time.Millisecond, clock)
+			},
+			requests:    5,
+			wantElapsed: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newTestClock()
+			limiter := tt.limiter(clock)
+			start := clock.Now()
+
+			for i := 0; i < tt.requests; i++ {
+				if err := limiter.Enter(&testRequest{ctx: context.Background(), id: i}); err != nil {
+					t.Errorf("Enter() error got = %v, want nil", err)
+				}
+			}
+
+			if got := clock.Now().Sub(start); got != tt.wantElapsed {
+				t.Errorf("Enter() elapsed got = %v, want %v", got, tt.wantElapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	inner := &testClientConfig[*testRequest, string]{fn: func(_ *testRequest) (string, error) {
+		return "ok", nil
+	}}
+	cl, err := netshaper.NewClient[*testRequest, string](ctx,
+		testConfigOption[*testRequest, string](inner),
+		WithTokenBucketLimiter[*testRequest, string](1, 1),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	if _, err = cl.Request(&testRequest{ctx: ctx}); err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+	}
+
+	reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer reqCancel()
+
+	if _, err = cl.Request(&testRequest{ctx: reqCtx}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Request() error got = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// wait for the worker to give up on the cancelled request
+	time.Sleep(10 * time.Millisecond)
+	if got := inner.calls(); got != 1 {
+		t.Errorf("inner requests amount got = %v, want %v", got, 1)
+	}
+}
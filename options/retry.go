@@ -0,0 +1,333 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/timer"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts  = uint(3)
+	DefaultRetryInitialDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay     = 30 * time.Second
+	DefaultRetryMultiplier   = 2.0
+)
+
+func WithRetry[T1 any, T2 any](opts ...conf.Option[RetryPolicy[T1, T2]]) conf.Option[netshaper.Config[T1, T2]] {
+	return WithCircuitBreaker(WithRetryPolicy(opts...))
+}
+
+// WithRetryPolicy replaces the retries configured in CircuitBreakerConfig with the policy, it still may be combined
+// with WithCircuit.
+func WithRetryPolicy[T1 any, T2 any](opts ...conf.Option[RetryPolicy[T1, T2]]) conf.Option[CircuitBreakerConfig[T1, T2]] {
+	policy := NewRetryPolicy(opts...)
+
+	return conf.OptionFunc[CircuitBreakerConfig[T1, T2]](func(config CircuitBreakerConfig[T1, T2]) CircuitBreakerConfig[T1, T2] {
+		config.BreakerFactory = policy.newBreaker
+		return config
+	})
+}
+
+func WithRetryMaxAttempts[T1 any, T2 any](attempts uint) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.MaxAttempts = attempts
+		return policy
+	})
+}
+
+func WithRetryBackoff[T1 any, T2 any](initial time.Duration, multiplier float64, maxDelay time.Duration) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.InitialDelay = initial
+		policy.Multiplier = multiplier
+		policy.MaxDelay = maxDelay
+		return policy
+	})
+}
+
+func WithRetryJitter[T1 any, T2 any](jitter Jitter) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.Jitter = jitter
+		return policy
+	})
+}
+
+func WithRetryMaxElapsed[T1 any, T2 any](budget time.Duration) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.MaxElapsed = budget
+		return policy
+	})
+}
+
+func WithRetryClassifier[T1 any, T2 any](classifier RetryClassifier[T1, T2]) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.Classifier = classifier
+		return policy
+	})
+}
+
+func WithRetryClock[T1 any, T2 any](clock timer.Clock) conf.Option[RetryPolicy[T1, T2]] {
+	return conf.OptionFunc[RetryPolicy[T1, T2]](func(policy RetryPolicy[T1, T2]) RetryPolicy[T1, T2] {
+		policy.Clock = clock
+		return policy
+	})
+}
+
+type Jitter int
+
+const (
+	NoJitter Jitter = iota
+	// FullJitter picks a random delay between zero and the exponential delay.
+	FullJitter
+	// DecorrelatedJitter picks a random delay between the initial delay and three times the previous delay.
+	DecorrelatedJitter
+)
+
+type RetryDecision int
+
+const (
+	// RetryUndecided lets the next classifier in chain decide, the attempt is not retried if no one decides.
+	RetryUndecided RetryDecision = iota
+	RetryDenied
+	RetryAllowed
+)
+
+type RetryClassifier[T1 any, T2 any] func(req T1, res T2, err error) RetryDecision
+
+// RetryPolicy describes retries of a single request. MaxAttempts includes the first attempt, zero MaxAttempts and
+// MaxElapsed mean no limit. A Retry-After header of *http.Response overrides the backoff delay, the request is not
+// retried if it asks to wait longer than MaxDelay.
+type RetryPolicy[T1 any, T2 any] struct {
+	MaxAttempts  uint
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       Jitter
+	MaxElapsed   time.Duration
+	Classifier   RetryClassifier[T1, T2]
+	Clock        timer.Clock
+	Rand         func() float64
+}
+
+func NewRetryPolicy[T1 any, T2 any](opts ...conf.Option[RetryPolicy[T1, T2]]) *RetryPolicy[T1, T2] {
+	policy := conf.ApplyOptionsInit(opts, RetryPolicy[T1, T2]{MaxAttempts: DefaultRetryMaxAttempts})
+
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = DefaultRetryInitialDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryMaxDelay
+	}
+	if policy.Multiplier <= 0 {
+		policy.Multiplier = DefaultRetryMultiplier
+	}
+	if policy.Classifier == nil {
+		policy.Classifier = RetryOnError[T1, T2]
+	}
+	if policy.Rand == nil {
+		policy.Rand = rand.Float64
+	}
+	policy.Clock = timer.OrSystem(policy.Clock)
+
+	return &policy
+}
+
+// Delay returns the backoff delay before the retry (starting from 1) given the delay before the previous one.
+func (p *RetryPolicy[T1, T2]) Delay(retry uint, prev time.Duration) time.Duration {
+	switch p.Jitter {
+	case DecorrelatedJitter:
+		if prev < p.InitialDelay {
+			prev = p.InitialDelay
+		}
+		upper := math.Min(float64(p.MaxDelay), float64(prev)*3)
+		lower := float64(p.InitialDelay)
+
+		return time.Duration(lower + p.Rand()*math.Max(0, upper-lower))
+	case FullJitter:
+		return time.Duration(p.Rand() * float64(p.exponentialDelay(retry)))
+	default:
+		return p.exponentialDelay(retry)
+	}
+}
+
+func (p *RetryPolicy[T1, T2]) exponentialDelay(retry uint) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(retry)-1)
+
+	return time.Duration(math.Min(delay, float64(p.MaxDelay)))
+}
+
+func (p *RetryPolicy[T1, T2]) newBreaker() CircuitBreaker[T1, T2] {
+	return &retryCircuitBreaker[T1, T2]{
+		policy: p,
+		start:  p.Clock.Now(),
+	}
+}
+
+type retryCircuitBreaker[T1 any, T2 any] struct {
+	policy   *RetryPolicy[T1, T2]
+	start    time.Time
+	attempts uint
+	delay    time.Duration
+}
+
+func (b *retryCircuitBreaker[T1, T2]) Next(req T1, res T2, err error) (bool, T1, error) {
+	b.attempts++
+
+	ctx := requestContext(req)
+	if ctx.Err() != nil || b.policy.Classifier(req, res, err) != RetryAllowed {
+		return false, req, err
+	}
+
+	if limit := b.policy.MaxAttempts; limit > 0 && b.attempts >= limit {
+		return false, req, wrapRetryError(fmt.Sprintf("max attempts limit reached %v", limit), err)
+	}
+
+	now := b.policy.Clock.Now()
+	b.delay = b.policy.Delay(b.attempts, b.delay)
+	delay := b.delay
+	if until, ok := retryAfter(res, now); ok {
+		delay = until.Sub(now)
+		if delay > b.policy.MaxDelay {
+			return false, req, wrapRetryError(fmt.Sprintf("retry after %v exceeds max delay %v", delay, b.policy.MaxDelay), err)
+		}
+	}
+
+	if budget := b.policy.MaxElapsed; budget > 0 && now.Add(delay).Sub(b.start) > budget {
+		return false, req, wrapRetryError(fmt.Sprintf("max elapsed time budget exceeded %v", budget), err)
+	}
+
+	if sleepErr := sleep(ctx, b.policy.Clock, delay); sleepErr != nil {
+		return false, req, sleepErr
+	}
+
+	return true, req, nil
+}
+
+func wrapRetryError(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%s, last error: %w", reason, err)
+}
+
+func retryAfter[T2 any](res T2, now time.Time) (time.Time, bool) {
+	if httpRes, ok := any(res).(*http.Response); ok && httpRes != nil {
+		return parseRetryAfter(httpRes.Header.Get("Retry-After"), now)
+	}
+
+	return time.Time{}, false
+}
+
+type retryAttemptKey struct{}
+
+func ContextWithRetryAttempt(ctx context.Context, attempt uint) context.Context {
+	return context.WithValue(ctx, retryAttemptKey{}, attempt)
+}
+
+// RetryAttempt returns the zero based attempt number of the request sent by WithCircuitBreaker or WithRetry.
+func RetryAttempt(ctx context.Context) uint {
+	attempt, _ := ctx.Value(retryAttemptKey{}).(uint)
+	return attempt
+}
+
+func requestContext[T any](req T) context.Context {
+	if r, ok := any(req).(netshaper.Request); ok && r != nil {
+		return r.Context()
+	}
+
+	return context.Background()
+}
+
+func ChainRetryClassifiers[T1 any, T2 any](classifiers ...RetryClassifier[T1, T2]) RetryClassifier[T1, T2] {
+	return func(req T1, res T2, err error) RetryDecision {
+		for _, classifier := range classifiers {
+			if decision := classifier(req, res, err); decision != RetryUndecided {
+				return decision
+			}
+		}
+
+		return RetryUndecided
+	}
+}
+
+func RetryOnError[T1 any, T2 any](_ T1, _ T2, err error) RetryDecision {
+	if err != nil {
+		return RetryAllowed
+	}
+
+	return RetryUndecided
+}
+
+func DefaultHttpRetryClassifier() RetryClassifier[*http.Request, *http.Response] {
+	return ChainRetryClassifiers(
+		RetryIdempotentHttpMethods,
+		RetryHttpTooManyRequests,
+		RetryHttpServerErrors,
+		RetryHttpTimeouts,
+	)
+}
+
+// RetryIdempotentHttpMethods denies retries of requests with non-idempotent methods unless an Idempotency-Key header
+// is set.
+func RetryIdempotentHttpMethods(req *http.Request, _ *http.Response, _ error) RetryDecision {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return RetryUndecided
+	}
+
+	if req.Header.Get("Idempotency-Key") != "" {
+		return RetryUndecided
+	}
+
+	return RetryDenied
+}
+
+func RetryHttpTimeouts(_ *http.Request, _ *http.Response, err error) RetryDecision {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RetryAllowed
+	}
+
+	return RetryUndecided
+}
+
+func RetryHttpServerErrors(_ *http.Request, res *http.Response, _ error) RetryDecision {
+	if res != nil && res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented {
+		return RetryAllowed
+	}
+
+	return RetryUndecided
+}
+
+func RetryHttpTooManyRequests(_ *http.Request, res *http.Response, _ error) RetryDecision {
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return RetryAllowed
+	}
+
+	return RetryUndecided
+}
+
+func RetryHttpStatusCodes(codes ...int) RetryClassifier[*http.Request, *http.Response] {
+	codesMap := map[int]struct{}{}
+	for _, code := range codes {
+		codesMap[code] = struct{}{}
+	}
+
+	return func(_ *http.Request, res *http.Response, _ error) RetryDecision {
+		if res != nil {
+			if _, ok := codesMap[res.StatusCode]; ok {
+				return RetryAllowed
+			}
+		}
+
+		return RetryUndecided
+	}
+}
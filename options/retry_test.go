@@ -0,0 +1,273 @@
+package options
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *RetryPolicy[int, string]
+		want   []time.Duration
+	}{
+		{
+			name: "exponential without jitter",
+			policy: NewRetryPolicy(
+				WithRetryBackoff[int, string](100*time.Millisecond, 2, time.Second),
+			),
+			want: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second},
+		},
+		{
+			name: "exponential with float multiplier",
+			policy: NewRetryPolicy(
+				WithRetryBackoff[int, string](time.Second, 1.5, time.Minute),
+			),
+			want: []time.Duration{time.Second, 1500 * time.Millisecond, 2250 * time.Millisecond},
+		},
+		{
+			name: "full jitter",
+			policy: func() *RetryPolicy[int, string] {
+				p := NewRetryPolicy(
+					WithRetryBackoff[int, string](100*time.Millisecond, 2, time.Second),
+					WithRetryJitter[int, string](FullJitter),
+				)
+				p.Rand = func() float64 { return 0.5 }
+				return p
+			}(),
+			want: []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name: "decorrelated jitter",
+			policy: func() *RetryPolicy[int, string] {
+				p := NewRetryPolicy(
+					WithRetryBackoff[int, string](100*time.Millisecond, 2, time.Second),
+					WithRetryJitter[int, string](DecorrelatedJitter),
+				)
+				p.Rand = func() float64 { return 1 }
+				return p
+			}(),
+			want: []time.Duration{300 * time.Millisecond, 900 * time.Millisecond, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]time.Duration, 0, len(tt.want))
+			var prev time.Duration
+			for i := range tt.want {
+				prev = tt.policy.Delay(uint(i+1), prev)
+				got = append(got, prev)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Delay() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultHttpRetryClassifier(t *testing.T) {
+	classifier := DefaultHttpRetryClassifier()
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		status int
+		err    error
+		want   RetryDecision
+	}{
+		{name: "get ok", method: http.MethodGet, status: http.StatusOK, want: RetryUndecided},
+		{name: "get too many requests", method: http.MethodGet, status: http.StatusTooManyRequests, want: RetryAllowed},
+		{name: "get bad gateway", method: http.MethodGet, status: http.StatusBadGateway, want: RetryAllowed},
+		{name: "get not implemented", method: http.MethodGet, status: http.StatusNotImplemented, want: RetryUndecided},
+		{name: "get timeout", method: http.MethodGet, err: &testTimeoutError{}, want: RetryAllowed},
+		{name: "get other error", method: http.MethodGet, err: errors.New("failed"), want: RetryUndecided},
+		{name: "post bad gateway", method: http.MethodPost, status: http.StatusBadGateway, want: RetryDenied},
+		{name: "post bad gateway with idempotency key", method: http.MethodPost, header: http.Header{"Idempotency-Key": {"1"}}, status: http.StatusBadGateway, want: RetryAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "http://localhost", nil)
+			if tt.header != nil {
+				req.Header = tt.header
+			}
+
+			var res *http.Response
+			if tt.status != 0 {
+				res = &http.Response{StatusCode: tt.status}
+			}
+
+			if got := classifier(req, res, tt.err); got != tt.want {
+				t.Errorf("classifier() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryClient(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name         string
+		opts         []testRetryOption
+		responses    []*http.Response
+		wantAttempts int
+		wantElapsed  time.Duration
+		wantStatus   int
+		wantErr      bool
+	}{
+		{
+			name: "retry server errors until success",
+			responses: []*http.Response{
+				{StatusCode: http.StatusBadGateway},
+				{StatusCode: http.StatusBadGateway},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 3,
+			wantElapsed:  300 * time.Millisecond,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "honor retry after",
+			responses: []*http.Response{
+				{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 2,
+			wantElapsed:  5 * time.Second,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "honor retry after up to max delay",
+			opts: []testRetryOption{WithRetryBackoff[*http.Request, *http.Response](100*time.Millisecond, 2, 5*time.Second)},
+			responses: []*http.Response{
+				{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 2,
+			wantElapsed:  5 * time.Second,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "stop when retry after exceeds max delay",
+			opts: []testRetryOption{WithRetryBackoff[*http.Request, *http.Response](100*time.Millisecond, 2, 5*time.Second)},
+			responses: []*http.Response{
+				{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"6"}}},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 1,
+			wantStatus:   http.StatusTooManyRequests,
+		},
+		{
+			name: "stop after max attempts",
+			opts: []testRetryOption{WithRetryMaxAttempts[*http.Request, *http.Response](2)},
+			responses: []*http.Response{
+				{StatusCode: http.StatusBadGateway},
+				{StatusCode: http.StatusBadGateway},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 2,
+			wantElapsed:  100 * time.Millisecond,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name: "stop when elapsed budget exceeded",
+			opts: []testRetryOption{WithRetryMaxElapsed[*http.Request, *http.Response](time.Second)},
+			responses: []*http.Response{
+				{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"10"}}},
+				{StatusCode: http.StatusOK},
+			},
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name: "error with retries exhausted",
+			opts: []testRetryOption{
+				WithRetryMaxAttempts[*http.Request, *http.Response](2),
+				WithRetryClassifier(RetryOnError[*http.Request, *http.Response]),
+			},
+			responses:    []*http.Response{nil, nil},
+			wantAttempts: 2,
+			wantElapsed:  100 * time.Millisecond,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+
+			inner := &testClientConfig[*http.Request, *http.Response]{}
+			inner.fn = func(_ *http.Request) (*http.Response, error) {
+				res := tt.responses[inner.calls()-1]
+				if res == nil {
+					return nil, errFailed
+				}
+				return res, nil
+			}
+
+			opts := append([]testRetryOption{
+				WithRetryMaxAttempts[*http.Request, *http.Response](5),
+				WithRetryBackoff[*http.Request, *http.Response](100*time.Millisecond, 2, time.Minute),
+				WithRetryClassifier(DefaultHttpRetryClassifier()),
+				WithRetryClock[*http.Request, *http.Response](clock),
+			}, tt.opts...)
+
+			cl, err := netshaper.NewClient[*http.Request, *http.Response](ctx,
+				testConfigOption[*http.Request, *http.Response](inner),
+				WithRetry(opts...),
+			)
+			if err != nil {
+				t.Errorf("NewClient() error got = %v, want nil", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+			start := clock.Now()
+			res, err := cl.Request(req)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Request() error got = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errFailed) {
+				t.Errorf("Request() error got = %v, want wrapped %v", err, errFailed)
+			}
+			if !tt.wantErr && res.StatusCode != tt.wantStatus {
+				t.Errorf("Request() status got = %v, want %v", res.StatusCode, tt.wantStatus)
+			}
+			if got := inner.calls(); got != tt.wantAttempts {
+				t.Errorf("inner requests amount got = %v, want %v", got, tt.wantAttempts)
+			}
+			if got := clock.Now().Sub(start); got != tt.wantElapsed {
+				t.Errorf("Request() elapsed got = %v, want %v", got, tt.wantElapsed)
+			}
+		})
+	}
+}
+
+type testRetryOption = conf.Option[RetryPolicy[*http.Request, *http.Response]]
+
+type testTimeoutError struct{}
+
+func (e *testTimeoutError) Error() string {
+	return "timeout"
+}
+
+func (e *testTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *testTimeoutError) Temporary() bool {
+	return true
+}
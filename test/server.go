@@ -44,3 +44,12 @@ func NewWsServer(mux *netWs.Server) (netshaper.URL, *httptest.Server) {
 
 	return *url, srv
 }
+
+func NewWsTLSServer(mux *netWs.Server) (netshaper.URL, *httptest.Server) {
+	srv := httptest.NewTLSServer(mux)
+
+	url, _ := netshaper.ParseURL(srv.URL)
+	url.Scheme = "wss"
+
+	return *url, srv
+}
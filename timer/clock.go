@@ -0,0 +1,30 @@
+package timer
+
+import (
+	"time"
+)
+
+var System Clock = systemClock{}
+
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+func OrSystem(clock Clock) Clock {
+	if clock == nil {
+		return System
+	}
+
+	return clock
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return (*timer)(time.NewTimer(d))
+}
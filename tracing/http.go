@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"net/url"
+	"netshaper/options"
+	"strconv"
+)
+
+// URLTemplateKey is not defined by the semconv version used.
+const URLTemplateKey = attribute.Key("url.template")
+
+func httpRequestSpan(req *http.Request, urlTemplate func(req *http.Request) string) (string, []trace.SpanStartOption) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	name := method
+	attrs := append(urlAttributes(req.URL), semconv.HTTPRequestMethodKey.String(method))
+
+	if urlTemplate != nil {
+		if template := urlTemplate(req); template != "" {
+			name += " " + template
+			attrs = append(attrs, URLTemplateKey.String(template))
+		}
+	}
+
+	if attempt := options.RetryAttempt(req.Context()); attempt > 0 {
+		attrs = append(attrs, semconv.HTTPRequestResendCount(int(attempt)))
+	}
+
+	return name, []trace.SpanStartOption{trace.WithAttributes(attrs...)}
+}
+
+func setHttpResponseAttributes(span trace.Span, res *http.Response) {
+	if res == nil {
+		return
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+
+	if res.StatusCode >= 400 {
+		span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(res.StatusCode)))
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+}
+
+func urlAttributes(u *url.URL) []attribute.KeyValue {
+	if u == nil {
+		return nil
+	}
+
+	full := *u
+	full.User = nil
+
+	attrs := []attribute.KeyValue{semconv.URLFull(full.String())}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, defaultPort(u.Scheme)
+	}
+	if host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+
+	return attrs
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	default:
+		return ""
+	}
+}
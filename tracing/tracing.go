@@ -0,0 +1,167 @@
+// Package tracing creates OpenTelemetry spans for netshaper clients. It is a separate module, so netshaper itself does
+// not depend on OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/websocket"
+)
+
+const InstrumentationName = "netshaper/tracing"
+
+// WithTracing creates a client span per request. Put it before retries in the options list to get a span per attempt.
+// Spans of websocket requests last until the connection is closed and get an event per sent and received message.
+func WithTracing[T1 netshaper.Request, T2 any](opts ...conf.Option[Config]) conf.Option[netshaper.Config[T1, T2]] {
+	return conf.OptionFunc[netshaper.Config[T1, T2]](func(config netshaper.Config[T1, T2]) netshaper.Config[T1, T2] {
+		return &ClientConfig[T1, T2]{Inner: config, Tracing: conf.ApplyOptions(opts)}
+	})
+}
+
+func WithTracerProvider(provider trace.TracerProvider) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.TracerProvider = provider
+		return config
+	})
+}
+
+func WithPropagator(propagator propagation.TextMapPropagator) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.Propagator = propagator
+		return config
+	})
+}
+
+// WithHttpURLTemplate sets the low cardinality URL template used in the span name, e.g.
+// options.HttpPathTemplateKey("/users/{id}").
+func WithHttpURLTemplate(template func(req *http.Request) string) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		config.HttpURLTemplate = template
+		return config
+	})
+}
+
+// Config describes spans of a client. The global tracer provider is used by default, the global propagator is used if
+// it is set, otherwise W3C trace context headers are injected.
+type Config struct {
+	TracerProvider  trace.TracerProvider
+	Propagator      propagation.TextMapPropagator
+	HttpURLTemplate func(req *http.Request) string
+}
+
+var _ netshaper.Config[*http.Request, *http.Response] = (*ClientConfig[*http.Request, *http.Response])(nil)
+
+type ClientConfig[T1 netshaper.Request, T2 any] struct {
+	Inner   netshaper.Config[T1, T2]
+	Tracing Config
+}
+
+func (c *ClientConfig[T1, T2]) Create(ctx context.Context) (netshaper.Client[T1, T2], error) {
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := c.Tracing.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	propagator := c.Tracing.Propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+		if len(propagator.Fields()) == 0 {
+			propagator = propagation.TraceContext{}
+		}
+	}
+
+	return &client[T1, T2]{
+		inner:       inner,
+		tracer:      provider.Tracer(InstrumentationName),
+		propagator:  propagator,
+		urlTemplate: c.Tracing.HttpURLTemplate,
+	}, nil
+}
+
+var _ netshaper.Client[*http.Request, *http.Response] = (*client[*http.Request, *http.Response])(nil)
+
+type client[T1 netshaper.Request, T2 any] struct {
+	inner       netshaper.Client[T1, T2]
+	tracer      trace.Tracer
+	propagator  propagation.TextMapPropagator
+	urlTemplate func(req *http.Request) string
+}
+
+func (c *client[T1, T2]) Request(req T1) (res T2, err error) {
+	var name string
+	var attrs []trace.SpanStartOption
+
+	switch r := any(req).(type) {
+	case *http.Request:
+		name, attrs = httpRequestSpan(r, c.urlTemplate)
+	case *websocket.Request:
+		name, attrs = websocketRequestSpan(r)
+	default:
+		name = "netshaper.request"
+	}
+
+	ctx, span := c.tracer.Start(req.Context(), name, append(attrs, trace.WithSpanKind(trace.SpanKindClient))...)
+	req = c.bind(ctx, req)
+
+	res, err = c.inner.Request(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	switch r := any(res).(type) {
+	case *http.Response:
+		setHttpResponseAttributes(span, r)
+	case websocket.RawResponse:
+		if _, exact := any(&res).(*websocket.RawResponse); exact && r != nil && err == nil {
+			// the span is ended when the connection is closed
+			return any(newTracedResponse(span, r)).(T2), nil
+		}
+	}
+
+	span.End()
+
+	return
+}
+
+func (c *client[T1, T2]) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
+
+// bind passes the span context to the inner client and injects it into the request headers.
+func (c *client[T1, T2]) bind(ctx context.Context, req T1) T1 {
+	switch r := any(req).(type) {
+	case *http.Request:
+		r = r.WithContext(ctx)
+		r.Header = r.Header.Clone()
+		if r.Header == nil {
+			r.Header = http.Header{}
+		}
+		c.propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+		return any(r).(T1)
+	case *websocket.Request:
+		clone := *r
+		clone.Ctx = ctx
+		clone.Headers = r.Headers.Clone()
+		if clone.Headers == nil {
+			clone.Headers = netshaper.Headers{}
+		}
+		c.propagator.Inject(ctx, propagation.HeaderCarrier(clone.Headers))
+
+		return any(&clone).(T1)
+	default:
+		return req
+	}
+}
@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	netWs "golang.org/x/net/websocket"
+	netHttp "net/http"
+	"netshaper"
+	"netshaper/http"
+	"netshaper/options"
+	"netshaper/test"
+	"netshaper/websocket"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHttpTracing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var traceParents []string
+
+	url, srv := test.NewHttpHandlerFunc("/users/42", func(writer netHttp.ResponseWriter, request *netHttp.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		traceParents = append(traceParents, request.Header.Get("Traceparent"))
+		if len(traceParents) == 1 {
+			writer.WriteHeader(netHttp.StatusServiceUnavailable)
+		}
+	})
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cl, err := netshaper.NewClient(ctx,
+		http.NewNet(http.WithNetClient(srv.Client())),
+		WithTracing[*http.Request, *http.Response](
+			WithTracerProvider(provider),
+			WithHttpURLTemplate(options.HttpPathTemplateKey("/users/{id}")),
+		),
+		options.WithRetry(
+			options.WithRetryBackoff[*http.Request, *http.Response](time.Millisecond, 1, time.Millisecond),
+			options.WithRetryClassifier(options.RetryHttpServerErrors),
+		),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	req, _ := http.NewGetRequest(ctx, url, nil)
+	res, err := cl.Request(req)
+	if err != nil || res.StatusCode != netHttp.StatusOK {
+		t.Errorf("Request() got = %v, %v, want 200 OK", res, err)
+		return
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Errorf("spans amount got = %v, want 2", len(spans))
+		return
+	}
+
+	for i, span := range spans {
+		if span.Name() != "GET /users/{id}" {
+			t.Errorf("span %v name got = %v, want %v", i, span.Name(), "GET /users/{id}")
+		}
+
+		attrs := attributesMap(span.Attributes())
+		if got := attrs[semconv.URLFullKey]; got != attribute.StringValue(url.String()) {
+			t.Errorf("span %v url.full got = %v, want %v", i, got.Emit(), url.String())
+		}
+		if got := attrs[URLTemplateKey]; got != attribute.StringValue("/users/{id}") {
+			t.Errorf("span %v url.template got = %v", i, got.Emit())
+		}
+
+		wantParent := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+		if traceParents[i] != wantParent {
+			t.Errorf("span %v traceparent got = %v, want %v", i, traceParents[i], wantParent)
+		}
+	}
+
+	first, second := attributesMap(spans[0].Attributes()), attributesMap(spans[1].Attributes())
+	if got := first[semconv.HTTPResponseStatusCodeKey]; got != attribute.IntValue(503) {
+		t.Errorf("first span status code got = %v, want 503", got.Emit())
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("first span status got = %v, want %v", spans[0].Status().Code, codes.Error)
+	}
+	if _, ok := first[semconv.HTTPRequestResendCountKey]; ok {
+		t.Errorf("first span must not have resend count")
+	}
+	if got := second[semconv.HTTPRequestResendCountKey]; got != attribute.IntValue(1) {
+		t.Errorf("second span resend count got = %v, want 1", got.Emit())
+	}
+}
+
+func TestWebsocketTracing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	url, srv := test.NewWsHandler(func(conn *netWs.Conn) {
+		var msg []byte
+		_ = netWs.Message.Receive(conn, &msg)
+		_ = netWs.Message.Send(conn, msg)
+		_ = netWs.Message.Send(conn, append(msg, msg...))
+	})
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cl, err := netshaper.NewClient(ctx,
+		websocket.NewNet(),
+		WithTracing[*websocket.Request, websocket.RawResponse](WithTracerProvider(provider)),
+	)
+	if err != nil {
+		t.Errorf("NewClient() error got = %v, want nil", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	res, err := cl.Request(&websocket.Request{Ctx: ctx, URL: url})
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+
+	if err = res.Send(websocket.ByteMessage("hey")); err != nil {
+		t.Errorf("Send() error got = %v, want nil", err)
+	}
+	messages := res.Listen()
+	<-messages
+	<-messages
+	res.Close(ctx)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Errorf("spans amount got = %v, want 1", len(spans))
+		return
+	}
+
+	if name := spans[0].Name(); name != "WS /" {
+		t.Errorf("span name got = %v, want %v", name, "WS /")
+	}
+
+	var gotEvents []string
+	for _, event := range spans[0].Events() {
+		attrs := attributesMap(event.Attributes)
+		gotEvents = append(gotEvents, event.Name+" "+attrs["message.type"].Emit()+" "+attrs["message.uncompressed_size"].Emit())
+	}
+
+	wantEvents := []string{"message SENT 3", "message RECEIVED 3", "message RECEIVED 6"}
+	if !reflect.DeepEqual(gotEvents, wantEvents) {
+		t.Errorf("span events got = %v, want %v", gotEvents, wantEvents)
+	}
+}
+
+func attributesMap(attrs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, attr := range attrs {
+		m[attr.Key] = attr.Value
+	}
+
+	return m
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"netshaper/websocket"
+	"sync"
+)
+
+const (
+	MessageEventName = "message"
+
+	MessageTypeSent     = "SENT"
+	MessageTypeReceived = "RECEIVED"
+)
+
+func websocketRequestSpan(req *websocket.Request) (string, []trace.SpanStartOption) {
+	attrs := append(urlAttributes(&req.URL), semconv.NetworkProtocolName("websocket"))
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return "WS " + path, []trace.SpanStartOption{trace.WithAttributes(attrs...)}
+}
+
+var _ websocket.RawResponse = (*tracedResponse)(nil)
+
+// tracedResponse adds span events per message. The span is ended when the connection is closed or, if messages are
+// listened, when all received messages are forwarded.
+type tracedResponse struct {
+	websocket.RawResponse
+	span       trace.Span
+	listenOnce sync.Once
+	listening  bool
+	messages   chan websocket.Message
+	endOnce    sync.Once
+	sent       int
+	received   int
+	mu         sync.Mutex
+}
+
+func newTracedResponse(span trace.Span, res websocket.RawResponse) *tracedResponse {
+	r := &tracedResponse{
+		RawResponse: res,
+		span:        span,
+	}
+
+	go func() {
+		<-res.Closed()
+
+		r.mu.Lock()
+		listening := r.listening
+		r.mu.Unlock()
+
+		if !listening {
+			r.end()
+		}
+	}()
+
+	return r
+}
+
+func (r *tracedResponse) Send(message websocket.Message) error {
+	err := r.RawResponse.Send(message)
+	if err != nil {
+		r.span.RecordError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	r.sent++
+	id := r.sent
+	r.mu.Unlock()
+
+	r.addMessageEvent(MessageTypeSent, id, message)
+
+	return nil
+}
+
+func (r *tracedResponse) Listen() <-chan websocket.Message {
+	r.listenOnce.Do(func() {
+		inner := r.RawResponse.Listen()
+		r.messages = make(chan websocket.Message, cap(inner))
+
+		r.mu.Lock()
+		r.listening = true
+		r.mu.Unlock()
+
+		go func() {
+			defer r.end()
+			defer close(r.messages)
+
+			for msg := range inner {
+				if err := msg.Err(); err != nil {
+					r.span.RecordError(err)
+				} else {
+					r.mu.Lock()
+					r.received++
+					id := r.received
+					r.mu.Unlock()
+
+					r.addMessageEvent(MessageTypeReceived, id, msg)
+				}
+
+				r.messages <- msg
+			}
+		}()
+	})
+
+	return r.messages
+}
+
+func (r *tracedResponse) Close(ctx context.Context) {
+	r.RawResponse.Close(ctx)
+	r.end()
+}
+
+func (r *tracedResponse) addMessageEvent(messageType string, id int, msg websocket.Message) {
+	r.span.AddEvent(MessageEventName, trace.WithAttributes(
+		attribute.String("message.type", messageType),
+		attribute.Int("message.id", id),
+		attribute.Int("message.uncompressed_size", len(msg.Buff())),
+	))
+}
+
+func (r *tracedResponse) end() {
+	r.endOnce.Do(func() {
+		if err := r.RawResponse.Err(); err != nil {
+			r.span.RecordError(err)
+			r.span.SetStatus(codes.Error, err.Error())
+		}
+
+		r.span.End()
+	})
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// CloseCode is the status code of a close frame, see RFC 6455 section 7.4.
+type CloseCode int
+
+const (
+	CloseNormalClosure      CloseCode = 1000
+	CloseGoingAway          CloseCode = 1001
+	CloseProtocolError      CloseCode = 1002
+	CloseUnsupportedData    CloseCode = 1003
+	CloseNoStatusReceived   CloseCode = 1005
+	CloseAbnormalClosure    CloseCode = 1006
+	CloseInvalidPayloadData CloseCode = 1007
+	ClosePolicyViolation    CloseCode = 1008
+	CloseMessageTooBig      CloseCode = 1009
+	CloseMandatoryExtension CloseCode = 1010
+	CloseInternalError      CloseCode = 1011
+	CloseServiceRestart     CloseCode = 1012
+	CloseTryAgainLater      CloseCode = 1013
+	CloseTLSHandshake       CloseCode = 1015
+)
+
+const (
+	DefaultWsCloseCode    = CloseNormalClosure
+	DefaultWsCloseTimeout = 5 * time.Second
+)
+
+// maxCloseReasonSize is the control frame payload limit of 125 bytes without the code.
+const maxCloseReasonSize = 123
+
+// CloseError is a close frame. Responses return it from Err once the peer closed the connection with a code other
+// than CloseNormalClosure.
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with status %d", e.Code)
+	}
+
+	return fmt.Sprintf("websocket closed with status %d: %v", e.Code, e.Reason)
+}
+
+// CloseStatuser is implemented by responses, which keep the close frame received from the peer.
+type CloseStatuser interface {
+	// CloseStatus returns the close frame received from the peer, nil until the peer closed the connection.
+	CloseStatus() *CloseError
+}
+
+// parseCloseFrame parses the payload of a close frame, its code is CloseNoStatusReceived if the payload is empty.
+func parseCloseFrame(payload []byte) *CloseError {
+	if len(payload) < 2 {
+		return &CloseError{Code: CloseNoStatusReceived}
+	}
+
+	return &CloseError{Code: CloseCode(binary.BigEndian.Uint16(payload)), Reason: string(payload[2:])}
+}
+
+// newCloseStatus returns the close frame sent by the client. Codes which must not be sent fall back to
+// DefaultWsCloseCode, the reason is truncated to maxCloseReasonSize bytes at a UTF-8 boundary.
+func newCloseStatus(code CloseCode, reason string) *CloseError {
+	switch {
+	case code < 1000, code == CloseNoStatusReceived, code == CloseAbnormalClosure, code == CloseTLSHandshake:
+		code = DefaultWsCloseCode
+	}
+
+	if len(reason) > maxCloseReasonSize {
+		size := maxCloseReasonSize
+		for size > 0 && !utf8.RuneStart(reason[size]) {
+			size--
+		}
+		reason = reason[:size]
+	}
+
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// closeFramePayload returns the payload of a close frame, it's empty for CloseNoStatusReceived, which must not be sent.
+func closeFramePayload(status *CloseError) []byte {
+	if status.Code == CloseNoStatusReceived {
+		return nil
+	}
+
+	return append(binary.BigEndian.AppendUint16(nil, uint16(status.Code)), status.Reason...)
+}
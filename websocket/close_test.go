@@ -0,0 +1,318 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/websocket"
+	"io"
+	"netshaper"
+	"netshaper/metrics"
+	"netshaper/test"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCloseFrame sends close frames with the status as payload.
+var testCloseFrame = websocket.Codec{Marshal: func(v any) ([]byte, byte, error) {
+	return closeFramePayload(v.(*CloseError)), websocket.CloseFrame, nil
+}}
+
+// testReceiveClose reads frames until the close frame of the peer and returns its status.
+func testReceiveClose(conn *websocket.Conn) *CloseError {
+	for {
+		frame, err := conn.NewFrameReader()
+		if err != nil {
+			return nil
+		}
+		payload, err := io.ReadAll(frame)
+		if err != nil {
+			return nil
+		}
+		if frame.PayloadType() == websocket.CloseFrame {
+			return parseCloseFrame(payload)
+		}
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       CloseCode
+		reason     string
+		answer     bool
+		wantStatus *CloseError
+		maxClose   time.Duration
+	}{
+		{
+			name:       "answered",
+			code:       CloseGoingAway,
+			reason:     "shutting down",
+			answer:     true,
+			wantStatus: &CloseError{Code: CloseGoingAway, Reason: "shutting down"},
+			maxClose:   50 * time.Millisecond,
+		},
+		{
+			name:       "unanswered",
+			code:       CloseNormalClosure,
+			wantStatus: &CloseError{Code: CloseNormalClosure},
+			maxClose:   500 * time.Millisecond,
+		},
+	}
+
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				statuses := make(chan *CloseError, 1)
+				done := make(chan struct{})
+				answer := tt.answer
+				url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+					statuses <- testReceiveClose(conn)
+					if !answer {
+						<-done
+					}
+				})
+				defer srv.Close()
+				defer close(done)
+
+				cl, err := netshaper.New(backend.closing(tt.code, tt.reason, 100*time.Millisecond)).Create(ctx)
+				if err != nil {
+					t.Errorf("Create() error = %v", err)
+					return
+				}
+				defer cl.Close(ctx)
+
+				res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+				if err != nil {
+					t.Errorf("Request() error = %v", err)
+					return
+				}
+
+				start := time.Now()
+				res.Close(ctx)
+				if elapsed := time.Since(start); elapsed > tt.maxClose {
+					t.Errorf("Close() took = %v, want at most %v", elapsed, tt.maxClose)
+				}
+
+				select {
+				case status := <-statuses:
+					if !reflect.DeepEqual(status, tt.wantStatus) {
+						t.Errorf("close frame got = %v, want %v", status, tt.wantStatus)
+					}
+				case <-ctx.Done():
+					t.Errorf("close frame got none, want %v", tt.wantStatus)
+				}
+				if err = res.Err(); err != nil {
+					t.Errorf("Err() got = %v, want %v", err, nil)
+				}
+			})
+		}
+	}
+}
+
+func TestClosePeer(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     *CloseError
+		wantErr    error
+		wantStatus *CloseError
+	}{
+		{
+			name:       "normal closure",
+			status:     &CloseError{Code: CloseNormalClosure, Reason: "bye"},
+			wantStatus: &CloseError{Code: CloseNormalClosure, Reason: "bye"},
+		},
+		{
+			name:       "no status",
+			status:     &CloseError{Code: CloseNoStatusReceived},
+			wantStatus: &CloseError{Code: CloseNoStatusReceived},
+		},
+		{
+			name:       "policy violation",
+			status:     &CloseError{Code: ClosePolicyViolation, Reason: "unauthorized"},
+			wantErr:    &CloseError{Code: ClosePolicyViolation, Reason: "unauthorized"},
+			wantStatus: &CloseError{Code: ClosePolicyViolation, Reason: "unauthorized"},
+		},
+	}
+
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+					_ = testCloseFrame.Send(conn, tt.status)
+					testReceiveClose(conn)
+				})
+				defer srv.Close()
+
+				cl, err := netshaper.New(backend.create(0), WithHeartbeat()).Create(ctx)
+				if err != nil {
+					t.Errorf("Create() error = %v", err)
+					return
+				}
+				defer cl.Close(ctx)
+
+				res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+				if err != nil {
+					t.Errorf("Request() error = %v", err)
+					return
+				}
+				defer res.Close(ctx)
+
+				select {
+				case <-res.Closed():
+				case <-ctx.Done():
+					t.Errorf("Closed() got none, want closed")
+					return
+				}
+
+				if err = res.Err(); !reflect.DeepEqual(err, tt.wantErr) {
+					t.Errorf("Err() got = %v, want %v", err, tt.wantErr)
+				}
+				if status := res.(CloseStatuser).CloseStatus(); !reflect.DeepEqual(status, tt.wantStatus) {
+					t.Errorf("CloseStatus() got = %v, want %v", status, tt.wantStatus)
+				}
+			})
+		}
+	}
+}
+
+func TestCloseRobust(t *testing.T) {
+	tests := []struct {
+		name           string
+		code           CloseCode
+		wantMessage    Message
+		wantErr        error
+		wantReconnects float64
+	}{
+		{
+			name:           "going away",
+			code:           CloseGoingAway,
+			wantMessage:    TextMessage("hello"),
+			wantReconnects: 1,
+		},
+		{
+			name:    "policy violation",
+			code:    ClosePolicyViolation,
+			wantErr: &CloseError{Code: ClosePolicyViolation},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrics.NewMemory()
+			ctx, cancel := context.WithTimeout(metrics.ContextWith(context.Background(), m), time.Second)
+			defer cancel()
+
+			// the first connection is closed by the peer, the next ones greet
+			var connections atomic.Int32
+			url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+				if connections.Add(1) == 1 {
+					_ = testCloseFrame.Send(conn, &CloseError{Code: tt.code})
+				} else {
+					_ = websocket.Message.Send(conn, "hello")
+				}
+				testReceiveClose(conn)
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.New(NewNet(), WithRobust()).Create(ctx)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+			if err != nil {
+				t.Errorf("Request() error = %v", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			msg := <-res.Listen()
+			if !reflect.DeepEqual(msg, tt.wantMessage) {
+				t.Errorf("Listen() message got = %v, want %v", msg, tt.wantMessage)
+			}
+			if err = res.Err(); !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Err() got = %v, want %v", err, tt.wantErr)
+			}
+			if got := m.Counter(metrics.WebsocketReconnectsTotal, nil); got != tt.wantReconnects {
+				t.Errorf("reconnects got = %v, want %v", got, tt.wantReconnects)
+			}
+		})
+	}
+}
+
+func TestDefaultRobustReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error", want: true},
+		{name: "connection error", err: io.ErrUnexpectedEOF, want: true},
+		{name: "heartbeat timeout", err: ErrHeartbeatTimeout, want: true},
+		{name: "going away", err: &CloseError{Code: CloseGoingAway}, want: true},
+		{name: "policy violation", err: &CloseError{Code: ClosePolicyViolation}, want: false},
+		{name: "wrapped policy violation", err: errors.Join(ErrHeartbeatTimeout, &CloseError{Code: ClosePolicyViolation}), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRobustReconnect(tt.err); got != tt.want {
+				t.Errorf("DefaultRobustReconnect() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCloseStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   CloseCode
+		reason string
+		want   *CloseError
+	}{
+		{name: "valid", code: CloseGoingAway, reason: "bye", want: &CloseError{Code: CloseGoingAway, Reason: "bye"}},
+		{name: "application code", code: 4000, want: &CloseError{Code: 4000}},
+		{name: "zero code", want: &CloseError{Code: DefaultWsCloseCode}},
+		{name: "code below 1000", code: 999, want: &CloseError{Code: DefaultWsCloseCode}},
+		{name: "no status received", code: CloseNoStatusReceived, want: &CloseError{Code: DefaultWsCloseCode}},
+		{name: "abnormal closure", code: CloseAbnormalClosure, want: &CloseError{Code: DefaultWsCloseCode}},
+		{name: "tls handshake", code: CloseTLSHandshake, want: &CloseError{Code: DefaultWsCloseCode}},
+		{
+			name:   "max reason",
+			code:   CloseNormalClosure,
+			reason: strings.Repeat("a", 123),
+			want:   &CloseError{Code: CloseNormalClosure, Reason: strings.Repeat("a", 123)},
+		},
+		{
+			name:   "long reason",
+			code:   CloseNormalClosure,
+			reason: strings.Repeat("a", 124),
+			want:   &CloseError{Code: CloseNormalClosure, Reason: strings.Repeat("a", 123)},
+		},
+		{
+			name:   "long reason cut at rune boundary",
+			code:   CloseNormalClosure,
+			reason: strings.Repeat("a", 122) + "ä",
+			want:   &CloseError{Code: CloseNormalClosure, Reason: strings.Repeat("a", 122)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newCloseStatus(tt.code, tt.reason); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newCloseStatus() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
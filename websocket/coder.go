@@ -0,0 +1,439 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	coderWs "github.com/coder/websocket"
+	netWs "golang.org/x/net/websocket"
+	"io"
+	netHttp "net/http"
+	"net/url"
+	"netshaper/conf"
+	"netshaper/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewCoder creates clients on github.com/coder/websocket, requests and responses behave as with NewNet.
+func NewCoder(opts ...conf.Option[CoderConfig]) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		if config != nil {
+			panic(fmt.Errorf("coder option received non-nil config %#v", config))
+		}
+
+		cfg := conf.ApplyOptions(opts)
+		return &cfg
+	})
+}
+
+func WithCoderProtocol(protocol string) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.Protocol = protocol
+		return config
+	})
+}
+
+func WithCoderOrigin(origin string) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.Origin = origin
+		return config
+	})
+}
+
+func WithCoderReceiveTimeout(timeout time.Duration) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.ReceiveTimeout = timeout
+		return config
+	})
+}
+
+func WithCoderBufferSize(size uint) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.BufferSize = size
+		return config
+	})
+}
+
+// WithCoderHandshakeTimeout limits the time to connect, including proxy, TLS and websocket handshakes.
+func WithCoderHandshakeTimeout(timeout time.Duration) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.HandshakeTimeout = timeout
+		return config
+	})
+}
+
+// WithCoderHTTPClient sets the client of the handshake, its transport configures TLS and proxies.
+func WithCoderHTTPClient(client *netHttp.Client) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.HTTPClient = client
+		return config
+	})
+}
+
+// WithCoderReadLimit limits the size of received messages, -1 disables the limit. It's websocket.DefaultMaxPayloadBytes
+// of golang.org/x/net/websocket by default as with NewNet, unlike the 32 KiB default of github.com/coder/websocket.
+// A message over the limit closes the connection with CloseMessageTooBig, NewNet drops it with an ErrFrameTooLarge
+// message instead.
+func WithCoderReadLimit(limit int64) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.ReadLimit = limit
+		return config
+	})
+}
+
+func WithCoderCompression(mode coderWs.CompressionMode) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.Compression = mode
+		return config
+	})
+}
+
+// WithCoderCloseStatus sets the code and the reason of the close frame sent on Close. Codes which must not be sent
+// (e.g. CloseNoStatusReceived) fall back to DefaultWsCloseCode, the reason is truncated to 123 bytes.
+func WithCoderCloseStatus(code CloseCode, reason string) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.CloseCode = code
+		config.CloseReason = reason
+		return config
+	})
+}
+
+// WithCoderCloseTimeout limits the wait for the close frame of the peer on Close.
+func WithCoderCloseTimeout(timeout time.Duration) conf.Option[CoderConfig] {
+	return conf.OptionFunc[CoderConfig](func(config CoderConfig) CoderConfig {
+		config.CloseTimeout = timeout
+		return config
+	})
+}
+
+var _ Config = (*CoderConfig)(nil)
+
+type CoderConfig struct {
+	Protocol         string
+	Origin           string
+	ReceiveTimeout   time.Duration
+	BufferSize       uint
+	HandshakeTimeout time.Duration
+	HTTPClient       *netHttp.Client
+	ReadLimit        int64
+	Compression      coderWs.CompressionMode
+	CloseCode        CloseCode
+	CloseReason      string
+	CloseTimeout     time.Duration
+}
+
+func (c *CoderConfig) Create(ctx context.Context) (Client, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	protocol := c.Protocol
+	if protocol == "" {
+		protocol = DefaultWsProtocol
+	}
+	origin := c.Origin
+	if origin == "" {
+		origin = DefaultWsOrigin
+	}
+	receiveTimeout := c.ReceiveTimeout
+	if receiveTimeout == 0 {
+		receiveTimeout = DefaultWsReceiveTimeout
+	}
+	buffSize := c.BufferSize
+	if buffSize == 0 {
+		buffSize = DefaultWsBuffSize
+	}
+	readLimit := c.ReadLimit
+	if readLimit == 0 {
+		readLimit = netWs.DefaultMaxPayloadBytes
+	}
+	closeTimeout := c.CloseTimeout
+	if closeTimeout == 0 {
+		closeTimeout = DefaultWsCloseTimeout
+	}
+
+	return &coderClient{
+		ctx:              ctx,
+		cancel:           cancel,
+		protocol:         protocol,
+		origin:           origin,
+		receiveTimeout:   receiveTimeout,
+		bufferSize:       buffSize,
+		handshakeTimeout: c.HandshakeTimeout,
+		httpClient:       c.HTTPClient,
+		readLimit:        readLimit,
+		compression:      c.Compression,
+		closeStatus:      newCloseStatus(c.CloseCode, c.CloseReason),
+		closeTimeout:     closeTimeout,
+		metrics:          metrics.FromContext(ctx),
+	}, nil
+}
+
+var _ Client = (*coderClient)(nil)
+
+type coderClient struct {
+	ctx              context.Context
+	cancel           context.CancelFunc
+	responsesWg      sync.WaitGroup
+	protocol         string
+	origin           string
+	receiveTimeout   time.Duration
+	bufferSize       uint
+	handshakeTimeout time.Duration
+	httpClient       *netHttp.Client
+	readLimit        int64
+	compression      coderWs.CompressionMode
+	closeStatus      *CloseError
+	closeTimeout     time.Duration
+	metrics          metrics.Metrics
+}
+
+func (c *coderClient) Request(req *Request) (res RawResponse, err error) {
+	protocol := req.Protocol
+	if protocol == "" {
+		protocol = c.protocol
+	}
+	origin := req.Origin
+	if origin == "" {
+		origin = c.origin
+	}
+	receiveTimeout := req.ReceiveTimeout
+	if receiveTimeout == 0 {
+		receiveTimeout = c.receiveTimeout
+	}
+	buffSize := req.BufferSize
+	if buffSize == 0 {
+		buffSize = c.bufferSize
+	}
+
+	opts := &coderWs.DialOptions{
+		HTTPClient:      c.httpClient,
+		HTTPHeader:      netHttp.Header{},
+		CompressionMode: c.compression,
+	}
+	for name, values := range req.Headers {
+		opts.HTTPHeader[name] = append([]string(nil), values...)
+	}
+	if origin != "" {
+		opts.HTTPHeader.Set("Origin", origin)
+	}
+	if protocol != "" {
+		opts.Subprotocols = []string{protocol}
+	}
+
+	conn, err := c.dial(req.Context(), req.URL, opts)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(c.readLimit)
+
+	wsResCtx, wsResCancel := context.WithCancel(req.Context())
+	// reads outlive the response for the close handshake
+	readCtx, readCancel := context.WithCancel(context.Background())
+	wsRes := &coderResponse{
+		clientCtx:      c.ctx,
+		ctx:            wsResCtx,
+		cancel:         wsResCancel,
+		responseWg:     &c.responsesWg,
+		conn:           conn,
+		readCtx:        readCtx,
+		readCancel:     readCancel,
+		receiveTimeout: receiveTimeout,
+		closeStatus:    c.closeStatus,
+		closeTimeout:   c.closeTimeout,
+		messages:       make(chan Message, buffSize),
+		metrics:        c.metrics,
+	}
+	c.metrics.AddGauge(metrics.WebsocketConnections, 1, nil)
+
+	defer c.responsesWg.Add(1)
+	defer wsRes.wg.Add(1)
+	go wsRes.run()
+
+	return wsRes, err
+}
+
+// dial is cancelled by both the request and the client. Errors are returned as *websocket.DialError of
+// golang.org/x/net/websocket as with NewNet, its Err is the context error if the dial was cancelled or timed out.
+func (c *coderClient) dial(ctx context.Context, location url.URL, opts *coderWs.DialOptions) (*coderWs.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	if c.handshakeTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.handshakeTimeout)
+		defer cancel()
+	}
+
+	conn, res, err := coderWs.Dial(ctx, location.String(), opts)
+	if res != nil && res.Body != nil {
+		_ = res.Body.Close()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, &netWs.DialError{Config: &netWs.Config{Location: &location}, Err: err}
+	}
+
+	return conn, nil
+}
+
+func (c *coderClient) Close(_ context.Context) {
+	defer c.responsesWg.Wait()
+	c.cancel()
+}
+
+var _ RawResponse = (*coderResponse)(nil)
+var _ Pinger = (*coderResponse)(nil)
+var _ CloseStatuser = (*coderResponse)(nil)
+
+type coderResponse struct {
+	clientCtx      context.Context
+	ctx            context.Context
+	cancel         context.CancelFunc
+	responseWg     *sync.WaitGroup
+	conn           *coderWs.Conn
+	readCtx        context.Context
+	readCancel     context.CancelFunc
+	receiveTimeout time.Duration
+	closeStatus    *CloseError
+	closeTimeout   time.Duration
+	peerStatus     atomic.Pointer[CloseError]
+	messages       chan Message
+	err            error
+	closeOnce      sync.Once
+	wg             sync.WaitGroup
+	metrics        metrics.Metrics
+}
+
+func (r *coderResponse) Send(message Message) error {
+	typ := coderWs.MessageBinary
+	if TypeOf(message) == MessageText {
+		typ = coderWs.MessageText
+	}
+
+	buf := message.Buff()
+	err := r.conn.Write(r.ctx, typ, buf)
+	if err == nil {
+		r.recordMessage(metrics.DirectionOut, len(buf))
+	}
+
+	return err
+}
+
+// Ping closes the connection without the close handshake if the peer doesn't answer, it wouldn't answer the handshake.
+func (r *coderResponse) Ping(ctx context.Context) error {
+	err := r.conn.Ping(ctx)
+	if err != nil && ctx.Err() != nil {
+		_ = r.conn.CloseNow()
+	}
+
+	return err
+}
+
+func (r *coderResponse) Listen() <-chan Message {
+	return r.messages
+}
+
+func (r *coderResponse) Closed() <-chan struct{} {
+	return r.ctx.Done()
+}
+
+func (r *coderResponse) Err() error {
+	return r.err
+}
+
+func (r *coderResponse) CloseStatus() *CloseError {
+	return r.peerStatus.Load()
+}
+
+func (r *coderResponse) Close(_ context.Context) {
+	defer r.responseWg.Done()
+	defer r.wg.Wait()
+	r.cancel()
+}
+
+func (r *coderResponse) run() {
+	defer r.wg.Done()
+	defer close(r.messages)
+	defer r.metrics.AddGauge(metrics.WebsocketConnections, -1, nil)
+	defer r.close()
+	defer r.cancel()
+	defer r.readCancel()
+
+	// the close handshake starts once the response or the client is closed
+	stopClose := context.AfterFunc(r.ctx, r.close)
+	defer stopClose()
+	stopClient := context.AfterFunc(r.clientCtx, r.cancel)
+	defer stopClient()
+
+	for {
+		msg, err, eof := r.receiveMessage()
+		if eof {
+			if r.ctx.Err() == nil {
+				r.err = err
+			}
+			return
+		}
+
+		// messages received during the close handshake are dropped
+		if r.ctx.Err() != nil {
+			continue
+		}
+
+		r.recordMessage(metrics.DirectionIn, len(msg.Buff()))
+
+		select {
+		case r.messages <- msg:
+		case <-r.ctx.Done():
+		}
+	}
+}
+
+// close performs the close handshake, the pending read answers it. The read is interrupted and the connection is
+// closed, if the peer doesn't send its close frame within the close timeout.
+func (r *coderResponse) close() {
+	r.closeOnce.Do(func() {
+		interrupt := time.AfterFunc(r.closeTimeout, r.readCancel)
+		defer interrupt.Stop()
+
+		_ = r.conn.Close(coderWs.StatusCode(r.closeStatus.Code), r.closeStatus.Reason)
+	})
+}
+
+// receiveMessage reports the end of the connection with eof, its error is the close frame of the peer unless the peer
+// closed the connection normally.
+func (r *coderResponse) receiveMessage() (msg Message, err error, eof bool) {
+	ctx := r.readCtx
+	if r.receiveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.receiveTimeout)
+		defer cancel()
+	}
+
+	typ, buf, err := r.conn.Read(ctx)
+
+	var closeErr coderWs.CloseError
+	switch {
+	case errors.As(err, &closeErr):
+		status := &CloseError{Code: CloseCode(closeErr.Code), Reason: closeErr.Reason}
+		r.peerStatus.Store(status)
+		return nil, peerError(status), true
+	case errors.Is(err, io.EOF):
+		return nil, nil, true
+	case err != nil:
+		return nil, err, true
+	case typ == coderWs.MessageText:
+		return TextMessage(buf), nil, false
+	default:
+		return ByteMessage(buf), nil, false
+	}
+}
+
+func (r *coderResponse) recordMessage(direction string, size int) {
+	labels := metrics.Labels{metrics.LabelDirection: direction}
+	r.metrics.AddCounter(metrics.WebsocketMessagesTotal, 1, labels)
+	r.metrics.AddCounter(metrics.WebsocketBytesTotal, float64(size), labels)
+}
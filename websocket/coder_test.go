@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/websocket"
+	"net"
+	"netshaper"
+	"netshaper/test"
+	"testing"
+	"time"
+)
+
+func TestCoderDial(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	endpoint, srv := test.NewWsTLSServer(&websocket.Server{Handler: func(conn *websocket.Conn) {
+		_ = websocket.Message.Send(conn, conn.Request().Header.Get("Authorization"))
+	}})
+	defer srv.Close()
+
+	cl, err := netshaper.New(NewCoder(WithCoderHTTPClient(srv.Client()))).Create(ctx)
+	if err != nil {
+		t.Errorf("Create() error = %v", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	res, err := cl.Request(&Request{
+		Ctx:     ctx,
+		URL:     endpoint,
+		Headers: netshaper.Headers{"Authorization": {"Bearer token"}},
+	})
+	if err != nil {
+		t.Errorf("Request() error got = %v, want nil", err)
+		return
+	}
+	defer res.Close(ctx)
+
+	msg := <-res.Listen()
+	if msg == nil || string(msg.Buff()) != "Bearer token" {
+		t.Errorf("Request().Listen() message got = %v, want %v", msg, "Bearer token")
+	}
+}
+
+func TestCoderDialErrors(t *testing.T) {
+	// the listener accepts connections, but never completes the handshake
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	cl, err := netshaper.New(NewCoder(WithCoderHandshakeTimeout(50 * time.Millisecond))).Create(context.Background())
+	if err != nil {
+		t.Errorf("Create() error = %v", err)
+		return
+	}
+	defer cl.Close(context.Background())
+
+	_, err = cl.Request(&Request{URL: netshaper.URL{Scheme: "ws", Host: listener.Addr().String()}})
+
+	var dialErr *websocket.DialError
+	if !errors.As(err, &dialErr) {
+		t.Errorf("Request() error got = %v, want %T", err, dialErr)
+		return
+	}
+	if !errors.Is(dialErr.Err, context.DeadlineExceeded) {
+		t.Errorf("Request() error got = %v, want %v", dialErr.Err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,190 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"net"
+	netHttp "net/http"
+	"net/url"
+	"time"
+)
+
+// Dialer opens network connections, *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+// Proxy returns the proxy URL for a request, e.g. http.ProxyFromEnvironment; nil URL means no proxy.
+type Proxy func(req *netHttp.Request) (*url.URL, error)
+
+type dialer struct {
+	dialer           Dialer
+	tlsConfig        *tls.Config
+	proxy            Proxy
+	handshakeTimeout time.Duration
+}
+
+// dial connects through the proxy if any, then performs TLS and websocket handshakes within the handshake timeout.
+// The raw connection is returned to close it without another close frame, websocket.Conn Close writes one.
+// Errors are returned as *websocket.DialError, its Err is the context error if the dial was cancelled or timed out.
+func (d *dialer) dial(ctx context.Context, config *websocket.Config) (conn *websocket.Conn, raw net.Conn, err error) {
+	if d.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.handshakeTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			err = &websocket.DialError{Config: config, Err: err}
+		}
+	}()
+
+	raw, err = d.dialNet(ctx, config.Location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// closing the connection interrupts the handshake once the context is done
+	stop := context.AfterFunc(ctx, func() { _ = raw.Close() })
+
+	conn, secured, err := d.handshake(ctx, raw, config)
+	if !stop() {
+		if err == nil {
+			_ = conn.Close()
+		}
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		_ = raw.Close()
+		return nil, nil, err
+	}
+
+	return conn, secured, nil
+}
+
+func (d *dialer) dialNet(ctx context.Context, location *url.URL) (net.Conn, error) {
+	address := authority(location)
+
+	proxyURL, err := d.proxyURL(location)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return d.dialer.DialContext(ctx, "tcp", address)
+	}
+
+	conn, err := d.dialer.DialContext(ctx, "tcp", authority(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection interrupts the CONNECT request once the context is done
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if err = connect(conn, proxyURL, address); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *dialer) proxyURL(location *url.URL) (*url.URL, error) {
+	if d.proxy == nil {
+		return nil, nil
+	}
+
+	// proxy functions expect http(s) URLs, e.g. http.ProxyFromEnvironment chooses HTTPS_PROXY for https
+	target := *location
+	target.Scheme = "http"
+	if location.Scheme == "wss" {
+		target.Scheme = "https"
+	}
+
+	return d.proxy(&netHttp.Request{URL: &target, Header: netHttp.Header{}})
+}
+
+func (d *dialer) handshake(ctx context.Context, conn net.Conn, config *websocket.Config) (*websocket.Conn, net.Conn, error) {
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if d.tlsConfig != nil {
+			tlsConfig = d.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = config.Location.Hostname()
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+
+	return ws, conn, err
+}
+
+// connect opens a tunnel to the address with the CONNECT method.
+func connect(conn net.Conn, proxyURL *url.URL, address string) error {
+	req := &netHttp.Request{
+		Method: netHttp.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: netHttp.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	res, err := netHttp.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != netHttp.StatusOK {
+		return fmt.Errorf("proxy CONNECT failed: %v", res.Status)
+	}
+
+	return nil
+}
+
+// authority returns host:port of the URL with the default port of its scheme.
+func authority(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	switch u.Scheme {
+	case "wss", "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
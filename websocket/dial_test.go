@@ -0,0 +1,233 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/websocket"
+	"io"
+	"net"
+	netHttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/test"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newConnectProxy tunnels CONNECT requests with the proxy credentials user:pass.
+func newConnectProxy(tunnels *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(netHttp.HandlerFunc(func(writer netHttp.ResponseWriter, req *netHttp.Request) {
+		if user, pass, ok := parseProxyAuthorization(req); req.Method != netHttp.MethodConnect || !ok || user != "user" || pass != "pass" {
+			writer.WriteHeader(netHttp.StatusProxyAuthRequired)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			writer.WriteHeader(netHttp.StatusBadGateway)
+			return
+		}
+
+		conn, _, err := writer.(netHttp.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		tunnels.Add(1)
+
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+}
+
+func parseProxyAuthorization(req *netHttp.Request) (string, string, bool) {
+	req.Header.Set("Authorization", req.Header.Get("Proxy-Authorization"))
+	return req.BasicAuth()
+}
+
+func TestNetDial(t *testing.T) {
+	var tunnels atomic.Int32
+	proxy := newConnectProxy(&tunnels)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	tests := []struct {
+		name        string
+		tls         bool
+		opts        func(srv *httptest.Server) []conf.Option[NetConfig]
+		wantTunnels int32
+	}{
+		{
+			name: "plain",
+			opts: func(*httptest.Server) []conf.Option[NetConfig] { return nil },
+		},
+		{
+			name: "tls",
+			tls:  true,
+			opts: func(srv *httptest.Server) []conf.Option[NetConfig] {
+				return []conf.Option[NetConfig]{WithNetTLSConfig(srv.Client().Transport.(*netHttp.Transport).TLSClientConfig)}
+			},
+		},
+		{
+			name: "proxy",
+			opts: func(*httptest.Server) []conf.Option[NetConfig] {
+				return []conf.Option[NetConfig]{WithNetProxy(netHttp.ProxyURL(proxyURL))}
+			},
+			wantTunnels: 1,
+		},
+		{
+			name: "tls through proxy",
+			tls:  true,
+			opts: func(srv *httptest.Server) []conf.Option[NetConfig] {
+				return []conf.Option[NetConfig]{
+					WithNetTLSConfig(srv.Client().Transport.(*netHttp.Transport).TLSClientConfig),
+					WithNetProxy(netHttp.ProxyURL(proxyURL)),
+					WithNetDialer(&net.Dialer{Timeout: time.Second}),
+				}
+			},
+			wantTunnels: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			tunnels.Store(0)
+
+			server := &websocket.Server{Handler: func(conn *websocket.Conn) {
+				_ = websocket.Message.Send(conn, conn.Request().Header.Get("Authorization"))
+			}}
+
+			var endpoint netshaper.URL
+			var srv *httptest.Server
+			if tt.tls {
+				endpoint, srv = test.NewWsTLSServer(server)
+			} else {
+				endpoint, srv = test.NewWsServer(server)
+			}
+			defer srv.Close()
+
+			cl, err := netshaper.New(NewNet(tt.opts(srv)...)).Create(ctx)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := cl.Request(&Request{
+				Ctx:     ctx,
+				URL:     endpoint,
+				Headers: netshaper.Headers{"Authorization": {"Bearer token"}},
+			})
+			if err != nil {
+				t.Errorf("Request() error got = %v, want nil", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			msg := <-res.Listen()
+			if msg == nil || string(msg.Buff()) != "Bearer token" {
+				t.Errorf("Request().Listen() message got = %v, want %v", msg, "Bearer token")
+			}
+			if got := tunnels.Load(); got != tt.wantTunnels {
+				t.Errorf("proxy tunnels got = %v, want %v", got, tt.wantTunnels)
+			}
+		})
+	}
+}
+
+func TestNetDialErrors(t *testing.T) {
+	// the listener accepts connections, but never completes the handshake
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+	stalled := netshaper.URL{Scheme: "ws", Host: listener.Addr().String()}
+
+	tlsURL, tlsSrv := test.NewWsTLSServer(&websocket.Server{Handler: func(*websocket.Conn) {}})
+	defer tlsSrv.Close()
+
+	var tunnels atomic.Int32
+	proxy := newConnectProxy(&tunnels)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		url     netshaper.URL
+		opts    []conf.Option[NetConfig]
+		wantErr error
+	}{
+		{
+			name:    "handshake timeout",
+			ctx:     context.Background(),
+			url:     stalled,
+			opts:    []conf.Option[NetConfig]{WithNetHandshakeTimeout(50 * time.Millisecond)},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "cancelled request",
+			ctx:     cancelled,
+			url:     stalled,
+			wantErr: context.Canceled,
+		},
+		{
+			name: "untrusted certificate",
+			ctx:  context.Background(),
+			url:  tlsURL,
+		},
+		{
+			name: "proxy without credentials",
+			ctx:  context.Background(),
+			url:  stalled,
+			opts: []conf.Option[NetConfig]{WithNetProxy(netHttp.ProxyURL(proxyURL))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(tt.ctx, time.Second)
+			defer cancel()
+
+			cl, err := netshaper.New(NewNet(tt.opts...)).Create(context.Background())
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			_, err = cl.Request(&Request{Ctx: ctx, URL: tt.url})
+
+			var dialErr *websocket.DialError
+			if !errors.As(err, &dialErr) {
+				t.Errorf("Request() error got = %v, want %T", err, dialErr)
+				return
+			}
+			if tt.wantErr != nil && !errors.Is(dialErr.Err, tt.wantErr) {
+				t.Errorf("Request() error got = %v, want %v", dialErr.Err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"netshaper"
+	"netshaper/conf"
+	"netshaper/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHeartbeatInterval = 30 * time.Second
+	DefaultHeartbeatTimeout  = 10 * time.Second
+)
+
+var ErrHeartbeatTimeout = errors.New("websocket heartbeat timeout")
+
+// Pinger is implemented by responses, which send protocol pings. Ping returns once the peer answered.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// WithHeartbeat pings the peers of responses at the interval and closes the responses with ErrHeartbeatTimeout once
+// a peer doesn't answer within the timeout, WithRobust reconnects them. Protocol pings are sent to Pinger responses,
+// unless WithHeartbeatMessages configures application pings.
+func WithHeartbeat(opts ...conf.Option[HeartbeatConfig]) conf.Option[Config] {
+	return conf.OptionFunc[Config](func(config Config) Config {
+		cfg := conf.ApplyOptionsInit(opts, HeartbeatConfig{Inner: config})
+		return &cfg
+	})
+}
+
+func WithHeartbeatInterval(interval time.Duration) conf.Option[HeartbeatConfig] {
+	return conf.OptionFunc[HeartbeatConfig](func(config HeartbeatConfig) HeartbeatConfig {
+		config.Interval = interval
+		return config
+	})
+}
+
+func WithHeartbeatTimeout(timeout time.Duration) conf.Option[HeartbeatConfig] {
+	return conf.OptionFunc[HeartbeatConfig](func(config HeartbeatConfig) HeartbeatConfig {
+		config.Timeout = timeout
+		return config
+	})
+}
+
+// WithHeartbeatMessages sends application pings built by ping, e.g. for servers with JSON heartbeats. Received messages
+// matching pong answer pings and aren't listened, any received message answers pings if pong is nil.
+func WithHeartbeatMessages(ping func() Message, pong func(message Message) bool) conf.Option[HeartbeatConfig] {
+	return conf.OptionFunc[HeartbeatConfig](func(config HeartbeatConfig) HeartbeatConfig {
+		config.Ping = ping
+		config.Pong = pong
+		return config
+	})
+}
+
+var _ Config = (*HeartbeatConfig)(nil)
+
+type HeartbeatConfig struct {
+	Inner    Config
+	Interval time.Duration
+	Timeout  time.Duration
+	Ping     func() Message
+	Pong     func(message Message) bool
+}
+
+func (c *HeartbeatConfig) Create(ctx context.Context) (Client, error) {
+	inner, err := c.Inner.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := c.Interval
+	if interval == 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultHeartbeatTimeout
+	}
+
+	return &heartbeat{
+		inner:    inner,
+		interval: interval,
+		timeout:  timeout,
+		ping:     c.Ping,
+		pong:     c.Pong,
+		metrics:  metrics.FromContext(ctx),
+		logger:   netshaper.LoggerFromContext(ctx),
+	}, nil
+}
+
+var _ Client = (*heartbeat)(nil)
+
+type heartbeat struct {
+	inner    Client
+	interval time.Duration
+	timeout  time.Duration
+	ping     func() Message
+	pong     func(message Message) bool
+	metrics  metrics.Metrics
+	logger   *slog.Logger
+}
+
+func (c *heartbeat) Request(req *Request) (RawResponse, error) {
+	inner, err := c.inner.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	buffSize := req.BufferSize
+	if buffSize == 0 {
+		buffSize = DefaultWsBuffSize
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	res := &heartbeatResponse{
+		client:   c,
+		url:      req.URL.Redacted(),
+		inner:    inner,
+		ctx:      ctx,
+		cancel:   cancel,
+		messages: make(chan Message, buffSize),
+		pongs:    make(chan struct{}, 1),
+	}
+
+	defer res.wg.Add(2)
+	go res.forwardMessages()
+	go res.beat()
+
+	return res, nil
+}
+
+func (c *heartbeat) Close(ctx context.Context) {
+	c.inner.Close(ctx)
+}
+
+var _ RawResponse = (*heartbeatResponse)(nil)
+var _ CloseStatuser = (*heartbeatResponse)(nil)
+
+type heartbeatResponse struct {
+	client    *heartbeat
+	url       string
+	inner     RawResponse
+	ctx       context.Context
+	cancel    context.CancelFunc
+	messages  chan Message
+	pongs     chan struct{}
+	pinging   sync.Mutex
+	mu        sync.Mutex
+	err       error
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (r *heartbeatResponse) Send(message Message) error {
+	return r.inner.Send(message)
+}
+
+func (r *heartbeatResponse) Listen() <-chan Message {
+	return r.messages
+}
+
+func (r *heartbeatResponse) Closed() <-chan struct{} {
+	return r.ctx.Done()
+}
+
+func (r *heartbeatResponse) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.inner.Err()
+}
+
+func (r *heartbeatResponse) CloseStatus() *CloseError {
+	if inner, ok := r.inner.(CloseStatuser); ok {
+		return inner.CloseStatus()
+	}
+
+	return nil
+}
+
+func (r *heartbeatResponse) Close(ctx context.Context) {
+	defer r.wg.Wait()
+	r.cancel()
+	r.closeInner(ctx)
+}
+
+func (r *heartbeatResponse) closeInner(ctx context.Context) {
+	r.closeOnce.Do(func() {
+		r.inner.Close(ctx)
+	})
+}
+
+func (r *heartbeatResponse) forwardMessages() {
+	defer r.wg.Done()
+	defer close(r.messages)
+	defer r.cancel()
+	// a ping timing out closes the inner response, its timeout is recorded before the response is closed
+	defer r.pinging.Unlock()
+	defer r.pinging.Lock()
+
+	for msg := range r.inner.Listen() {
+		if r.client.ping != nil && msg.Err() == nil && (r.client.pong == nil || r.client.pong(msg)) {
+			select {
+			case r.pongs <- struct{}{}:
+			default:
+			}
+
+			if r.client.pong != nil {
+				continue
+			}
+		}
+
+		select {
+		case r.messages <- msg:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *heartbeatResponse) beat() {
+	defer r.wg.Done()
+
+	pinger, ok := r.inner.(Pinger)
+	if !ok && r.client.ping == nil {
+		return
+	}
+
+	ticker := time.NewTicker(r.client.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		r.pinging.Lock()
+		err := r.pingPeer(pinger)
+		if errors.Is(err, ErrHeartbeatTimeout) {
+			r.fail(err)
+		}
+		r.pinging.Unlock()
+
+		switch {
+		case r.ctx.Err() != nil:
+			return
+		case err != nil:
+			// the inner response is closed on connection errors
+			return
+		}
+
+		r.client.metrics.ObserveHistogram(metrics.WebsocketPingLatencySeconds, time.Since(start).Seconds(), nil)
+	}
+}
+
+func (r *heartbeatResponse) pingPeer(pinger Pinger) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.client.timeout)
+	defer cancel()
+
+	if r.client.ping == nil {
+		err := pinger.Ping(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrHeartbeatTimeout
+		}
+
+		return err
+	}
+
+	// a pong received before the ping doesn't answer it
+	select {
+	case <-r.pongs:
+	default:
+	}
+
+	if err := r.inner.Send(r.client.ping()); err != nil {
+		return err
+	}
+
+	select {
+	case <-r.pongs:
+		return nil
+	case <-ctx.Done():
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+
+		return ErrHeartbeatTimeout
+	}
+}
+
+func (r *heartbeatResponse) fail(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+
+	r.client.metrics.AddCounter(metrics.WebsocketHeartbeatTimeoutsTotal, 1, nil)
+	r.client.logger.LogAttrs(r.ctx, slog.LevelWarn, "websocket heartbeat timeout", slog.String("url", r.url))
+
+	r.cancel()
+	r.closeInner(context.Background())
+}
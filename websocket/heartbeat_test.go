@@ -0,0 +1,276 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/websocket"
+	"netshaper"
+	"netshaper/metrics"
+	"netshaper/test"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	// the peer answers pings while it receives messages
+	healthy := func(conn *websocket.Conn, _ <-chan struct{}) {
+		var msg string
+		for websocket.Message.Receive(conn, &msg) == nil {
+		}
+	}
+	// the peer doesn't receive messages, so it doesn't answer pings
+	dead := func(_ *websocket.Conn, done <-chan struct{}) {
+		<-done
+	}
+
+	tests := []struct {
+		name         string
+		handler      func(conn *websocket.Conn, done <-chan struct{})
+		wantErr      error
+		wantTimeouts float64
+	}{
+		{
+			name:    "healthy peer",
+			handler: healthy,
+		},
+		{
+			name:         "dead peer",
+			handler:      dead,
+			wantErr:      ErrHeartbeatTimeout,
+			wantTimeouts: 1,
+		},
+	}
+
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				m := metrics.NewMemory()
+				ctx, cancel := context.WithTimeout(metrics.ContextWith(context.Background(), m), time.Second)
+				defer cancel()
+
+				done := make(chan struct{})
+				url, srv := test.NewWsHandler(func(conn *websocket.Conn) { tt.handler(conn, done) })
+				defer srv.Close()
+				defer close(done)
+
+				cl, err := netshaper.New(
+					backend.create(0),
+					WithHeartbeat(WithHeartbeatInterval(20*time.Millisecond), WithHeartbeatTimeout(50*time.Millisecond)),
+				).Create(ctx)
+				if err != nil {
+					t.Errorf("Create() error = %v", err)
+					return
+				}
+				defer cl.Close(ctx)
+
+				res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+				if err != nil {
+					t.Errorf("Request() error = %v", err)
+					return
+				}
+				defer res.Close(ctx)
+
+				select {
+				case <-res.Closed():
+				case <-time.After(200 * time.Millisecond):
+				}
+
+				if err = res.Err(); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Err() got = %v, want %v", err, tt.wantErr)
+				}
+				if got := m.Counter(metrics.WebsocketHeartbeatTimeoutsTotal, nil); got != tt.wantTimeouts {
+					t.Errorf("heartbeat timeouts got = %v, want %v", got, tt.wantTimeouts)
+				}
+				if tt.wantErr == nil && len(m.Histogram(metrics.WebsocketPingLatencySeconds, nil)) == 0 {
+					t.Errorf("ping latencies got none, want some")
+				}
+			})
+		}
+	}
+}
+
+func TestHeartbeatMessages(t *testing.T) {
+	tests := []struct {
+		name         string
+		answer       bool
+		wantMessages []Message
+		wantErr      error
+	}{
+		{
+			name:         "answered",
+			answer:       true,
+			wantMessages: []Message{TextMessage("hey")},
+		},
+		{
+			name:         "unanswered",
+			wantMessages: []Message{TextMessage("hey")},
+			wantErr:      ErrHeartbeatTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			// the peer echoes messages and answers ping messages with pong messages
+			url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+				var msg string
+				for websocket.Message.Receive(conn, &msg) == nil {
+					if msg != `{"op":"ping"}` {
+						_ = websocket.Message.Send(conn, msg)
+					} else if tt.answer {
+						_ = websocket.Message.Send(conn, `{"op":"pong"}`)
+					}
+				}
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.New(NewNet(), WithHeartbeat(
+				WithHeartbeatInterval(20*time.Millisecond),
+				WithHeartbeatTimeout(50*time.Millisecond),
+				WithHeartbeatMessages(
+					func() Message { return TextMessage(`{"op":"ping"}`) },
+					func(message Message) bool { return string(message.Buff()) == `{"op":"pong"}` },
+				),
+			)).Create(ctx)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+			if err != nil {
+				t.Errorf("Request() error = %v", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			if err = res.Send(TextMessage("hey")); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+
+			gotMessages := []Message{}
+			timeout := time.After(200 * time.Millisecond)
+			for listening := true; listening; {
+				select {
+				case msg, ok := <-res.Listen():
+					if ok {
+						gotMessages = append(gotMessages, msg)
+					}
+					listening = ok
+				case <-timeout:
+					listening = false
+				}
+			}
+
+			if !reflect.DeepEqual(gotMessages, tt.wantMessages) {
+				t.Errorf("Listen() messages got = %v, want %v", gotMessages, tt.wantMessages)
+			}
+			if err = res.Err(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Err() got = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeartbeatRobust(t *testing.T) {
+	m := metrics.NewMemory()
+	ctx, cancel := context.WithTimeout(metrics.ContextWith(context.Background(), m), time.Second)
+	defer cancel()
+
+	// the first connection goes stale, the next ones greet and answer pings
+	var connections atomic.Int32
+	done := make(chan struct{})
+	url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			<-done
+			return
+		}
+
+		_ = websocket.Message.Send(conn, "hello")
+		var msg string
+		for websocket.Message.Receive(conn, &msg) == nil {
+		}
+	})
+	defer srv.Close()
+	defer close(done)
+
+	cl, err := netshaper.New(
+		NewNet(),
+		WithHeartbeat(WithHeartbeatInterval(20*time.Millisecond), WithHeartbeatTimeout(50*time.Millisecond)),
+		WithRobust(),
+	).Create(ctx)
+	if err != nil {
+		t.Errorf("Create() error = %v", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	res, err := cl.Request(&Request{Ctx: ctx, URL: url})
+	if err != nil {
+		t.Errorf("Request() error = %v", err)
+		return
+	}
+	defer res.Close(ctx)
+
+	if msg := <-res.Listen(); msg == nil || string(msg.Buff()) != "hello" {
+		t.Errorf("Listen() message got = %v, want %v", msg, "hello")
+	}
+	if got := m.Counter(metrics.WebsocketReconnectsTotal, nil); got != 1 {
+		t.Errorf("reconnects got = %v, want %v", got, 1)
+	}
+}
+
+func TestHeartbeatBufferSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		bufferSize uint
+		want       int
+	}{
+		{
+			name: "default",
+			want: int(DefaultWsBuffSize),
+		},
+		{
+			name:       "request",
+			bufferSize: 4,
+			want:       4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			url, srv := test.NewWsHandler(func(conn *websocket.Conn) {
+				var msg string
+				for websocket.Message.Receive(conn, &msg) == nil {
+				}
+			})
+			defer srv.Close()
+
+			cl, err := netshaper.New(NewNet(), WithHeartbeat()).Create(ctx)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := cl.Request(&Request{Ctx: ctx, URL: url, BufferSize: tt.bufferSize})
+			if err != nil {
+				t.Errorf("Request() error = %v", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			if got := cap(res.Listen()); got != tt.want {
+				t.Errorf("Listen() buffer size got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
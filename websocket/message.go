@@ -13,7 +13,30 @@ type Message interface {
 	Err() error
 }
 
-var _ Message = (*ByteMessage)(nil)
+// MessageType is the frame type a message is sent and received with.
+type MessageType int
+
+const (
+	MessageBinary MessageType = iota
+	MessageText
+)
+
+// TypedMessage is a Message with its frame type, Send writes other messages as binary frames.
+type TypedMessage interface {
+	Message
+	MessageType() MessageType
+}
+
+// TypeOf returns the frame type of the message, MessageBinary if it isn't a TypedMessage.
+func TypeOf(message Message) MessageType {
+	if typed, ok := message.(TypedMessage); ok {
+		return typed.MessageType()
+	}
+
+	return MessageBinary
+}
+
+var _ TypedMessage = (*ByteMessage)(nil)
 
 type ByteMessage []byte
 
@@ -25,7 +48,11 @@ func (m ByteMessage) Err() error {
 	return nil
 }
 
-var _ Message = (*TextMessage)(nil)
+func (m ByteMessage) MessageType() MessageType {
+	return MessageBinary
+}
+
+var _ TypedMessage = (*TextMessage)(nil)
 
 type TextMessage string
 
@@ -37,6 +64,10 @@ func (m TextMessage) Err() error {
 	return nil
 }
 
+func (m TextMessage) MessageType() MessageType {
+	return MessageText
+}
+
 var _ Message = (*ErrorMessage)(nil)
 
 type ErrorMessage struct {
@@ -2,12 +2,16 @@ package websocket
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"golang.org/x/net/websocket"
 	"io"
 	"net"
 	"netshaper/conf"
+	"netshaper/metrics"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +22,8 @@ const (
 	DefaultWsBuffSize       = uint(128)
 )
 
+var DefaultWsDialer Dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
 func NewNet(opts ...conf.Option[NetConfig]) conf.Option[Config] {
 	return conf.OptionFunc[Config](func(config Config) Config {
 		if config != nil {
@@ -57,13 +63,68 @@ func WithNetBufferSize(size uint) conf.Option[NetConfig] {
 	})
 }
 
+// WithNetHandshakeTimeout limits the time to connect, including proxy, TLS and websocket handshakes.
+func WithNetHandshakeTimeout(timeout time.Duration) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.HandshakeTimeout = timeout
+		return config
+	})
+}
+
+func WithNetTLSConfig(tlsConfig *tls.Config) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.TLSConfig = tlsConfig
+		return config
+	})
+}
+
+// WithNetProxy connects through an HTTP(S) proxy with the CONNECT method, e.g. WithNetProxy(http.ProxyFromEnvironment).
+func WithNetProxy(proxy Proxy) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.Proxy = proxy
+		return config
+	})
+}
+
+// WithNetCloseStatus sets the code and the reason of the close frame sent on Close. Codes which must not be sent
+// (e.g. CloseNoStatusReceived) fall back to DefaultWsCloseCode, the reason is truncated to 123 bytes.
+func WithNetCloseStatus(code CloseCode, reason string) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.CloseCode = code
+		config.CloseReason = reason
+		return config
+	})
+}
+
+// WithNetCloseTimeout limits the wait for the close frame of the peer on Close.
+func WithNetCloseTimeout(timeout time.Duration) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.CloseTimeout = timeout
+		return config
+	})
+}
+
+func WithNetDialer(dialer Dialer) conf.Option[NetConfig] {
+	return conf.OptionFunc[NetConfig](func(config NetConfig) NetConfig {
+		config.Dialer = dialer
+		return config
+	})
+}
+
 var _ Config = (*NetConfig)(nil)
 
 type NetConfig struct {
-	Protocol       string
-	Origin         string
-	ReceiveTimeout time.Duration
-	BufferSize     uint
+	Protocol         string
+	Origin           string
+	ReceiveTimeout   time.Duration
+	BufferSize       uint
+	HandshakeTimeout time.Duration
+	TLSConfig        *tls.Config
+	Proxy            Proxy
+	Dialer           Dialer
+	CloseCode        CloseCode
+	CloseReason      string
+	CloseTimeout     time.Duration
 }
 
 func (c *NetConfig) Create(ctx context.Context) (Client, error) {
@@ -85,6 +146,14 @@ func (c *NetConfig) Create(ctx context.Context) (Client, error) {
 	if buffSize == 0 {
 		buffSize = DefaultWsBuffSize
 	}
+	netDialer := c.Dialer
+	if netDialer == nil {
+		netDialer = DefaultWsDialer
+	}
+	closeTimeout := c.CloseTimeout
+	if closeTimeout == 0 {
+		closeTimeout = DefaultWsCloseTimeout
+	}
 
 	return &netClient{
 		ctx:            ctx,
@@ -93,6 +162,15 @@ func (c *NetConfig) Create(ctx context.Context) (Client, error) {
 		origin:         origin,
 		receiveTimeout: receiveTimeout,
 		bufferSize:     buffSize,
+		dialer: &dialer{
+			dialer:           netDialer,
+			tlsConfig:        c.TLSConfig,
+			proxy:            c.Proxy,
+			handshakeTimeout: c.HandshakeTimeout,
+		},
+		closeStatus:  newCloseStatus(c.CloseCode, c.CloseReason),
+		closeTimeout: closeTimeout,
+		metrics:      metrics.FromContext(ctx),
 	}, nil
 }
 
@@ -106,6 +184,10 @@ type netClient struct {
 	origin         string
 	receiveTimeout time.Duration
 	bufferSize     uint
+	dialer         *dialer
+	closeStatus    *CloseError
+	closeTimeout   time.Duration
+	metrics        metrics.Metrics
 }
 
 func (c *netClient) Request(req *Request) (res RawResponse, err error) {
@@ -126,31 +208,44 @@ func (c *netClient) Request(req *Request) (res RawResponse, err error) {
 		buffSize = c.bufferSize
 	}
 
-	// TODO: call with context & timeouts
-	conn, err := websocket.Dial(req.URL.String(), protocol, origin)
+	config, err := websocket.NewConfig(req.URL.String(), origin)
 	if err != nil {
 		return nil, err
 	}
-	select {
-	case <-c.ctx.Done():
-		err = c.ctx.Err()
-		return
-	case <-req.Context().Done():
-		err = req.Context().Err()
-		return
-	default:
-		break
+	if protocol != "" {
+		config.Protocol = []string{protocol}
+	}
+	for name, values := range req.Headers {
+		config.Header[name] = append([]string(nil), values...)
+	}
+
+	// the dial is cancelled by both the request and the client
+	dialCtx, dialCancel := context.WithCancel(req.Context())
+	defer dialCancel()
+	stop := context.AfterFunc(c.ctx, dialCancel)
+	defer stop()
+
+	conn, raw, err := c.dialer.dial(dialCtx, config)
+	if err != nil {
+		return nil, err
 	}
 
 	wsResCtx, wsResCancel := context.WithCancel(req.Context())
 	wsRes := &netResponse{
-		clientCtx:  c.ctx,
-		ctx:        wsResCtx,
-		cancel:     wsResCancel,
-		responseWg: &c.responsesWg,
-		conn:       conn,
-		messages:   make(chan Message, buffSize),
+		clientCtx:      c.ctx,
+		ctx:            wsResCtx,
+		cancel:         wsResCancel,
+		responseWg:     &c.responsesWg,
+		conn:           conn,
+		raw:            raw,
+		receiveTimeout: receiveTimeout,
+		closeStatus:    c.closeStatus,
+		closeTimeout:   c.closeTimeout,
+		messages:       make(chan Message, buffSize),
+		received:       make(chan struct{}),
+		metrics:        c.metrics,
 	}
+	c.metrics.AddGauge(metrics.WebsocketConnections, 1, nil)
 
 	defer c.responsesWg.Add(1)
 	defer wsRes.wg.Add(1)
@@ -165,6 +260,8 @@ func (c *netClient) Close(_ context.Context) {
 }
 
 var _ RawResponse = (*netResponse)(nil)
+var _ Pinger = (*netResponse)(nil)
+var _ CloseStatuser = (*netResponse)(nil)
 
 type netResponse struct {
 	clientCtx      context.Context
@@ -172,17 +269,54 @@ type netResponse struct {
 	cancel         context.CancelFunc
 	responseWg     *sync.WaitGroup
 	conn           *websocket.Conn
+	raw            net.Conn
 	receiveTimeout time.Duration
+	closeStatus    *CloseError
+	closeTimeout   time.Duration
 	messages       chan Message
 	err            error
+	peerStatus     atomic.Pointer[CloseError]
+	received       chan struct{}
+	closeOnce      sync.Once
+	sendCloseOnce  sync.Once
+	pongsMu        sync.Mutex
+	pongs          []chan struct{}
 	wg             sync.WaitGroup
+	metrics        metrics.Metrics
 }
 
 func (r *netResponse) Send(message Message) error {
-	_, err := r.conn.Write(message.Buff())
+	err := netMessage.Send(r.conn, message)
+	if err == nil {
+		r.recordMessage(metrics.DirectionOut, len(message.Buff()))
+	}
+
 	return err
 }
 
+// Ping sends a ping frame and waits for a pong frame. The connection is closed without the close handshake if the peer
+// doesn't answer, it wouldn't answer the handshake.
+func (r *netResponse) Ping(ctx context.Context) error {
+	pong := make(chan struct{})
+	r.pongsMu.Lock()
+	r.pongs = append(r.pongs, pong)
+	r.pongsMu.Unlock()
+
+	if err := netControl.Send(r.conn, netFrame{payloadType: websocket.PingFrame}); err != nil {
+		return err
+	}
+
+	select {
+	case <-pong:
+		return nil
+	case <-r.received:
+		return net.ErrClosed
+	case <-ctx.Done():
+		_ = r.raw.Close()
+		return ctx.Err()
+	}
+}
+
 func (r *netResponse) Listen() <-chan Message {
 	return r.messages
 }
@@ -195,6 +329,10 @@ func (r *netResponse) Err() error {
 	return r.err
 }
 
+func (r *netResponse) CloseStatus() *CloseError {
+	return r.peerStatus.Load()
+}
+
 func (r *netResponse) Close(_ context.Context) {
 	defer r.responseWg.Done()
 	defer r.wg.Wait()
@@ -204,52 +342,211 @@ func (r *netResponse) Close(_ context.Context) {
 func (r *netResponse) run() {
 	defer r.wg.Done()
 	defer close(r.messages)
-	defer func() { _ = r.conn.Close() }()
+	defer r.metrics.AddGauge(metrics.WebsocketConnections, -1, nil)
+	defer r.close()
+	defer close(r.received)
 	defer r.cancel()
 
+	// the close handshake starts once the response or the client is closed
+	stopClose := context.AfterFunc(r.ctx, r.close)
+	defer stopClose()
+	stopClient := context.AfterFunc(r.clientCtx, r.cancel)
+	defer stopClient()
+
 	for {
-		select {
-		case <-r.clientCtx.Done():
-			return
-		case <-r.ctx.Done():
-			return
-		default:
-			msg, err, eof := r.receiveMessage()
-			if eof {
+		msg, err, eof := r.receiveMessage()
+		if eof {
+			if r.ctx.Err() == nil {
 				r.err = err
-				return
 			}
+			return
+		}
+
+		// messages received during the close handshake are dropped
+		if r.ctx.Err() != nil {
+			continue
+		}
+
+		if msg.Err() == nil {
+			r.recordMessage(metrics.DirectionIn, len(msg.Buff()))
+		}
 
-			r.messages <- msg
+		select {
+		case r.messages <- msg:
+		case <-r.ctx.Done():
 		}
 	}
 }
 
+// close performs the close handshake: it sends the close frame, waits for the close frame of the peer within the close
+// timeout and closes the connection.
+func (r *netResponse) close() {
+	r.closeOnce.Do(func() {
+		r.sendClose(r.closeStatus)
+
+		timer := time.NewTimer(r.closeTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-r.received:
+		case <-timer.C:
+		}
+
+		_ = r.raw.Close()
+	})
+}
+
+func (r *netResponse) sendClose(status *CloseError) {
+	r.sendCloseOnce.Do(func() {
+		_ = r.raw.SetWriteDeadline(time.Now().Add(r.closeTimeout))
+		_ = netControl.Send(r.conn, netFrame{payloadType: websocket.CloseFrame, payload: closeFramePayload(status)})
+	})
+}
+
+// receiveMessage reads frames until a message is received. It answers ping and close frames, since the frames are read
+// without the handler of golang.org/x/net/websocket, which hides pong and close frames.
 func (r *netResponse) receiveMessage() (msg Message, err error, eof bool) {
 	if r.receiveTimeout > 0 {
 		err = r.conn.SetReadDeadline(time.Now().Add(r.receiveTimeout))
 		if err != nil {
-			return
+			return nil, err, true
 		}
 	}
 
-	buf := []byte{}
-	err = websocket.Message.Receive(r.conn, &buf)
+	var payloadType byte
+	var buf []byte
+
+	for {
+		frame, err := r.conn.NewFrameReader()
+		if err != nil {
+			return nil, connectionError(err), true
+		}
+
+		header, _ := io.ReadAll(frame.HeaderReader())
+		fin := len(header) > 0 && header[0]&0x80 != 0
 
-	switch err {
-	case nil:
-		msg = ByteMessage(buf)
-	case io.EOF, io.ErrUnexpectedEOF:
-		err = nil
-		eof = true
-	default:
-		switch err.(type) {
-		case *net.OpError:
-			eof = true
+		switch frame.PayloadType() {
+		case websocket.TextFrame, websocket.BinaryFrame:
+			payloadType, buf = frame.PayloadType(), nil
+		case websocket.ContinuationFrame:
 		default:
-			msg = &ErrorMessage{err}
+			if err = r.handleControl(frame.PayloadType(), frame); err != nil {
+				return nil, connectionError(err), true
+			}
+			if status := r.peerStatus.Load(); status != nil {
+				return nil, peerError(status), true
+			}
+			continue
+		}
+
+		// continuation frames of dropped messages are dropped
+		if payloadType == 0 || len(buf)+frame.Len()-len(header) > r.maxPayloadBytes() {
+			if _, err = io.Copy(io.Discard, frame); err != nil {
+				return nil, connectionError(err), true
+			}
+			if payloadType == 0 {
+				continue
+			}
+
+			return &ErrorMessage{websocket.ErrFrameTooLarge}, nil, false
+		}
+
+		payload, err := io.ReadAll(frame)
+		if err != nil {
+			return nil, connectionError(err), true
+		}
+		buf = append(buf, payload...)
+
+		if fin {
+			if payloadType == websocket.TextFrame {
+				return TextMessage(buf), nil, false
+			}
+
+			return ByteMessage(buf), nil, false
+		}
+	}
+}
+
+// handleControl answers ping frames, acknowledges pings on pong frames and answers close frames.
+func (r *netResponse) handleControl(payloadType byte, frame io.Reader) error {
+	payload, err := io.ReadAll(frame)
+	if err != nil {
+		return err
+	}
+
+	switch payloadType {
+	case websocket.PingFrame:
+		return netControl.Send(r.conn, netFrame{payloadType: websocket.PongFrame, payload: payload})
+	case websocket.PongFrame:
+		r.pongsMu.Lock()
+		defer r.pongsMu.Unlock()
+
+		for _, pong := range r.pongs {
+			close(pong)
 		}
+		r.pongs = nil
+	case websocket.CloseFrame:
+		status := parseCloseFrame(payload)
+		r.peerStatus.Store(status)
+		r.sendClose(&CloseError{Code: status.Code})
+	}
+
+	return nil
+}
+
+func (r *netResponse) maxPayloadBytes() int {
+	if r.conn.MaxPayloadBytes > 0 {
+		return r.conn.MaxPayloadBytes
+	}
+
+	return websocket.DefaultMaxPayloadBytes
+}
+
+// connectionError returns nil at the end of the connection.
+func connectionError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+
+	return err
+}
+
+// peerError returns the close frame of the peer, unless it closed the connection normally.
+func peerError(status *CloseError) error {
+	if status.Code == CloseNormalClosure || status.Code == CloseNoStatusReceived {
+		return nil
 	}
 
-	return
+	return status
+}
+
+type netFrame struct {
+	payloadType byte
+	payload     []byte
+}
+
+// netControl sends control frames, it writes with the lock of the connection as Send does.
+var netControl = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		frame := v.(netFrame)
+		return frame.payload, frame.payloadType, nil
+	},
+}
+
+// netMessage sends messages with the frame type of TypedMessage.
+var netMessage = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		message := v.(Message)
+		if TypeOf(message) == MessageText {
+			return message.Buff(), websocket.TextFrame, nil
+		}
+
+		return message.Buff(), websocket.BinaryFrame, nil
+	},
+}
+
+func (r *netResponse) recordMessage(direction string, size int) {
+	labels := metrics.Labels{metrics.LabelDirection: direction}
+	r.metrics.AddCounter(metrics.WebsocketMessagesTotal, 1, labels)
+	r.metrics.AddCounter(metrics.WebsocketBytesTotal, float64(size), labels)
 }
@@ -4,14 +4,44 @@ import (
 	"context"
 	"fmt"
 	"golang.org/x/net/websocket"
+	"io"
 	"net/http/httptest"
 	"net/url"
 	"netshaper"
+	"netshaper/conf"
+	"netshaper/metrics"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
+// testBackends are the Config implementations, which must behave the same.
+var testBackends = []struct {
+	name    string
+	create  func(receiveTimeout time.Duration) conf.Option[Config]
+	closing func(code CloseCode, reason string, timeout time.Duration) conf.Option[Config]
+}{
+	{
+		name: "net",
+		create: func(receiveTimeout time.Duration) conf.Option[Config] {
+			return NewNet(WithNetReceiveTimeout(receiveTimeout))
+		},
+		closing: func(code CloseCode, reason string, timeout time.Duration) conf.Option[Config] {
+			return NewNet(WithNetCloseStatus(code, reason), WithNetCloseTimeout(timeout))
+		},
+	},
+	{
+		name: "coder",
+		create: func(receiveTimeout time.Duration) conf.Option[Config] {
+			return NewCoder(WithCoderReceiveTimeout(receiveTimeout))
+		},
+		closing: func(code CloseCode, reason string, timeout time.Duration) conf.Option[Config] {
+			return NewCoder(WithCoderCloseStatus(code, reason), WithCoderCloseTimeout(timeout))
+		},
+	},
+}
+
 func TestNetRequestMessages(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -52,61 +82,107 @@ func TestNetRequestMessages(t *testing.T) {
 				},
 			},
 			wantMessages: []Message{
-				ByteMessage("hey#000"),
-				ByteMessage("hey#001"),
-				ByteMessage("hey#002"),
-				ByteMessage("hey#003"),
-				ByteMessage("hey#004"),
-				ByteMessage("hey#005"),
-				ByteMessage("hey#006"),
-				ByteMessage("hey#007"),
-				ByteMessage("hey#008"),
-				ByteMessage("hey#009"),
+				TextMessage("hey#000"),
+				TextMessage("hey#001"),
+				TextMessage("hey#002"),
+				TextMessage("hey#003"),
+				TextMessage("hey#004"),
+				TextMessage("hey#005"),
+				TextMessage("hey#006"),
+				TextMessage("hey#007"),
+				TextMessage("hey#008"),
+				TextMessage("hey#009"),
+			},
+		},
+		{
+			name: "binary and text messages",
+			tester: &Tester{
+				RequestsAmount:          1,
+				ListenMessagesMaxAmount: 3,
+				ListenTimeout:           100 * time.Millisecond,
+			},
+			server: &websocket.Server{
+				Handler: func(conn *websocket.Conn) {
+					_ = websocket.Message.Send(conn, []byte{0, 1})
+					_ = websocket.Message.Send(conn, "text")
+				},
+			},
+			wantMessages: []Message{
+				ByteMessage{0, 1},
+				TextMessage("text"),
+			},
+		},
+		{
+			name: "large message",
+			tester: &Tester{
+				RequestsAmount:          1,
+				ListenMessagesMaxAmount: 3,
+				ListenTimeout:           100 * time.Millisecond,
+			},
+			server: &websocket.Server{
+				Handler: func(conn *websocket.Conn) {
+					_ = websocket.Message.Send(conn, strings.Repeat("a", 64<<10))
+					_ = websocket.Message.Send(conn, "text")
+				},
+			},
+			wantMessages: []Message{
+				TextMessage(strings.Repeat("a", 64<<10)),
+				TextMessage("text"),
 			},
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
-			if timeout := tt.tester.ListenTimeout; timeout > 0 {
-				var cancel context.CancelFunc
-				ctx, cancel = context.WithTimeout(ctx, tt.tester.ListenTimeout*100)
-				defer cancel()
-			}
+	for _, backend := range testBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				if timeout := tt.tester.ListenTimeout; timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.tester.ListenTimeout*100)
+					defer cancel()
+				}
 
-			srv := httptest.NewServer(tt.server)
-			defer srv.Close()
+				srv := httptest.NewServer(tt.server)
+				defer srv.Close()
 
-			endpoint, _ := url.Parse(srv.URL)
-			endpoint.Scheme = "ws"
+				endpoint, _ := url.Parse(srv.URL)
+				endpoint.Scheme = "ws"
 
-			cl, err := netshaper.New(NewNet()).Create(ctx)
-			if err != nil {
-				t.Errorf("Create() error = %v", err)
-				return
-			}
+				cl, err := netshaper.New(backend.create(0)).Create(ctx)
+				if err != nil {
+					t.Errorf("Create() error = %v", err)
+					return
+				}
+
+				gotMessages, _ := tt.tester.RequestMessages(cl, &Request{
+					Ctx: ctx,
+					URL: *endpoint,
+				})
 
-			gotMessages, _ := tt.tester.RequestMessages(cl, &Request{
-				Ctx: ctx,
-				URL: *endpoint,
+				if !reflect.DeepEqual(gotMessages, tt.wantMessages) {
+					t.Errorf("Request().Listen() messages got = %v, want %v", gotMessages, tt.wantMessages)
+				}
 			})
+		}
+	}
+}
 
-			if !reflect.DeepEqual(gotMessages, tt.wantMessages) {
-				t.Errorf("Request().Listen() messages got = %v, want %v", gotMessages, tt.wantMessages)
-			}
+func TestNetRequestErrors(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testRequestErrors(t, backend.create)
 		})
 	}
 }
 
-func TestNetRequestErrors(t *testing.T) {
+func testRequestErrors(t *testing.T, create func(receiveTimeout time.Duration) conf.Option[Config]) {
 	t.Run("connection refused", func(t *testing.T) {
 		want := &websocket.DialError{Config: &websocket.Config{}}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
 
-		cl, err := netshaper.New(NewNet()).Create(ctx)
+		cl, err := netshaper.New(create(0)).Create(ctx)
 		if err != nil {
 			t.Errorf("Create() error = %v", err)
 			return
@@ -147,7 +223,7 @@ func TestNetRequestErrors(t *testing.T) {
 		endpoint, _ := url.Parse(srv.URL)
 		endpoint.Scheme = "ws"
 
-		cl, err := NewNet(WithNetReceiveTimeout(timeout)).Apply(nil).Create(ctx)
+		cl, err := create(timeout).Apply(nil).Create(ctx)
 		if err != nil {
 			t.Errorf("Create() error = %v", err)
 			return
@@ -179,3 +255,131 @@ func TestNetRequestErrors(t *testing.T) {
 		}
 	})
 }
+
+func TestNetRequestMetrics(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testRequestMetrics(t, backend.create(0))
+		})
+	}
+}
+
+func testRequestMetrics(t *testing.T, backend conf.Option[Config]) {
+	m := metrics.NewMemory()
+	ctx, cancel := context.WithTimeout(metrics.ContextWith(context.Background(), m), time.Second)
+	defer cancel()
+
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		buf := []byte{}
+		if err := websocket.Message.Receive(conn, &buf); err == nil {
+			_ = websocket.Message.Send(conn, append(buf, buf...))
+		}
+	}))
+	defer srv.Close()
+
+	endpoint, _ := url.Parse(srv.URL)
+	endpoint.Scheme = "ws"
+
+	cl, err := netshaper.New(backend).Create(ctx)
+	if err != nil {
+		t.Errorf("Create() error = %v", err)
+		return
+	}
+	defer cl.Close(ctx)
+
+	res, err := cl.Request(&Request{Ctx: ctx, URL: *endpoint})
+	if err != nil {
+		t.Errorf("Request() error = %v", err)
+		return
+	}
+	defer res.Close(ctx)
+
+	if got := m.Gauge(metrics.WebsocketConnections, nil); got != 1 {
+		t.Errorf("connections got = %v, want %v", got, 1)
+	}
+
+	if err = res.Send(ByteMessage("hey")); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+	for range res.Listen() {
+	}
+
+	in := metrics.Labels{metrics.LabelDirection: metrics.DirectionIn}
+	out := metrics.Labels{metrics.LabelDirection: metrics.DirectionOut}
+
+	if got := m.Counter(metrics.WebsocketMessagesTotal, out); got != 1 {
+		t.Errorf("sent messages got = %v, want %v", got, 1)
+	}
+	if got := m.Counter(metrics.WebsocketBytesTotal, out); got != 3 {
+		t.Errorf("sent bytes got = %v, want %v", got, 3)
+	}
+	if got := m.Counter(metrics.WebsocketMessagesTotal, in); got != 1 {
+		t.Errorf("received messages got = %v, want %v", got, 1)
+	}
+	if got := m.Counter(metrics.WebsocketBytesTotal, in); got != 6 {
+		t.Errorf("received bytes got = %v, want %v", got, 6)
+	}
+	if got := m.Gauge(metrics.WebsocketConnections, nil); got != 0 {
+		t.Errorf("connections after close got = %v, want %v", got, 0)
+	}
+}
+
+func TestNetRequestSendTypes(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			want := []Message{TextMessage("text"), ByteMessage{0, 1}, TextMessage("{}")}
+
+			// the server echoes frames with their payload type
+			srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+				for echoed := 0; echoed < len(want); {
+					frame, err := conn.NewFrameReader()
+					if err != nil {
+						return
+					}
+					if frame.PayloadType() != websocket.TextFrame && frame.PayloadType() != websocket.BinaryFrame {
+						continue
+					}
+
+					payload, _ := io.ReadAll(frame)
+					writer, _ := conn.NewFrameWriter(frame.PayloadType())
+					_, _ = writer.Write(payload)
+					_ = writer.Close()
+					echoed++
+				}
+			}))
+			defer srv.Close()
+
+			endpoint, _ := url.Parse(srv.URL)
+			endpoint.Scheme = "ws"
+
+			cl, err := netshaper.New(backend.create(0)).Create(ctx)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+			defer cl.Close(ctx)
+
+			res, err := cl.Request(&Request{Ctx: ctx, URL: *endpoint})
+			if err != nil {
+				t.Errorf("Request() error = %v", err)
+				return
+			}
+			defer res.Close(ctx)
+
+			for _, msg := range want {
+				if err = res.Send(msg); err != nil {
+					t.Errorf("Send() error = %v", err)
+				}
+			}
+
+			for _, wantMsg := range want {
+				if got := <-res.Listen(); !reflect.DeepEqual(got, wantMsg) {
+					t.Errorf("Request().Listen() message got = %#v, want %#v", got, wantMsg)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@ package websocket
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"netshaper"
 	"netshaper/conf"
+	"netshaper/metrics"
 	"netshaper/timer"
 	"sync"
 	"time"
@@ -30,11 +34,27 @@ func WithRobustAutoRefreshJitter(jitter time.Duration) conf.Option[RobustConfig]
 	})
 }
 
+// WithRobustReconnect decides by the error of a lost connection whether it's reconnected, DefaultRobustReconnect
+// by default. The robust response is closed with the error otherwise.
+func WithRobustReconnect(reconnect func(err error) bool) conf.Option[RobustConfig] {
+	return conf.OptionFunc[RobustConfig](func(config RobustConfig) RobustConfig {
+		config.Reconnect = reconnect
+		return config
+	})
+}
+
+// DefaultRobustReconnect reconnects unless the peer closed the connection with ClosePolicyViolation.
+func DefaultRobustReconnect(err error) bool {
+	var closeErr *CloseError
+	return !errors.As(err, &closeErr) || closeErr.Code != ClosePolicyViolation
+}
+
 var _ Config = (*RobustConfig)(nil)
 
 type RobustConfig struct {
 	Inner       Config
 	AutoRefresh timer.Ticker
+	Reconnect   func(err error) bool
 }
 
 func (c *RobustConfig) Create(ctx context.Context) (Client, error) {
@@ -46,11 +66,19 @@ func (c *RobustConfig) Create(ctx context.Context) (Client, error) {
 		return nil, err
 	}
 
+	reconnect := c.Reconnect
+	if reconnect == nil {
+		reconnect = DefaultRobustReconnect
+	}
+
 	return &robust{
 		inner:       inner,
 		ctx:         ctx,
 		cancel:      cancel,
 		autoRefresh: c.AutoRefresh,
+		reconnect:   reconnect,
+		metrics:     metrics.FromContext(ctx),
+		logger:      netshaper.LoggerFromContext(ctx),
 	}, nil
 }
 
@@ -61,7 +89,10 @@ type robust struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	autoRefresh timer.Ticker
+	reconnect   func(err error) bool
 	responsesWg sync.WaitGroup
+	metrics     metrics.Metrics
+	logger      *slog.Logger
 }
 
 func (c *robust) Request(req *Request) (RawResponse, error) {
@@ -77,8 +108,11 @@ func (c *robust) Request(req *Request) (RawResponse, error) {
 		cancel:           resCancel,
 		responseWg:       &c.responsesWg,
 		inner:            c.inner,
+		reconnect:        c.reconnect,
 		incomingMessages: incomingMessages,
 		outgoingMessages: outgoingMessages,
+		metrics:          c.metrics,
+		logger:           c.logger,
 	}
 
 	defer c.responsesWg.Add(1)
@@ -103,9 +137,14 @@ type robustResponse struct {
 	cancel           context.CancelFunc
 	responseWg       *sync.WaitGroup
 	inner            Client
+	reconnect        func(err error) bool
 	incomingMessages <-chan Message
 	outgoingMessages chan<- Message
 	workersWg        sync.WaitGroup
+	mu               sync.Mutex
+	err              error
+	metrics          metrics.Metrics
+	logger           *slog.Logger
 }
 
 func (r *robustResponse) Send(message Message) (err error) {
@@ -129,7 +168,10 @@ func (r *robustResponse) Closed() <-chan struct{} {
 }
 
 func (r *robustResponse) Err() error {
-	return nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
 }
 
 func (r *robustResponse) Close(_ context.Context) {
@@ -142,15 +184,21 @@ func (r *robustResponse) produceUnderlying(req *Request, autoRefresh *timer.Tick
 	defer r.workersWg.Done()
 	defer close(responses)
 
-	for ok := true; ok; {
+	for ok, reconnect := true, false; ok; reconnect = true {
 		res, err := r.createUnderlying(req)
 		if err != nil {
 			return
 		}
 
-		responses <- res
+		if reconnect {
+			r.metrics.AddCounter(metrics.WebsocketReconnectsTotal, 1, nil)
+			r.logger.LogAttrs(req.Context(), slog.LevelInfo, "websocket reconnected", slog.String("url", req.URL.Redacted()))
+		}
+
+		underlying := &onceClosedResponse{RawResponse: res}
+		responses <- underlying
 
-		ok = r.handleUnderlying(res, autoRefresh)
+		ok = r.handleUnderlying(underlying, autoRefresh)
 	}
 }
 
@@ -172,6 +220,8 @@ func (r *robustResponse) createUnderlying(req *Request) (res RawResponse, err er
 }
 
 func (r *robustResponse) handleUnderlying(res RawResponse, autoRefresh *timer.Ticker) (ok bool) {
+	defer res.Close(r.ctx)
+
 	autoRefresh.Do(func(tmr timer.Timer) {
 		select {
 		case <-r.clientCtx.Done():
@@ -179,9 +229,18 @@ func (r *robustResponse) handleUnderlying(res RawResponse, autoRefresh *timer.Ti
 		case <-r.ctx.Done():
 			return
 		case <-res.Closed():
-			ok = true
+			err := res.Err()
+			if err != nil {
+				r.logger.LogAttrs(r.ctx, slog.LevelWarn, "websocket connection lost", slog.Any("error", err))
+			}
+
+			if ok = r.reconnect(err); !ok {
+				r.mu.Lock()
+				r.err = err
+				r.mu.Unlock()
+				r.cancel()
+			}
 		case <-tmr.Ticks():
-			res.Close(r.ctx)
 			ok = true
 		}
 	})
@@ -216,3 +275,15 @@ func (r *robustResponse) forwardMessages(responses <-chan RawResponse, incomingM
 		}
 	}
 }
+
+// onceClosedResponse closes the underlying response once, both robust workers close it.
+type onceClosedResponse struct {
+	RawResponse
+	closeOnce sync.Once
+}
+
+func (r *onceClosedResponse) Close(ctx context.Context) {
+	r.closeOnce.Do(func() {
+		r.RawResponse.Close(ctx)
+	})
+}
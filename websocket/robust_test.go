@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"context"
+	"netshaper/metrics"
 	"netshaper/timer"
 	"reflect"
 	"testing"
@@ -15,6 +16,7 @@ func TestRobustRequest(t *testing.T) {
 		tester                  *Tester
 		autoRefresh             timer.Ticker
 		wantInnerRequestsAmount int
+		wantReconnects          float64
 		wantMessages            []Message
 		wantErrors              []error
 	}{
@@ -79,6 +81,7 @@ func TestRobustRequest(t *testing.T) {
 				ListenMessagesMaxAmount: 8,
 			},
 			wantInnerRequestsAmount: 4,
+			wantReconnects:          3,
 			wantMessages: []Message{
 				TextMessage("0"),
 				TextMessage("1"),
@@ -140,6 +143,7 @@ func TestRobustRequest(t *testing.T) {
 				ListenMessagesMaxAmount: 11,
 			},
 			wantInnerRequestsAmount: 8,
+			wantReconnects:          4,
 			wantMessages: []Message{
 				TextMessage("0"),
 				TextMessage("1"),
@@ -183,6 +187,7 @@ func TestRobustRequest(t *testing.T) {
 				Period: 20 * time.Millisecond,
 			},
 			wantInnerRequestsAmount: 3,
+			wantReconnects:          2,
 			wantMessages: []Message{
 				TextMessage("0"),
 				TextMessage("1"),
@@ -199,7 +204,8 @@ func TestRobustRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
+			m := metrics.NewMemory()
+			ctx := metrics.ContextWith(context.Background(), m)
 			if timeout := tt.tester.ListenTimeout; timeout > 0 {
 				var cancel context.CancelFunc
 				ctx, cancel = context.WithTimeout(ctx, tt.tester.ListenTimeout*100)
@@ -221,6 +227,9 @@ func TestRobustRequest(t *testing.T) {
 			if gotLen := len(mock.Requests()); gotLen != tt.wantInnerRequestsAmount {
 				t.Errorf("len(mock.Requests()) got = %v, want %v", gotLen, tt.wantInnerRequestsAmount)
 			}
+			if got := m.Counter(metrics.WebsocketReconnectsTotal, nil); got != tt.wantReconnects {
+				t.Errorf("reconnects got = %v, want %v", got, tt.wantReconnects)
+			}
 			if !reflect.DeepEqual(gotErrors, tt.wantErrors) {
 				t.Errorf("Request().Listen() errors got = %v, want %v", gotErrors, tt.wantErrors)
 			}